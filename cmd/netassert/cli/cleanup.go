@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
+	"github.com/controlplaneio/netassert/v2/internal/logger"
+)
+
+// cleanupCmdConfig - config for the inspect and cleanup sub-commands
+type cleanupCmdConfig struct {
+	KubeConfig             string
+	Namespace              string
+	ScannerContainerPrefix string
+	SnifferContainerPrefix string
+	Threshold              int
+	Action                 string
+	DryRun                 bool
+	LogLevel               string
+}
+
+var (
+	cleanupCmdCfg = cleanupCmdConfig{
+		ScannerContainerPrefix: runCmdCfg.ScannerContainerPrefix,
+		SnifferContainerPrefix: runCmdCfg.SnifferContainerPrefix,
+		Threshold:              10, // minimum number of netassert ephemeral containers of the Pods to clean up
+		Action:                 string(kubeops.CleanupRestart),
+		LogLevel:               "info",
+	}
+
+	inspectCmd = &cobra.Command{
+		Use:     "inspect",
+		Short:   "list the Pods holding ephemeral containers injected by netassert and how many",
+		Run:     inspectPods,
+		Version: rootCmd.Version,
+	}
+
+	cleanupCmd = &cobra.Command{
+		Use:   "cleanup",
+		Short: "recreate the Pods holding at least --threshold ephemeral containers injected by netassert",
+		Long: "Ephemeral containers cannot be removed from a Pod, so the Pods holding at least --threshold " +
+			"ephemeral containers injected by netassert are recreated, either by restarting the Deployment, " +
+			"StatefulSet or DaemonSet that owns them (--action restart) or by evicting them (--action evict). " +
+			"The Pods that are not owned by a workload and the Pods in which netassert containers are still running " +
+			"are never recreated, so the workloads holding such Pods are not restarted. Use --dry-run to preview the changes.",
+		Run:     cleanupPods,
+		Version: rootCmd.Version,
+	}
+)
+
+// inspectPods - lists the Pods holding netassert ephemeral containers
+func inspectPods(cmd *cobra.Command, args []string) {
+	k8sSvc, err := cleanupService()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to build K8s client:", err)
+		os.Exit(1)
+	}
+
+	usages, err := listEphemeralContainerUsage(cmd.Context(), k8sSvc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(1)
+	}
+
+	if len(usages) == 0 {
+		fmt.Println("✅ No Pod holds ephemeral containers injected by netassert")
+		return
+	}
+
+	if err := printUsages(os.Stdout, usages); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Unable to print the Pods:", err)
+		os.Exit(1)
+	}
+}
+
+// cleanupPods - recreates the Pods holding too many netassert ephemeral containers
+func cleanupPods(cmd *cobra.Command, args []string) {
+	action := kubeops.CleanupAction(cleanupCmdCfg.Action)
+	if action != kubeops.CleanupRestart && action != kubeops.CleanupEvict {
+		fmt.Fprintf(os.Stderr, "❌ unsupported action %q, must be restart or evict\n", cleanupCmdCfg.Action)
+		os.Exit(1)
+	}
+
+	if cleanupCmdCfg.Threshold < 1 {
+		fmt.Fprintln(os.Stderr, "❌ --threshold must be greater than zero")
+		os.Exit(1)
+	}
+
+	k8sSvc, err := cleanupService()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to build K8s client:", err)
+		os.Exit(1)
+	}
+
+	usages, err := listEphemeralContainerUsage(cmd.Context(), k8sSvc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(1)
+	}
+
+	steps, skipped := kubeops.PlanCleanup(usages, cleanupCmdCfg.Threshold, action)
+
+	for _, pod := range slices.Sorted(maps.Keys(skipped)) {
+		fmt.Printf("⏭ Skipping Pod %s: %s\n", pod, skipped[pod])
+	}
+
+	if len(steps) == 0 {
+		fmt.Printf("✅ No Pod holds %d or more ephemeral containers injected by netassert that can be recreated\n",
+			cleanupCmdCfg.Threshold)
+		return
+	}
+
+	// a restart recreates all the Pods of the workload, not only the ones holding too many containers
+	if err := k8sSvc.ListRestartedPods(cmd.Context(), steps); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, step := range steps {
+		if cleanupCmdCfg.DryRun {
+			fmt.Println("🔍 Would", step.String())
+			continue
+		}
+
+		if err := k8sSvc.ApplyCleanupStep(cmd.Context(), step); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			failed = true
+			continue
+		}
+
+		fmt.Println("♻️ Done:", step.String())
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// cleanupService - creates the K8s service used by the inspect and cleanup sub-commands
+func cleanupService() (*kubeops.Service, error) {
+	lg := logger.NewHCLogger(cleanupCmdCfg.LogLevel, fmt.Sprintf("%s-%s", appName, version), os.Stderr)
+	return createService(cleanupCmdCfg.KubeConfig, lg)
+}
+
+// listEphemeralContainerUsage - returns the Pods holding netassert ephemeral containers
+func listEphemeralContainerUsage(ctx context.Context, k8sSvc *kubeops.Service) ([]kubeops.EphemeralContainerUsage, error) {
+	return k8sSvc.ListEphemeralContainerUsage(ctx, cleanupCmdCfg.Namespace,
+		[]string{cleanupCmdCfg.ScannerContainerPrefix, cleanupCmdCfg.SnifferContainerPrefix})
+}
+
+// printUsages - writes a table of the Pods holding netassert ephemeral containers to w
+func printUsages(w io.Writer, usages []kubeops.EphemeralContainerUsage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tPOD\tOWNER\tNETASSERT\tRUNNING\tTOTAL")
+
+	for _, usage := range usages {
+		owner := "-"
+		if usage.Owner != nil {
+			owner = usage.Owner.String()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\n", usage.Namespace, usage.Pod, owner,
+			usage.Netassert, usage.Running, usage.Total)
+	}
+
+	return tw.Flush()
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{inspectCmd, cleanupCmd} {
+		cmd.Flags().StringVarP(&cleanupCmdCfg.KubeConfig, "kubeconfig", "k", cleanupCmdCfg.KubeConfig, "path to kubeconfig file")
+		cmd.Flags().StringVarP(&cleanupCmdCfg.Namespace, "namespace", "N", cleanupCmdCfg.Namespace, "namespace of the Pods, all the namespaces when empty")
+		cmd.Flags().StringVarP(&cleanupCmdCfg.ScannerContainerPrefix, "scanner-prefix", "x", cleanupCmdCfg.ScannerContainerPrefix, "prefix of the scanner debug container name")
+		cmd.Flags().StringVarP(&cleanupCmdCfg.SnifferContainerPrefix, "sniffer-prefix", "p", cleanupCmdCfg.SnifferContainerPrefix, "prefix of the sniffer container")
+		cmd.Flags().StringVarP(&cleanupCmdCfg.LogLevel, "log-level", "l", cleanupCmdCfg.LogLevel, "set log level (info, debug or trace)")
+	}
+
+	cleanupCmd.Flags().IntVar(&cleanupCmdCfg.Threshold, "threshold", cleanupCmdCfg.Threshold, "minimum number of ephemeral containers injected by netassert of the Pods to recreate")
+	cleanupCmd.Flags().StringVar(&cleanupCmdCfg.Action, "action", cleanupCmdCfg.Action, "how the Pods are recreated (restart or evict)")
+	cleanupCmd.Flags().BoolVar(&cleanupCmdCfg.DryRun, "dry-run", cleanupCmdCfg.DryRun, "only print the Pods that would be recreated")
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"maps"
+	"slices"
 
 	"github.com/controlplaneio/netassert/v2/internal/data"
 	"github.com/controlplaneio/netassert/v2/internal/kubeops"
@@ -44,3 +46,85 @@ func createService(kubeconfigPath string, l hclog.Logger) (*kubeops.Service, err
 
 	return kubeops.NewDefaultService(l)
 }
+
+// namespaceRequirements - returns what netassert needs to do in each namespace referenced by the tests
+func namespaceRequirements(testCases data.Tests, profile kubeops.SecurityProfile) []kubeops.NamespaceRequirements {
+	reqs := make(map[string]*kubeops.NamespaceRequirements)
+
+	// get returns the requirements of a namespace, creating them if needed
+	get := func(res *data.K8sResource) *kubeops.NamespaceRequirements {
+		req, ok := reqs[res.Namespace]
+		if !ok {
+			req = &kubeops.NamespaceRequirements{Namespace: res.Namespace, SecurityProfile: profile}
+			reqs[res.Namespace] = req
+		}
+
+		if !slices.Contains(req.ResourceKinds, string(res.Kind)) {
+			req.ResourceKinds = append(req.ResourceKinds, string(res.Kind))
+		}
+
+		return req
+	}
+
+	// the reverse tests inject the scanner in the destination and the sniffer in the source
+	tests := slices.Clone(testCases)
+	for _, tc := range testCases {
+		if reverse := tc.ReverseTest(); reverse != nil {
+			tests = append(tests, reverse)
+		}
+	}
+
+	for _, tc := range tests {
+		if tc.Src != nil && tc.Src.K8sResource != nil {
+			req := get(tc.Src.K8sResource)
+			// the scanner of a node runs in a probe Pod in the namespace of the source
+			if tc.Src.K8sResource.Kind == data.KindNode {
+				req.NodeProbe = true
+			} else {
+				req.Scanner = true
+			}
+		}
+
+		// the nodes are not namespaced, and nothing is injected in the destination nodes, their
+		// lookup is checked along with the permissions of the source
+		if tc.Dst != nil && tc.Dst.K8sResource != nil && tc.Dst.K8sResource.Kind == data.KindNode {
+			if tc.Src != nil && tc.Src.K8sResource != nil {
+				req := get(tc.Src.K8sResource)
+				if !slices.Contains(req.ResourceKinds, string(data.KindNode)) {
+					req.ResourceKinds = append(req.ResourceKinds, string(data.KindNode))
+				}
+			}
+		}
+
+		if tc.Dst != nil && tc.Dst.K8sResource != nil && tc.Dst.K8sResource.Kind != data.KindNode {
+			req := get(tc.Dst.K8sResource)
+			// the scanner of a udpProbe waits for a reply, without a sniffer at the destination
+			if tc.Protocol == data.ProtocolUDP && tc.UDPProbe == nil {
+				req.Sniffer = true
+			}
+		}
+	}
+
+	namespaces := slices.Sorted(maps.Keys(reqs))
+	result := make([]kubeops.NamespaceRequirements, 0, len(namespaces))
+	for _, ns := range namespaces {
+		result = append(result, *reqs[ns])
+	}
+
+	return result
+}
+
+// loadSecurityProfile - loads the security profile of the injected containers and logs the
+// Pod Security Standards level that each container complies with
+func loadSecurityProfile(profile string, lg hclog.Logger) (kubeops.SecurityProfile, error) {
+	sp, err := kubeops.NewSecurityProfile(profile)
+	if err != nil {
+		return sp, err
+	}
+
+	lg.Info("Using security profile for the injected containers", "profile", sp.String(),
+		"scannerLevel", kubeops.PodSecurityLevelOf(sp.ScannerSecurityContext()),
+		"snifferLevel", kubeops.PodSecurityLevelOf(sp.SnifferSecurityContext()))
+
+	return sp, nil
+}
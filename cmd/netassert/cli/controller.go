@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+
+	"github.com/controlplaneio/netassert/v2/internal/controller"
+	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/logger"
+)
+
+// controllerCmdConfig - configuration for the controller command, the settings of the runs are
+// shared with the run command
+type controllerCmdConfig struct {
+	Namespace     string
+	Interval      time.Duration
+	WatchPolicies bool
+}
+
+// Initialize with default values
+var controllerCmdCfg = controllerCmdConfig{
+	Interval: 5 * time.Minute, // duration between two runs of the suites that do not set spec.interval
+}
+
+var controllerCmd = &cobra.Command{
+	Use:   "controller",
+	Short: "Run the tests of the NetAssertSuite custom resources and record their results in their status",
+	Long: "Run the tests of the NetAssertSuite custom resources and record their results in their status. " +
+		"The tests of a suite run when it is created or its spec changes, and then on the interval set in its " +
+		"spec.interval field or by --interval. A Warning Event is emitted on the suite for every failed test.",
+	Run: func(cmd *cobra.Command, args []string) {
+		lg := logger.NewHCLogger(runCmdCfg.LogLevel, fmt.Sprintf("%s-%s", appName, version), os.Stdout)
+		if err := runController(lg); err != nil {
+			lg.Error(" ❌ Failed to run the controller", "error", err)
+			os.Exit(1)
+		}
+	},
+
+	Version: rootCmd.Version,
+}
+
+// runController - reconciles the suites until a signal is received
+func runController(lg hclog.Logger) error {
+	if controllerCmdCfg.Interval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s, got %s", controllerCmdCfg.Interval)
+	}
+
+	containerCfg, err := containerConfig(lg)
+	if err != nil {
+		return fmt.Errorf("invalid container settings: %w", err)
+	}
+
+	if runCmdCfg.CollectLogs && runCmdCfg.LogsMaxBytes <= 0 {
+		return fmt.Errorf("--logs-max-bytes must be greater than zero when --collect-logs is set")
+	}
+
+	if err := validateRetryFlags(); err != nil {
+		return err
+	}
+
+	k8sSvc, err := createService(runCmdCfg.KubeConfig, lg)
+	if err != nil {
+		return fmt.Errorf("failed to build K8s client: %w", err)
+	}
+	// the Pods of the namespaces of the tests are tracked until the command exits
+	defer k8sSvc.StopPodTrackers()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	// the namespaces referenced by the suites are not known yet, so only the cluster is checked
+	if err := ping(ctx, lg, k8sSvc, nil, containerCfg.Settings.SecurityProfile, runCmdCfg.Executor); err != nil {
+		return fmt.Errorf("preflight checks failed: %w", err)
+	}
+
+	recorder, stopRecorder := k8sSvc.NewEventRecorder("netassert")
+	defer stopRecorder()
+
+	// the engine and the K8s service are shared by all the suites
+	testRunner := newTestRunner(k8sSvc, containerCfg, lg)
+
+	ctrl := controller.New(k8sSvc.Dynamic, recorder, func(ctx context.Context, testCases data.Tests) {
+		runTestCases(ctx, testRunner, testCases)
+	}, lg)
+	ctrl.Namespace = controllerCmdCfg.Namespace
+	ctrl.Interval = controllerCmdCfg.Interval
+
+	if controllerCmdCfg.WatchPolicies {
+		go watchPolicies(ctx, lg, k8sSvc, ctrl.TriggerAffected)
+	}
+
+	if err := ctrl.Run(ctx); err != nil {
+		return err
+	}
+
+	lg.Info("Received signal from OS", "msg", ctx.Err())
+
+	return nil
+}
+
+func init() {
+	controllerCmd.Flags().StringVar(&controllerCmdCfg.Namespace, "namespace", controllerCmdCfg.Namespace, "namespace whose NetAssertSuite resources are reconciled, all the namespaces when empty")
+	controllerCmd.Flags().DurationVar(&controllerCmdCfg.Interval, "interval", controllerCmdCfg.Interval, "duration between two runs of the suites that do not set spec.interval, at least 1s")
+	controllerCmd.Flags().BoolVar(&controllerCmdCfg.WatchPolicies, "watch-policies", controllerCmdCfg.WatchPolicies, "run the tests of the suites affected by the changes of the NetworkPolicies without waiting for their interval")
+	bindRunFlags(controllerCmd.Flags())
+}
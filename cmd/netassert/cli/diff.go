@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// exit codes of the diff sub-command
+const (
+	diffExitOK      = 0 // no gating changes were found
+	diffExitChanges = 1 // at least one gating change was found
+	diffExitError   = 2 // the results could not be compared
+)
+
+// kinds of changes that can gate a pipeline
+const (
+	changeNewlyFailing  = "newly-failing"
+	changeNewlyPassing  = "newly-passing"
+	changeAdded         = "added"
+	changeRemoved       = "removed"
+	changeReasonChanged = "reason-changed"
+)
+
+// diffCmdConfig - config for diff sub-command
+type diffCmdConfig struct {
+	FailOn []string
+	Output string
+}
+
+var (
+	diffCmdCfg = diffCmdConfig{
+		FailOn: []string{changeNewlyFailing},
+		Output: "text",
+	}
+
+	diffCmd = &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "compare the results of two runs, written in JSON (--json) or TAP (--tap) format",
+		Long: "compare the results of two runs, written in JSON (--json) or TAP (--tap) format, and report the " +
+			"newly failing, newly passing, added and removed tests and the tests whose failure reason changed.\n" +
+			"Exits with 0 when none of the changes selected by --fail-on were found, 1 when at least one was " +
+			"found and 2 when the results could not be compared.",
+		Args:    cobra.ExactArgs(2),
+		Run:     diffResults,
+		Version: rootCmd.Version,
+	}
+)
+
+// diffResults - compares the results of two runs
+func diffResults(cmd *cobra.Command, args []string) {
+	if err := validateFailOn(diffCmdCfg.FailOn); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(diffExitError)
+	}
+
+	if diffCmdCfg.Output != "text" && diffCmdCfg.Output != "json" {
+		fmt.Fprintf(os.Stderr, "❌ unsupported output format %q, must be text or json\n", diffCmdCfg.Output)
+		os.Exit(diffExitError)
+	}
+
+	oldResults, err := data.ReadResultsFromFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Unable to read old results:", err)
+		os.Exit(diffExitError)
+	}
+
+	newResults, err := data.ReadResultsFromFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Unable to read new results:", err)
+		os.Exit(diffExitError)
+	}
+
+	diff := data.DiffResults(oldResults, newResults)
+
+	if diffCmdCfg.Output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+	} else {
+		err = printDiff(os.Stdout, diff)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Unable to print the differences:", err)
+		os.Exit(diffExitError)
+	}
+
+	if gatingChanges(diff, diffCmdCfg.FailOn) > 0 {
+		os.Exit(diffExitChanges)
+	}
+
+	os.Exit(diffExitOK)
+}
+
+// diffChanges - returns the changes of the diff grouped by kind
+func diffChanges(diff *data.ResultsDiff) map[string][]data.ResultChange {
+	return map[string][]data.ResultChange{
+		changeNewlyFailing:  diff.NewlyFailing,
+		changeNewlyPassing:  diff.NewlyPassing,
+		changeAdded:         diff.Added,
+		changeRemoved:       diff.Removed,
+		changeReasonChanged: diff.ReasonChanged,
+	}
+}
+
+// validateFailOn - ensures that all the kinds of changes passed to --fail-on are known
+func validateFailOn(failOn []string) error {
+	known := []string{changeNewlyFailing, changeNewlyPassing, changeAdded, changeRemoved, changeReasonChanged}
+	for _, kind := range failOn {
+		if !slices.Contains(known, kind) {
+			return fmt.Errorf("unknown kind of change %q passed to --fail-on, must be one of %v", kind, known)
+		}
+	}
+
+	return nil
+}
+
+// gatingChanges - returns the number of changes whose kind is in failOn
+func gatingChanges(diff *data.ResultsDiff, failOn []string) int {
+	changes := diffChanges(diff)
+
+	total := 0
+	for _, kind := range failOn {
+		total += len(changes[kind])
+	}
+
+	return total
+}
+
+// printDiff - prints the differences in a human readable format
+func printDiff(w io.Writer, diff *data.ResultsDiff) error {
+	if diff.Empty() {
+		_, err := fmt.Fprintln(w, "✅ No differences found")
+		return err
+	}
+
+	sections := []struct {
+		title   string
+		changes []data.ResultChange
+	}{
+		{"❌ Newly failing", diff.NewlyFailing},
+		{"✅ Newly passing", diff.NewlyPassing},
+		{"➕ Added", diff.Added},
+		{"➖ Removed", diff.Removed},
+		{"🔀 Failure reason changed", diff.ReasonChanged},
+	}
+
+	for _, section := range sections {
+		if len(section.changes) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s (%d):\n", section.title, len(section.changes)); err != nil {
+			return err
+		}
+
+		for _, change := range section.changes {
+			if _, err := fmt.Fprintln(w, "  "+formatChange(change)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatChange - returns a single line description of a change
+func formatChange(change data.ResultChange) string {
+	line := fmt.Sprintf("- %s: %s -> %s", change.Name, statusOrNone(change.OldStatus), statusOrNone(change.NewStatus))
+
+	switch {
+	case change.OldReason != "" && change.NewReason != "":
+		line += fmt.Sprintf(" (%q -> %q)", change.OldReason, change.NewReason)
+	case change.NewReason != "":
+		line += fmt.Sprintf(" (%q)", change.NewReason)
+	case change.OldReason != "":
+		line += fmt.Sprintf(" (was %q)", change.OldReason)
+	}
+
+	return line
+}
+
+// statusOrNone - returns the status, or "none" when the test is missing from the results
+func statusOrNone(status data.ResultStatus) string {
+	if status == "" {
+		return "none"
+	}
+
+	return string(status)
+}
+
+func init() {
+	diffCmd.Flags().StringSliceVar(&diffCmdCfg.FailOn, "fail-on", diffCmdCfg.FailOn, "kinds of changes that make the command exit with 1 (newly-failing, newly-passing, added, removed or reason-changed)")
+	diffCmd.Flags().StringVarP(&diffCmdCfg.Output, "output", "o", diffCmdCfg.Output, "output format of the differences (text or json)")
+}
@@ -9,8 +9,9 @@ import (
 	"github.com/controlplaneio/netassert/v2/internal/data"
 )
 
-// genResult - Prints results to Stdout and writes it to a Tap file
-func genResult(testCases data.Tests, tapFile string, lg hclog.Logger) error {
+// genResult - Prints results to Stdout and writes it to a Tap file and optionally to a JSON file,
+// when bailOut is set the TAP file ends with a "Bail out!" line holding the reason the run was aborted
+func genResult(testCases data.Tests, tapFile, jsonFile, bailOut string, lg hclog.Logger) error {
 	failedTestCases := 0
 
 	for _, v := range testCases {
@@ -20,8 +21,21 @@ func genResult(testCases data.Tests, tapFile string, lg hclog.Logger) error {
 			continue
 		}
 
-		lg.Info("❌ Test Result", "Name", v.Name, "Pass", v.Pass, "FailureReason", v.FailureReason)
-		failedTestCases++
+		if v.Skipped() {
+			lg.Info("⏭ Test Result", "Name", v.Name, "Skip", v.Skip)
+			continue
+		}
+
+		lg.Info("❌ Test Result", "Name", v.Name, "Pass", v.Pass, "FailureReason", v.FailureReason, "Todo", v.Todo)
+		for _, cl := range v.ContainerLogs {
+			lg.Info("📜 Container logs", "Name", v.Name, "Container", cl.Container,
+				"Pod", cl.Pod, "Namespace", cl.Namespace, "Logs", cl.Log)
+		}
+
+		// the failures of the tests marked as todo do not fail the run
+		if v.Failed() {
+			failedTestCases++
+		}
 	}
 
 	tf, err := os.Create(tapFile)
@@ -29,7 +43,13 @@ func genResult(testCases data.Tests, tapFile string, lg hclog.Logger) error {
 		return fmt.Errorf("unable to create tap file %q: %w", tapFile, err)
 	}
 
-	if err := testCases.TAPResult(tf); err != nil {
+	if bailOut != "" {
+		err = testCases.TAPBailOut(tf, bailOut)
+	} else {
+		err = testCases.TAPResult(tf)
+	}
+
+	if err != nil {
 		return fmt.Errorf("unable to generate tap results: %w", err)
 	}
 
@@ -39,9 +59,40 @@ func genResult(testCases data.Tests, tapFile string, lg hclog.Logger) error {
 
 	lg.Info("✍ Wrote test result in a TAP File", "fileName", tapFile)
 
+	if jsonFile != "" {
+		if err := writeJSONResult(testCases, jsonFile); err != nil {
+			return err
+		}
+
+		lg.Info("✍ Wrote test result in a JSON File", "fileName", jsonFile)
+	}
+
+	if bailOut != "" {
+		return fmt.Errorf("test run aborted: %s", bailOut)
+	}
+
 	if failedTestCases > 0 {
 		return fmt.Errorf("total %v test cases have failed", failedTestCases)
 	}
 
 	return nil
 }
+
+// writeJSONResult - writes the structured results of the tests to a JSON file
+func writeJSONResult(testCases data.Tests, jsonFile string) error {
+	jf, err := os.Create(jsonFile)
+	if err != nil {
+		return fmt.Errorf("unable to create JSON file %q: %w", jsonFile, err)
+	}
+
+	if err := testCases.JSONResult(jf); err != nil {
+		_ = jf.Close()
+		return fmt.Errorf("unable to generate JSON results: %w", err)
+	}
+
+	if err := jf.Close(); err != nil {
+		return fmt.Errorf("unable to close JSON file %q: %w", jsonFile, err)
+	}
+
+	return nil
+}
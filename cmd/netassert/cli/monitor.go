@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	networkingv1 "k8s.io/api/networking/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
+	"github.com/controlplaneio/netassert/v2/internal/logger"
+	"github.com/controlplaneio/netassert/v2/internal/monitor"
+)
+
+// monitorCmdConfig - configuration for the monitor command, the settings of the runs are
+// shared with the run command
+type monitorCmdConfig struct {
+	Interval      time.Duration
+	Cron          string
+	ListenAddress string
+	WatchPolicies bool
+}
+
+// Initialize with default values
+var monitorCmdCfg = monitorCmdConfig{
+	Interval:      5 * time.Minute, // duration between two runs when no cron expression is set
+	ListenAddress: ":9090",         // address serving the metrics and the results of the last run
+}
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Continuously run the tests on an interval or a cron schedule and expose the results as Prometheus metrics",
+	Long: "Continuously run the tests on an interval or a cron schedule and expose the results as Prometheus metrics. " +
+		"The tests are read again before each run, so changes to the input file or directory are picked up " +
+		"without restarting. The metrics are served on /metrics, the results of the last completed run in JSON " +
+		"format on /results and a liveness probe on /healthz. Only one of --interval and --cron can be used.",
+	Run: func(cmd *cobra.Command, args []string) {
+		lg := logger.NewHCLogger(runCmdCfg.LogLevel, fmt.Sprintf("%s-%s", appName, version), os.Stdout)
+
+		// the default interval only applies when no cron expression is set
+		if monitorCmdCfg.Cron != "" && !cmd.Flags().Changed("interval") {
+			monitorCmdCfg.Interval = 0
+		}
+
+		if err := monitorTests(lg); err != nil {
+			lg.Error(" ❌ Failed to monitor the tests", "error", err)
+			os.Exit(1)
+		}
+	},
+
+	Version: rootCmd.Version,
+}
+
+// watchPolicies - calls trigger with a function returning the tests affected by every change of the
+// NetworkPolicies, until ctx is cancelled
+func watchPolicies(
+	ctx context.Context,
+	lg hclog.Logger,
+	k8sSvc *kubeops.Service,
+	trigger func(affected func(data.Tests) data.Tests),
+) {
+	err := k8sSvc.WatchNetworkPolicies(ctx, "", func(policies ...*networkingv1.NetworkPolicy) {
+		trigger(func(testCases data.Tests) data.Tests {
+			return k8sSvc.AffectedTests(ctx, testCases, policies...)
+		})
+	})
+	if err != nil {
+		lg.Error("Failed to watch the NetworkPolicies", "error", err)
+	}
+}
+
+// monitorTests - runs the tests according to the schedule until a signal is received
+func monitorTests(lg hclog.Logger) error {
+	schedule, err := monitor.ParseSchedule(monitorCmdCfg.Interval, monitorCmdCfg.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	// the tests are loaded once up front so that an invalid suite fails fast
+	testCases, err := loadTestCases(runCmdCfg.TestCasesFile, runCmdCfg.TestCasesDir)
+	if err != nil {
+		return fmt.Errorf("unable to load test cases: %w", err)
+	}
+
+	containerCfg, err := containerConfig(lg)
+	if err != nil {
+		return fmt.Errorf("invalid container settings: %w", err)
+	}
+
+	if runCmdCfg.CollectLogs && runCmdCfg.LogsMaxBytes <= 0 {
+		return fmt.Errorf("--logs-max-bytes must be greater than zero when --collect-logs is set")
+	}
+
+	if err := validateRetryFlags(); err != nil {
+		return err
+	}
+
+	k8sSvc, err := createService(runCmdCfg.KubeConfig, lg)
+	if err != nil {
+		return fmt.Errorf("failed to build K8s client: %w", err)
+	}
+	// the Pods of the namespaces of the tests are tracked until the command exits
+	defer k8sSvc.StopPodTrackers()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	if err := ping(ctx, lg, k8sSvc, testCases, containerCfg.Settings.SecurityProfile, runCmdCfg.Executor); err != nil {
+		return fmt.Errorf("preflight checks failed: %w", err)
+	}
+
+	// the engine and the K8s service are shared by all the runs
+	testRunner := newTestRunner(k8sSvc, containerCfg, lg)
+
+	mon := monitor.New(
+		func() (data.Tests, error) {
+			return loadTestCases(runCmdCfg.TestCasesFile, runCmdCfg.TestCasesDir)
+		},
+		func(ctx context.Context, testCases data.Tests) {
+			runTestCases(ctx, testRunner, testCases)
+		},
+		lg,
+	)
+	// the Pods are only tracked during the runs, and the probe Pods they could not delete are not
+	// left behind until the next one
+	mon.Cleanup = func(ctx context.Context) error {
+		k8sSvc.StopPodTrackers()
+		return k8sSvc.ReleaseProbePods(ctx)
+	}
+
+	// a failure of the HTTP server stops the runs as well
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := mon.ListenAndServe(ctx, monitorCmdCfg.ListenAddress)
+		stop()
+		errCh <- err
+	}()
+
+	lg.Info("Serving metrics", "address", monitorCmdCfg.ListenAddress)
+
+	if monitorCmdCfg.WatchPolicies {
+		go watchPolicies(ctx, lg, k8sSvc, func(affected func(data.Tests) data.Tests) {
+			testCases, err := loadTestCases(runCmdCfg.TestCasesFile, runCmdCfg.TestCasesDir)
+			if err != nil {
+				lg.Error("Unable to load test cases", "error", err)
+				return
+			}
+
+			var names []string
+			for _, tc := range affected(testCases) {
+				names = append(names, tc.Name)
+			}
+			mon.Trigger(names...)
+		})
+	}
+
+	mon.Run(ctx, schedule)
+	stop()
+
+	return <-errCh
+}
+
+func init() {
+	monitorCmd.Flags().DurationVar(&monitorCmdCfg.Interval, "interval", monitorCmdCfg.Interval, "duration between two runs of the tests, at least 1s")
+	monitorCmd.Flags().StringVar(&monitorCmdCfg.Cron, "cron", monitorCmdCfg.Cron, "cron expression in the standard five fields format scheduling the runs of the tests e.g. '*/10 * * * *'")
+	monitorCmd.Flags().BoolVar(&monitorCmdCfg.WatchPolicies, "watch-policies", monitorCmdCfg.WatchPolicies, "run the tests affected by the changes of the NetworkPolicies without waiting for the next run")
+	monitorCmd.Flags().StringVar(&monitorCmdCfg.ListenAddress, "listen-address", monitorCmdCfg.ListenAddress, "address on which /metrics, /results and /healthz are served")
+	bindInputFlags(monitorCmd.Flags())
+	bindRunFlags(monitorCmd.Flags())
+}
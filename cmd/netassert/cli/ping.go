@@ -3,12 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/spf13/cobra"
 
+	"github.com/controlplaneio/netassert/v2/internal/data"
 	"github.com/controlplaneio/netassert/v2/internal/kubeops"
 	"github.com/controlplaneio/netassert/v2/internal/logger"
 )
@@ -18,8 +23,13 @@ const (
 )
 
 type pingCmdConfig struct {
-	KubeConfig  string
-	PingTimeout time.Duration
+	KubeConfig    string
+	PingTimeout   time.Duration
+	TestCasesFile string
+	TestCasesDir  string
+	// SecurityProfile of the injected containers, checked against the PodSecurity level of the namespaces
+	SecurityProfile string
+	Executor        string // how the scanner and sniffer containers are run
 }
 
 var pingCmdCfg = pingCmdConfig{}
@@ -29,43 +39,159 @@ var pingCmd = &cobra.Command{
 	Short: "pings the K8s API server over HTTP(S) to see if it is alive and also checks if the server has support for " +
 		"ephemeral containers.",
 	Long: "pings the K8s API server over HTTP(S) to see if it is alive and also checks if the server has support for " +
-		"ephemeral/debug containers.",
+		"ephemeral/debug containers. When test cases are provided using --input-file or --input-dir, it also checks " +
+		"the RBAC permissions and the PodSecurity admission level of every namespace referenced by the tests.",
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx, cancel := context.WithTimeout(context.Background(), pingCmdCfg.PingTimeout)
 		defer cancel()
 		lg := logger.NewHCLogger("info", fmt.Sprintf("%s-%s", appName, version), os.Stdout)
+
+		var testCases data.Tests
+		if pingCmdCfg.TestCasesFile != "" || pingCmdCfg.TestCasesDir != "" {
+			var err error
+			testCases, err = loadTestCases(pingCmdCfg.TestCasesFile, pingCmdCfg.TestCasesDir)
+			if err != nil {
+				lg.Error("Ping failed, unable to load test cases", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := checkExecutor(pingCmdCfg.Executor); err != nil {
+			lg.Error("Ping failed", "error", err)
+			os.Exit(1)
+		}
+
+		profile, err := loadSecurityProfile(pingCmdCfg.SecurityProfile, lg)
+		if err != nil {
+			lg.Error("Ping failed, unable to load the security profile", "error", err)
+			os.Exit(1)
+		}
+
 		k8sSvc, err := createService(pingCmdCfg.KubeConfig, lg)
 
 		if err != nil {
 			lg.Error("Ping failed, unable to build K8s Client", "error", err)
 			os.Exit(1)
 		}
-		ping(ctx, lg, k8sSvc)
+		if err := ping(ctx, lg, k8sSvc, testCases, profile, pingCmdCfg.Executor); err != nil {
+			lg.Error("❌ Ping failed", "error", err)
+			os.Exit(1)
+		}
 	},
 	Version: rootCmd.Version,
 }
 
-// checkEphemeralContainerSupport checks to see if ephemeral containers are supported by the K8s server
-func ping(ctx context.Context, lg hclog.Logger, k8sSvc *kubeops.Service) {
-
+// ping checks to see if the K8s server is alive, if ephemeral containers are supported
+// when they are used and if the namespaces referenced by the testCases are ready for the tests,
+// the callers decide how to exit when one of the checks fails
+func ping(
+	ctx context.Context,
+	lg hclog.Logger,
+	k8sSvc *kubeops.Service,
+	testCases data.Tests,
+	profile kubeops.SecurityProfile, // security profile of the injected containers
+	executor string, // how the scanner and sniffer containers are run
+) error {
 	if err := k8sSvc.PingHealthEndpoint(ctx, apiServerHealthEndpoint); err != nil {
-		lg.Error("Ping failed", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("unable to ping the Kubernetes server: %w", err)
 	}
 
 	lg.Info("✅ Successfully pinged " + apiServerHealthEndpoint + " endpoint of the Kubernetes server")
 
-	if err := k8sSvc.CheckEphemeralContainerSupport(ctx); err != nil {
-		lg.Error("❌ Ephemeral containers are not supported by the Kubernetes server",
-			"error", err)
-		os.Exit(1)
+	if kubeops.Executor(executor) != kubeops.ExecutorEphemeral {
+		lg.Info("⏭ Skipping the ephemeral containers check, they are not used by the executor", "executor", executor)
+	} else {
+		if err := k8sSvc.CheckEphemeralContainerSupport(ctx); err != nil {
+			return fmt.Errorf("ephemeral containers are not supported by the Kubernetes server: %w", err)
+		}
+
+		lg.Info("✅ Ephemeral containers are supported by the Kubernetes server")
+	}
+
+	if len(testCases) == 0 {
+		return nil
+	}
+
+	reqs := namespaceRequirements(testCases, profile)
+	for i := range reqs {
+		reqs[i].Executor = kubeops.Executor(executor)
+	}
+
+	if err := checkNamespaceReadiness(ctx, k8sSvc, reqs, os.Stdout); err != nil {
+		return fmt.Errorf("namespaces are not ready for the tests: %w", err)
+	}
+
+	lg.Info("✅ All namespaces referenced by the tests are ready")
+
+	return nil
+}
+
+// checkNamespaceReadiness - runs the preflight checks for every namespace in reqs, writes a
+// readiness table to w and returns an error if any of the namespaces is not ready
+func checkNamespaceReadiness(
+	ctx context.Context,
+	k8sSvc *kubeops.Service,
+	reqs []kubeops.NamespaceRequirements,
+	w io.Writer,
+) error {
+	var notReady []string
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tSCANNER\tSNIFFER\tEXECUTOR\tNODE-PROBE\tPOD-SECURITY\tREADY\tISSUES")
+
+	for _, req := range reqs {
+		nr, err := k8sSvc.CheckNamespaceReadiness(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		issues := slices.Concat(nr.MissingPermissions, nr.Violations)
+		if len(issues) == 0 {
+			issues = []string{"-"}
+		}
+
+		ready := "yes"
+		if !nr.Ready() {
+			ready = "no"
+			notReady = append(notReady, nr.Namespace)
+		}
+
+		// the executor column reports the access of the executor running the scanner and sniffer
+		executor := string(nr.ExecutorAccess)
+		if nr.ExecutorAccess != kubeops.AccessNotRequired {
+			executor = fmt.Sprintf("%s (%s)", executorName(req.Executor), nr.ExecutorAccess)
+		}
+
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%s\t%s\t%s\t%s\t%s\n", nr.Namespace, req.Scanner, req.Sniffer,
+			executor, nr.NodeProbeAccess, nr.PodSecurityLevelString(), ready, strings.Join(issues, "; "))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(notReady) > 0 {
+		return fmt.Errorf("namespace(s) %s are not ready", strings.Join(notReady, ", "))
+	}
+
+	return nil
+}
+
+// executorName - returns the name of the executor, which runs ephemeral containers when empty
+func executorName(executor kubeops.Executor) string {
+	if executor == "" {
+		return string(kubeops.ExecutorEphemeral)
 	}
 
-	lg.Info("✅ Ephemeral containers are supported by the Kubernetes server")
+	return string(executor)
 }
 
 func init() {
 	pingCmd.Flags().DurationVarP(&pingCmdCfg.PingTimeout, "timeout", "t", 60*time.Second,
 		"Timeout for the ping command")
 	pingCmd.Flags().StringVarP(&pingCmdCfg.KubeConfig, "kubeconfig", "k", "", "path to kubeconfig file")
+	pingCmd.Flags().StringVarP(&pingCmdCfg.TestCasesFile, "input-file", "f", "", "input test file used to check the readiness of the namespaces")
+	pingCmd.Flags().StringVarP(&pingCmdCfg.TestCasesDir, "input-dir", "d", "", "input test directory used to check the readiness of the namespaces")
+	pingCmd.Flags().StringVar(&pingCmdCfg.Executor, "executor", string(kubeops.ExecutorEphemeral), "how the scanner/sniffer containers are run (ephemeral, pod or exec), the ephemeral containers support is only checked for ephemeral")
+	pingCmd.Flags().StringVar(&pingCmdCfg.SecurityProfile, "security-profile", kubeops.SecurityProfileRestricted, "security profile of the scanner/sniffer containers (restricted, baseline or path to a custom YAML profile)")
 }
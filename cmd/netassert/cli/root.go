@@ -34,4 +34,9 @@ func init() {
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(pingCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(monitorCmd)
+	rootCmd.AddCommand(controllerCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(cleanupCmd)
 }
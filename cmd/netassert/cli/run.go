@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,14 +11,19 @@ import (
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
 
+	"github.com/controlplaneio/netassert/v2/internal/data"
 	"github.com/controlplaneio/netassert/v2/internal/engine"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
 	"github.com/controlplaneio/netassert/v2/internal/logger"
 )
 
 // RunConfig - configuration for the run command
 type runCmdConfig struct {
 	TapFile                string
+	JSONFile               string
 	SuffixLength           int
 	SnifferContainerImage  string
 	SnifferContainerPrefix string
@@ -29,6 +35,21 @@ type runCmdConfig struct {
 	TestCasesFile          string
 	TestCasesDir           string
 	LogLevel               string
+	ImagePullPolicy        string
+	ImagePullSecrets       []string
+	ContainerRequests      map[string]string
+	ContainerLimits        map[string]string
+	ScannerImageOverrides  map[string]string
+	SnifferImageOverrides  map[string]string
+	SecurityProfile        string
+	CollectLogs            bool
+	LogsMaxBytes           int64
+	Executor               string
+	Retries                int
+	RetryBackoff           time.Duration
+	FlakyIsFailure         bool
+	ContainerOverhead      time.Duration
+	Timeout                time.Duration
 }
 
 // Initialize with default values
@@ -42,6 +63,10 @@ var runCmdCfg = runCmdConfig{
 	PauseInSeconds:         1,      // seconds to pause before each test case
 	PacketCaptureInterface: `eth0`, // the interface used by the sniffer image to capture traffic
 	LogLevel:               "info", // log level
+	LogsMaxBytes:           4096,   // maximum size of the logs of each injected container attached to a test
+	Executor:               string(kubeops.ExecutorEphemeral),
+	RetryBackoff:           engine.DefaultRetryBackoff,      // delay before the first retry of a failed test
+	ContainerOverhead:      engine.DefaultContainerOverhead, // time given to the containers to come online
 }
 
 var runCmd = &cobra.Command{
@@ -70,22 +95,50 @@ func runTests(lg hclog.Logger) error {
 		return fmt.Errorf("unable to load test cases: %w", err)
 	}
 
+	containerCfg, err := containerConfig(lg)
+	if err != nil {
+		return fmt.Errorf("invalid container settings: %w", err)
+	}
+
+	if runCmdCfg.CollectLogs && runCmdCfg.LogsMaxBytes <= 0 {
+		return fmt.Errorf("--logs-max-bytes must be greater than zero when --collect-logs is set")
+	}
+
+	if err := validateRetryFlags(); err != nil {
+		return err
+	}
+
+	if runCmdCfg.Timeout < 0 {
+		return fmt.Errorf("--timeout cannot be negative, got %s", runCmdCfg.Timeout)
+	}
+
 	//lg := logger.NewHCLogger(runCmdCfg.LogLevel, fmt.Sprintf("%s-%s", appName, version), os.Stdout)
 	k8sSvc, err := createService(runCmdCfg.KubeConfig, lg)
 	if err != nil {
 		return fmt.Errorf("failed to build K8s client: %w", err)
 	}
+	// the Pods of the namespaces of the tests are tracked until the command exits
+	defer k8sSvc.StopPodTrackers()
 
 	ctx := context.Background()
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
+	if runCmdCfg.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, runCmdCfg.Timeout)
+		defer cancelTimeout()
+	}
+
 	// ping the kubernetes cluster and check to see if
-	// it is alive and that it has support for ephemeral container(s)
-	ping(ctx, lg, k8sSvc)
+	// it is alive, that it has support for ephemeral container(s) and that
+	// the namespaces referenced by the tests are ready
+	if err := ping(ctx, lg, k8sSvc, testCases, containerCfg.Settings.SecurityProfile, runCmdCfg.Executor); err != nil {
+		return fmt.Errorf("preflight checks failed: %w", err)
+	}
 
 	// initialise our test runner
-	testRunner := engine.New(k8sSvc, lg)
+	testRunner := newTestRunner(k8sSvc, containerCfg, lg)
 	// initialise our done signal
 	done := make(chan struct{})
 
@@ -97,44 +150,171 @@ func runTests(lg hclog.Logger) error {
 		}()
 
 		// run the tests
-		testRunner.RunTests(
-			ctx,                              // context to use
-			testCases,                        // net assert test cases
-			runCmdCfg.SnifferContainerPrefix, // prefix used for the sniffer container name
-			runCmdCfg.SnifferContainerImage,  // sniffer container image location
-			runCmdCfg.ScannerContainerPrefix, // scanner container prefix used in the container name
-			runCmdCfg.ScannerContainerImage,  // scanner container image location
-			runCmdCfg.SuffixLength,           // length of random string that will be appended to the snifferContainerPrefix and scannerContainerPrefix
-			time.Duration(runCmdCfg.PauseInSeconds)*time.Second, // pause duration between each test
-			runCmdCfg.PacketCaptureInterface,                    // the interface used by the sniffer image to capture traffic
-		)
+		runTestCases(ctx, testRunner, testCases)
 	}()
 
 	// Wait for the tests to finish or for the context to be canceled
+	var bailOut string
 	select {
 	case <-done:
 		// all our tests have finished running
 	case <-ctx.Done():
-		lg.Info("Received signal from OS", "msg", ctx.Err())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			lg.Error("The run timed out, cancelling the tests still running", "timeout", runCmdCfg.Timeout)
+			bailOut = fmt.Sprintf("run timed out after %s", runCmdCfg.Timeout)
+		} else {
+			lg.Info("Received signal from OS", "msg", ctx.Err())
+			bailOut = "received signal from OS: " + ctx.Err().Error()
+		}
 		// context has been cancelled, we wait for our test runner to finish
 		<-done
 	}
 
-	return genResult(testCases, runCmdCfg.TapFile, lg)
+	return genResult(testCases, runCmdCfg.TapFile, runCmdCfg.JSONFile, bailOut, lg)
+}
+
+// newTestRunner - returns the engine running the tests, configured from the flags
+func newTestRunner(k8sSvc *kubeops.Service, containerCfg engine.ContainerConfig, lg hclog.Logger) *engine.Engine {
+	var runner engine.NetAssertTestRunner = k8sSvc
+	switch kubeops.Executor(runCmdCfg.Executor) {
+	case kubeops.ExecutorPod:
+		runner = kubeops.NewProbePodExecutor(k8sSvc)
+	case kubeops.ExecutorExec:
+		runner = kubeops.NewExecExecutor(k8sSvc)
+	}
+
+	testRunner := engine.New(runner, lg)
+	testRunner.Containers = containerCfg
+	if runCmdCfg.CollectLogs {
+		testRunner.LogsMaxBytes = runCmdCfg.LogsMaxBytes
+	}
+	testRunner.Retries = runCmdCfg.Retries
+	testRunner.RetryBackoff = runCmdCfg.RetryBackoff
+	testRunner.FlakyIsFailure = runCmdCfg.FlakyIsFailure
+	testRunner.ContainerOverhead = runCmdCfg.ContainerOverhead
+
+	return testRunner
+}
+
+// validateRetryFlags - returns an error if the default retry policy or the container overhead of the tests
+// is invalid
+func validateRetryFlags() error {
+	if runCmdCfg.Retries < 0 || runCmdCfg.Retries > data.MaxRetries {
+		return fmt.Errorf("--retries must be between 0 and %d, got %d", data.MaxRetries, runCmdCfg.Retries)
+	}
+
+	if runCmdCfg.RetryBackoff <= 0 {
+		return fmt.Errorf("--retry-backoff must be greater than zero, got %s", runCmdCfg.RetryBackoff)
+	}
+
+	if runCmdCfg.ContainerOverhead < 0 {
+		return fmt.Errorf("--container-overhead cannot be negative, got %s", runCmdCfg.ContainerOverhead)
+	}
+
+	return nil
+}
+
+// runTestCases - runs the test cases with the container settings passed as flags
+func runTestCases(ctx context.Context, testRunner *engine.Engine, testCases data.Tests) {
+	testRunner.RunTests(
+		ctx,                              // context to use
+		testCases,                        // net assert test cases
+		runCmdCfg.SnifferContainerPrefix, // prefix used for the sniffer container name
+		runCmdCfg.SnifferContainerImage,  // sniffer container image location
+		runCmdCfg.ScannerContainerPrefix, // scanner container prefix used in the container name
+		runCmdCfg.ScannerContainerImage,  // scanner container image location
+		runCmdCfg.SuffixLength,           // length of random string that will be appended to the snifferContainerPrefix and scannerContainerPrefix
+		time.Duration(runCmdCfg.PauseInSeconds)*time.Second, // pause duration between each test
+		runCmdCfg.PacketCaptureInterface,                    // the interface used by the sniffer image to capture traffic
+	)
+}
+
+// checkExecutor - returns an error if executor is not a supported way of running the containers
+func checkExecutor(executor string) error {
+	switch kubeops.Executor(executor) {
+	case kubeops.ExecutorEphemeral, kubeops.ExecutorPod, kubeops.ExecutorExec:
+		return nil
+	default:
+		return fmt.Errorf("invalid executor %q, must be %s, %s or %s", executor,
+			kubeops.ExecutorEphemeral, kubeops.ExecutorPod, kubeops.ExecutorExec)
+	}
+}
+
+// containerConfig - builds the run level configuration of the injected containers from the flags
+func containerConfig(lg hclog.Logger) (engine.ContainerConfig, error) {
+	if err := checkExecutor(runCmdCfg.Executor); err != nil {
+		return engine.ContainerConfig{}, err
+	}
+
+	if runCmdCfg.ImagePullPolicy != "" && !data.ValidImagePullPolicies[runCmdCfg.ImagePullPolicy] {
+		return engine.ContainerConfig{}, fmt.Errorf("invalid image pull policy %q", runCmdCfg.ImagePullPolicy)
+	}
+
+	requests, err := kubeops.ParseResourceList(runCmdCfg.ContainerRequests)
+	if err != nil {
+		return engine.ContainerConfig{}, fmt.Errorf("invalid container requests: %w", err)
+	}
+
+	limits, err := kubeops.ParseResourceList(runCmdCfg.ContainerLimits)
+	if err != nil {
+		return engine.ContainerConfig{}, fmt.Errorf("invalid container limits: %w", err)
+	}
+
+	profile, err := loadSecurityProfile(runCmdCfg.SecurityProfile, lg)
+	if err != nil {
+		return engine.ContainerConfig{}, err
+	}
+
+	return engine.ContainerConfig{
+		Settings: kubeops.ContainerSettings{
+			ImagePullPolicy: corev1.PullPolicy(runCmdCfg.ImagePullPolicy),
+			SecurityProfile: profile,
+			Resources:       corev1.ResourceRequirements{Requests: requests, Limits: limits},
+		},
+		ScannerImageOverrides: runCmdCfg.ScannerImageOverrides,
+		SnifferImageOverrides: runCmdCfg.SnifferImageOverrides,
+		ImagePullSecrets:      runCmdCfg.ImagePullSecrets,
+	}, nil
 }
 
 func init() {
 	// Bind flags to the runCmd
 	runCmd.Flags().StringVarP(&runCmdCfg.TapFile, "tap", "t", runCmdCfg.TapFile, "output tap file containing the tests results")
-	runCmd.Flags().IntVarP(&runCmdCfg.SuffixLength, "suffix-length", "s", runCmdCfg.SuffixLength, "length of the random suffix that will appended to the scanner/sniffer containers")
-	runCmd.Flags().StringVarP(&runCmdCfg.SnifferContainerImage, "sniffer-image", "i", runCmdCfg.SnifferContainerImage, "container image to be used as sniffer")
-	runCmd.Flags().StringVarP(&runCmdCfg.SnifferContainerPrefix, "sniffer-prefix", "p", runCmdCfg.SnifferContainerPrefix, "prefix of the sniffer container")
-	runCmd.Flags().StringVarP(&runCmdCfg.ScannerContainerImage, "scanner-image", "c", runCmdCfg.ScannerContainerImage, "container image to be used as scanner")
-	runCmd.Flags().StringVarP(&runCmdCfg.ScannerContainerPrefix, "scanner-prefix", "x", runCmdCfg.ScannerContainerPrefix, "prefix of the scanner debug container name")
-	runCmd.Flags().IntVarP(&runCmdCfg.PauseInSeconds, "pause-sec", "P", runCmdCfg.PauseInSeconds, "number of seconds to pause before running each test case")
-	runCmd.Flags().StringVarP(&runCmdCfg.PacketCaptureInterface, "interface", "n", runCmdCfg.PacketCaptureInterface, "the network interface used by the sniffer container to capture packets")
-	runCmd.Flags().StringVarP(&runCmdCfg.TestCasesFile, "input-file", "f", runCmdCfg.TestCasesFile, "input test file that contains a list of netassert tests")
-	runCmd.Flags().StringVarP(&runCmdCfg.TestCasesDir, "input-dir", "d", runCmdCfg.TestCasesDir, "input test directory that contains a list of netassert test files")
-	runCmd.Flags().StringVarP(&runCmdCfg.KubeConfig, "kubeconfig", "k", runCmdCfg.KubeConfig, "path to kubeconfig file")
-	runCmd.Flags().StringVarP(&runCmdCfg.LogLevel, "log-level", "l", "info", "set log level (info, debug or trace)")
+	runCmd.Flags().StringVar(&runCmdCfg.JSONFile, "json", runCmdCfg.JSONFile, "output JSON file containing the structured tests results, not written when empty")
+	runCmd.Flags().DurationVar(&runCmdCfg.Timeout, "timeout", runCmdCfg.Timeout, "maximum duration of the run, the tests still running are then cancelled and failed, no limit when 0")
+	bindInputFlags(runCmd.Flags())
+	bindRunFlags(runCmd.Flags())
+}
+
+// bindInputFlags - binds the flags selecting the file or the directory the tests are read from
+func bindInputFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&runCmdCfg.TestCasesFile, "input-file", "f", runCmdCfg.TestCasesFile, "input test file that contains a list of netassert tests")
+	fs.StringVarP(&runCmdCfg.TestCasesDir, "input-dir", "d", runCmdCfg.TestCasesDir, "input test directory that contains a list of netassert test files")
+}
+
+// bindRunFlags - binds the flags shared by the commands that run the tests
+func bindRunFlags(fs *pflag.FlagSet) {
+	fs.IntVarP(&runCmdCfg.SuffixLength, "suffix-length", "s", runCmdCfg.SuffixLength, "length of the random suffix that will appended to the scanner/sniffer containers")
+	fs.StringVarP(&runCmdCfg.SnifferContainerImage, "sniffer-image", "i", runCmdCfg.SnifferContainerImage, "container image to be used as sniffer")
+	fs.StringVarP(&runCmdCfg.SnifferContainerPrefix, "sniffer-prefix", "p", runCmdCfg.SnifferContainerPrefix, "prefix of the sniffer container")
+	fs.StringVarP(&runCmdCfg.ScannerContainerImage, "scanner-image", "c", runCmdCfg.ScannerContainerImage, "container image to be used as scanner")
+	fs.StringVarP(&runCmdCfg.ScannerContainerPrefix, "scanner-prefix", "x", runCmdCfg.ScannerContainerPrefix, "prefix of the scanner debug container name")
+	fs.IntVarP(&runCmdCfg.PauseInSeconds, "pause-sec", "P", runCmdCfg.PauseInSeconds, "number of seconds to pause before running each test case")
+	fs.StringVarP(&runCmdCfg.PacketCaptureInterface, "interface", "n", runCmdCfg.PacketCaptureInterface, "the network interface used by the sniffer container to capture packets")
+	fs.StringVarP(&runCmdCfg.KubeConfig, "kubeconfig", "k", runCmdCfg.KubeConfig, "path to kubeconfig file")
+	fs.StringVarP(&runCmdCfg.LogLevel, "log-level", "l", "info", "set log level (info, debug or trace)")
+	fs.StringVar(&runCmdCfg.ImagePullPolicy, "image-pull-policy", runCmdCfg.ImagePullPolicy, "image pull policy of the scanner/sniffer containers (Always, IfNotPresent or Never)")
+	fs.StringSliceVar(&runCmdCfg.ImagePullSecrets, "image-pull-secrets", runCmdCfg.ImagePullSecrets, "image pull secrets that the target Pods must reference to pull the scanner/sniffer images")
+	fs.StringToStringVar(&runCmdCfg.ContainerRequests, "container-requests", runCmdCfg.ContainerRequests, "resource requests of the scanner/sniffer containers e.g. cpu=10m,memory=32Mi")
+	fs.StringToStringVar(&runCmdCfg.ContainerLimits, "container-limits", runCmdCfg.ContainerLimits, "resource limits of the scanner/sniffer containers e.g. cpu=100m,memory=64Mi")
+	fs.StringVar(&runCmdCfg.SecurityProfile, "security-profile", kubeops.SecurityProfileRestricted, "security profile of the scanner/sniffer containers (restricted, baseline or path to a custom YAML profile)")
+	fs.StringToStringVar(&runCmdCfg.ScannerImageOverrides, "scanner-image-override", runCmdCfg.ScannerImageOverrides, "scanner image to use for Pods in a namespace e.g. namespace=registry/image:tag")
+	fs.BoolVar(&runCmdCfg.CollectLogs, "collect-logs", runCmdCfg.CollectLogs, "attach the tail of the logs of the scanner/sniffer containers to the tests results")
+	fs.Int64Var(&runCmdCfg.LogsMaxBytes, "logs-max-bytes", runCmdCfg.LogsMaxBytes, "maximum number of bytes of the logs collected from each scanner/sniffer container")
+	fs.StringVar(&runCmdCfg.Executor, "executor", runCmdCfg.Executor, "how the scanner/sniffer containers are run, injected as ephemeral containers in the tested Pods (ephemeral), in short-lived probe Pods copying their labels (pod) or replaced by nc, curl or bash run in the tested containers (exec, TCP only)")
+	fs.StringToStringVar(&runCmdCfg.SnifferImageOverrides, "sniffer-image-override", runCmdCfg.SnifferImageOverrides, "sniffer image to use for Pods in a namespace e.g. namespace=registry/image:tag")
+	fs.IntVar(&runCmdCfg.Retries, "retries", runCmdCfg.Retries, "number of times a failed test is run again, with a new Pod selection and new containers, when it does not set retries")
+	fs.DurationVar(&runCmdCfg.RetryBackoff, "retry-backoff", runCmdCfg.RetryBackoff, "delay before the first retry of a failed test, doubled after each retry, when it does not set retryBackoff")
+	fs.BoolVar(&runCmdCfg.FlakyIsFailure, "flaky-is-failure", runCmdCfg.FlakyIsFailure, "fail the tests that only pass after being retried")
+	fs.DurationVar(&runCmdCfg.ContainerOverhead, "container-overhead", runCmdCfg.ContainerOverhead, "time given to the scanner/sniffer containers of each test to be scheduled, to pull their images and to start, on top of the timeoutSeconds of the test, when it does not set containerOverhead")
 }
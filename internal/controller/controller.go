@@ -0,0 +1,433 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// RunFunc - runs the test cases, storing the results in them
+type RunFunc func(ctx context.Context, tests data.Tests)
+
+// Controller - reconciles the NetAssertSuite custom resources by running their tests on an interval
+// and recording the results in their status
+type Controller struct {
+	Client    dynamic.Interface    // client used to read and update the suites
+	Recorder  record.EventRecorder // recorder of the events emitted on the suites
+	Log       hclog.Logger
+	Namespace string        // namespace whose suites are reconciled, all the namespaces when empty
+	Interval  time.Duration // interval between two runs of the suites that do not set spec.interval
+
+	run RunFunc
+	now func() time.Time
+
+	mu        sync.Mutex
+	queue     workqueue.TypedRateLimitingInterface[string] // queue of the suites to reconcile, nil until Run is called
+	store     cache.Store                                  // cache of the suites, nil until Run is called
+	triggered map[string][]string                          // tests that must run before the interval of their suite has elapsed, by suite
+}
+
+// New - returns a new Controller
+func New(client dynamic.Interface, recorder record.EventRecorder, run RunFunc, log hclog.Logger) *Controller {
+	return &Controller{
+		Client:    client,
+		Recorder:  recorder,
+		Log:       log,
+		Interval:  5 * time.Minute,
+		run:       run,
+		now:       time.Now,
+		triggered: make(map[string][]string),
+	}
+}
+
+// Run - watches the suites and reconciles them until ctx is cancelled, the suites are reconciled
+// one at a time as the engine already runs the tests of a suite concurrently
+func (c *Controller) Run(ctx context.Context) error {
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	defer queue.ShutDown()
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.Client, 0, c.Namespace, nil)
+	informer := factory.ForResource(SuiteGVR).Informer()
+
+	enqueue := func(obj interface{}) {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			c.Log.Error("Unable to get the key of a suite", "error", err)
+			return
+		}
+		queue.Add(key)
+	}
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// the updates of the status do not change the generation and must not trigger a run
+			oldSuite, okOld := oldObj.(metav1.Object)
+			newSuite, okNew := newObj.(metav1.Object)
+			if okOld && okNew && oldSuite.GetGeneration() == newSuite.GetGeneration() {
+				return
+			}
+			enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch the %s resources: %w", SuiteKind, err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	c.mu.Lock()
+	c.queue, c.store = queue, informer.GetStore()
+	c.mu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		// the context was cancelled before the cache was synced
+		return nil
+	}
+
+	c.Log.Info("Watching the suites", "namespace", c.Namespace)
+
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	for c.processNextItem(ctx, queue) {
+	}
+
+	return nil
+}
+
+// processNextItem - reconciles the next suite of the queue, returns false when the queue is shut down
+func (c *Controller) processNextItem(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string]) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	requeueAfter, err := c.Reconcile(ctx, key)
+	switch {
+	case ctx.Err() != nil:
+		return false
+	case err != nil:
+		c.Log.Error("Failed to reconcile the suite", "suite", key, "error", err)
+		queue.AddRateLimited(key)
+	default:
+		queue.Forget(key)
+		if requeueAfter > 0 {
+			queue.AddAfter(key, requeueAfter)
+		}
+	}
+
+	return true
+}
+
+// Reconcile - runs the tests of the suite identified by key, in the namespace/name format, when
+// they are due and returns the duration after which the suite must be reconciled again
+func (c *Controller) Reconcile(ctx context.Context, key string) (time.Duration, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0, fmt.Errorf("invalid suite key %q: %w", key, err)
+	}
+
+	obj, err := c.Client.Resource(SuiteGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// the suite was deleted
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to get suite %s: %w", key, err)
+	}
+
+	suite, err := ParseSuite(obj)
+	if err != nil {
+		return 0, c.rejectSuite(ctx, suite, err)
+	}
+
+	interval := suite.Interval
+	if interval == 0 {
+		interval = c.Interval
+	}
+
+	triggered := c.takeTriggered(key)
+
+	requeue, err := c.runDueTests(ctx, suite, interval, triggered)
+	if err != nil {
+		// the triggered tests are kept so that they run with the next reconciliation of the suite
+		c.trigger(key, triggered)
+	}
+
+	return requeue, err
+}
+
+// runDueTests - runs all the tests of a suite when the spec changed or when the interval has elapsed, and
+// only the triggered ones otherwise, and returns the duration after which the suite must be reconciled again
+func (c *Controller) runDueTests(
+	ctx context.Context, // the context
+	suite *Suite, // the suite
+	interval time.Duration, // interval between two runs of the suite
+	triggered []string, // names of the tests that must run before the interval has elapsed
+) (time.Duration, error) {
+	// the tests run again when the spec changes or when the interval has elapsed
+	if suite.Status.ObservedGeneration == suite.Object.GetGeneration() && suite.Status.LastRunTime != nil {
+		if wait := suite.Status.LastRunTime.Add(interval).Sub(c.now()); wait > 0 {
+			// the triggered tests run on their own, the interval still runs from the last run of the suite
+			return wait, c.runTriggered(ctx, suite, triggered)
+		}
+	}
+
+	c.Log.Info("Running the tests of the suite", "suite", suiteRef(suite.Object), "tests", len(suite.Tests))
+	c.run(ctx, suite.Tests)
+
+	// the results of an interrupted run are incomplete, so they are discarded
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := metav1.NewTime(c.now())
+	status := suite.Status
+	status.LastRunTime = &now
+	status.Summary, status.Results = statusFromTests(suite.Tests)
+
+	if err := c.recordResults(ctx, suite, suite.Tests, status); err != nil {
+		return 0, err
+	}
+
+	return interval, nil
+}
+
+// runTriggered - runs the tests of a suite named in names, their results replace the ones of the last
+// run of the suite
+func (c *Controller) runTriggered(ctx context.Context, suite *Suite, names []string) error {
+	var selected data.Tests
+	for _, te := range suite.Tests {
+		if slices.Contains(names, te.Name) && !te.Skipped() {
+			selected = append(selected, te)
+		}
+	}
+
+	// the tests may have been removed since they were triggered
+	if len(selected) == 0 {
+		return nil
+	}
+
+	c.Log.Info("Running the triggered tests of the suite", "suite", suiteRef(suite.Object),
+		"tests", len(selected))
+	c.run(ctx, selected)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, results := statusFromTests(selected)
+	status := suite.Status
+	status.Results = mergeResults(suite.Status.Results, results)
+	status.Summary = summaryFromResults(status.Results)
+
+	return c.recordResults(ctx, suite, selected, status)
+}
+
+// TriggerAffected - runs the tests of the suites for which affected returns them without waiting for
+// the interval of their suites to elapse, the suites are reconciled by Run
+func (c *Controller) TriggerAffected(affected func(tests data.Tests) data.Tests) {
+	c.mu.Lock()
+	queue, store := c.queue, c.store
+	c.mu.Unlock()
+
+	if queue == nil {
+		return
+	}
+
+	for _, item := range store.List() {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		suite, err := ParseSuite(obj)
+		if err != nil {
+			continue
+		}
+
+		tests := affected(suite.Tests)
+		if len(tests) == 0 {
+			continue
+		}
+
+		key := suiteRef(obj)
+		c.Log.Info("Triggering the tests of the suite", "suite", key, "tests", len(tests))
+
+		names := make([]string, 0, len(tests))
+		for _, te := range tests {
+			names = append(names, te.Name)
+		}
+		c.trigger(key, names)
+
+		queue.Add(key)
+	}
+}
+
+// trigger - adds the tests in names to the triggered tests of the suite identified by key
+func (c *Controller) trigger(key string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		if !slices.Contains(c.triggered[key], name) {
+			c.triggered[key] = append(c.triggered[key], name)
+		}
+	}
+}
+
+// takeTriggered - returns the names of the triggered tests of the suite identified by key and clears them
+func (c *Controller) takeTriggered(key string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := c.triggered[key]
+	delete(c.triggered, key)
+
+	return names
+}
+
+// rejectSuite - records in the status of a suite that its spec is invalid
+func (c *Controller) rejectSuite(ctx context.Context, suite *Suite, specErr error) error {
+	c.Log.Error("Invalid suite", "suite", suiteRef(suite.Object), "error", specErr)
+
+	generation := suite.Object.GetGeneration()
+	if suite.Status.ObservedGeneration == generation &&
+		meta.IsStatusConditionFalse(suite.Status.Conditions, ConditionReady) {
+		// the suite has already been rejected
+		return nil
+	}
+
+	c.Recorder.Event(suite.Object, corev1.EventTypeWarning, ReasonInvalidSpec, specErr.Error())
+
+	status := suite.Status
+	status.Conditions = slices.Clone(suite.Status.Conditions)
+	status.ObservedGeneration = generation
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             ReasonInvalidSpec,
+		Message:            specErr.Error(),
+	})
+
+	return c.updateStatus(ctx, suite, status)
+}
+
+// recordResults - records the status of a suite whose tests in ran have just run and emits an event for
+// every one of them that failed
+func (c *Controller) recordResults(ctx context.Context, suite *Suite, ran data.Tests, status Status) error {
+	generation := suite.Object.GetGeneration()
+
+	status.Conditions = slices.Clone(suite.Status.Conditions)
+	status.ObservedGeneration = generation
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             ReasonRunCompleted,
+		Message:            fmt.Sprintf("%d tests ran", status.Summary.Total-status.Summary.Skipped),
+	})
+
+	for _, te := range ran {
+		if te.Failed() {
+			c.Recorder.Eventf(suite.Object, corev1.EventTypeWarning, ReasonTestFailed,
+				"test %s failed: %s", te.Name, te.FailureReason)
+		}
+	}
+
+	// the results of the tests that did not run are the ones of their last run
+	var failed []string
+	for _, res := range status.Results {
+		if res.Status != data.StatusPass && res.Status != data.StatusSkip && res.Todo == "" {
+			failed = append(failed, res.Name)
+		}
+	}
+
+	passed := metav1.Condition{
+		Type:               ConditionPassed,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             ReasonAllTestsPassed,
+		Message:            "all the tests passed",
+	}
+	if len(failed) > 0 {
+		passed.Status = metav1.ConditionFalse
+		passed.Reason = ReasonTestsFailed
+		passed.Message = fmt.Sprintf("%d of %d tests failed: %s", len(failed), status.Summary.Total,
+			strings.Join(failed, ", "))
+	} else if meta.IsStatusConditionFalse(suite.Status.Conditions, ConditionPassed) {
+		c.Recorder.Event(suite.Object, corev1.EventTypeNormal, ReasonTestsPassed, "all the tests passed again")
+	}
+	meta.SetStatusCondition(&status.Conditions, passed)
+
+	return c.updateStatus(ctx, suite, status)
+}
+
+// updateStatus - writes the status of a suite, the status is dropped when the spec of the suite
+// changed in the meantime as it no longer describes it
+func (c *Controller) updateStatus(ctx context.Context, suite *Suite, status Status) error {
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return fmt.Errorf("unable to encode the status of suite %s: %w", suiteRef(suite.Object), err)
+	}
+
+	client := c.Client.Resource(SuiteGVR).Namespace(suite.Object.GetNamespace())
+	obj := suite.Object.DeepCopy()
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if obj.GetGeneration() != suite.Object.GetGeneration() {
+			return nil
+		}
+
+		obj.Object["status"] = raw
+		_, err := client.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+
+		// get the latest version of the suite before trying again
+		latest, getErr := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		obj = latest
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update the status of suite %s: %w", suiteRef(suite.Object), err)
+	}
+
+	return nil
+}
+
+// suiteRef - returns the namespace/name reference of a suite
+func suiteRef(obj *unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
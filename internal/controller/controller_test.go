@@ -0,0 +1,460 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// newSuite - returns a NetAssertSuite holding tests
+func newSuite(name string, generation int64, tests ...map[string]interface{}) *unstructured.Unstructured {
+	rawTests := make([]interface{}, 0, len(tests))
+	for _, te := range tests {
+		rawTests = append(rawTests, te)
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Group + "/" + Version,
+		"kind":       SuiteKind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "netassert",
+		},
+		"spec": map[string]interface{}{
+			"tests": rawTests,
+		},
+	}}
+	obj.SetGeneration(generation)
+
+	return obj
+}
+
+// newTest - returns a raw TCP test from a Deployment to a host
+func newTest(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       name,
+		"type":       "k8s",
+		"protocol":   "tcp",
+		"targetPort": int64(443),
+		"exitCode":   int64(0),
+		"src": map[string]interface{}{
+			"k8sResource": map[string]interface{}{
+				"kind":      "deployment",
+				"name":      "busybox",
+				"namespace": "busybox",
+			},
+		},
+		"dst": map[string]interface{}{
+			"host": map[string]interface{}{"name": "control-plane.io"},
+		},
+	}
+}
+
+// newTestController - returns a controller whose runs pass the tests listed in pass
+func newTestController(pass map[string]bool, objects ...runtime.Object) (*Controller, *record.FakeRecorder, *int) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{SuiteGVR: SuiteKind + "List"}, objects...)
+	recorder := record.NewFakeRecorder(100)
+	runs := 0
+
+	run := func(_ context.Context, tests data.Tests) {
+		runs++
+		for _, te := range tests {
+			if te.Skipped() {
+				continue
+			}
+			te.Pass = pass[te.Name]
+			if !te.Pass {
+				te.FailureReason = "exit code 1 instead of 0"
+			}
+		}
+	}
+
+	c := New(client, recorder, run, hclog.NewNullLogger())
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	return c, recorder, &runs
+}
+
+// getStatus - returns the status of a suite
+func getStatus(t *testing.T, c *Controller, name string) Status {
+	t.Helper()
+
+	obj, err := c.Client.Resource(SuiteGVR).Namespace("netassert").Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	suite, _ := ParseSuite(obj)
+	return suite.Status
+}
+
+// events - returns the events recorded so far
+func events(recorder *record.FakeRecorder) []string {
+	var result []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			result = append(result, e)
+		default:
+			return result
+		}
+	}
+}
+
+func TestController_Reconcile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("the results are recorded in the status", func(t *testing.T) {
+		r := require.New(t)
+		c, recorder, runs := newTestController(map[string]bool{"test1": true},
+			newSuite("suite", 1, newTest("test1"), newTest("test2")))
+
+		requeue, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(c.Interval, requeue)
+		r.Equal(1, *runs)
+
+		status := getStatus(t, c, "suite")
+		r.Equal(int64(1), status.ObservedGeneration)
+		r.Equal(c.now().Unix(), status.LastRunTime.Unix())
+		r.Equal(Summary{Total: 2, Passed: 1, Failed: 1}, status.Summary)
+		r.Len(status.Results, 2)
+		r.Equal(data.StatusPass, status.Results[0].Status)
+		r.Equal(data.StatusFail, status.Results[1].Status)
+		r.Equal("exit code 1 instead of 0", status.Results[1].Reason)
+
+		r.True(meta.IsStatusConditionTrue(status.Conditions, ConditionReady))
+		passed := meta.FindStatusCondition(status.Conditions, ConditionPassed)
+		r.NotNil(passed)
+		r.Equal(metav1.ConditionFalse, passed.Status)
+		r.Equal(ReasonTestsFailed, passed.Reason)
+		r.Equal("1 of 2 tests failed: test2", passed.Message)
+
+		r.Equal([]string{"Warning TestFailed test test2 failed: exit code 1 instead of 0"}, events(recorder))
+	})
+
+	t.Run("the tests do not run again before the interval has elapsed", func(t *testing.T) {
+		r := require.New(t)
+		c, _, runs := newTestController(map[string]bool{"test1": true}, newSuite("suite", 1, newTest("test1")))
+
+		_, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+
+		start := c.now()
+		c.now = func() time.Time { return start.Add(time.Minute) }
+
+		requeue, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(c.Interval-time.Minute, requeue)
+		r.Equal(1, *runs)
+
+		c.now = func() time.Time { return start.Add(c.Interval) }
+
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(2, *runs)
+	})
+
+	t.Run("only the triggered tests run before the interval has elapsed", func(t *testing.T) {
+		r := require.New(t)
+		pass := map[string]bool{"test1": true}
+		c, recorder, _ := newTestController(pass, newSuite("suite", 1, newTest("test1"), newTest("test2")))
+
+		var ran []string
+		run := c.run
+		c.run = func(ctx context.Context, tests data.Tests) {
+			run(ctx, tests)
+			for _, te := range tests {
+				ran = append(ran, te.Name)
+			}
+		}
+
+		_, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		lastRun := getStatus(t, c, "suite").LastRunTime
+
+		start := c.now()
+		c.now = func() time.Time { return start.Add(time.Minute) }
+		pass["test2"] = true
+		ran = nil
+
+		c.triggered["netassert/suite"] = []string{"test2"}
+		requeue, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(c.Interval-time.Minute, requeue)
+		r.Equal([]string{"test2"}, ran)
+
+		status := getStatus(t, c, "suite")
+		r.Equal(lastRun.Unix(), status.LastRunTime.Unix())
+		r.Equal(Summary{Total: 2, Passed: 2}, status.Summary)
+		r.Len(status.Results, 2)
+		r.Equal("test1", status.Results[0].Name)
+		r.Equal(data.StatusPass, status.Results[1].Status)
+		r.True(meta.IsStatusConditionTrue(status.Conditions, ConditionPassed))
+
+		r.Equal([]string{
+			"Warning TestFailed test test2 failed: exit code 1 instead of 0",
+			"Normal TestsPassed all the tests passed again",
+		}, events(recorder))
+
+		// the trigger is cleared once the tests ran
+		ran = nil
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Empty(ran)
+	})
+
+	t.Run("the triggered tests run again when their results cannot be recorded", func(t *testing.T) {
+		r := require.New(t)
+		c, _, _ := newTestController(map[string]bool{"test1": true},
+			newSuite("suite", 1, newTest("test1"), newTest("test2")))
+
+		var ran []string
+		run := c.run
+		c.run = func(ctx context.Context, tests data.Tests) {
+			run(ctx, tests)
+			for _, te := range tests {
+				ran = append(ran, te.Name)
+			}
+		}
+
+		_, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+
+		start := c.now()
+		c.now = func() time.Time { return start.Add(time.Minute) }
+		ran = nil
+
+		// the status of the suite cannot be updated once
+		failed := false
+		c.Client.(*dynamicfake.FakeDynamicClient).PrependReactor("update", "netassertsuites",
+			func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "status" || failed {
+					return false, nil, nil
+				}
+				failed = true
+				return true, nil, errors.New("etcd is unavailable")
+			})
+
+		c.trigger("netassert/suite", []string{"test2"})
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.ErrorContains(err, "etcd is unavailable")
+		r.Equal([]string{"test2"}, ran)
+
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal([]string{"test2", "test2"}, ran)
+
+		// the trigger is cleared once the results are recorded
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Len(ran, 2)
+	})
+
+	t.Run("the interval of the suite overrides the default interval", func(t *testing.T) {
+		r := require.New(t)
+		suite := newSuite("suite", 1, newTest("test1"))
+		r.NoError(unstructured.SetNestedField(suite.Object, "30s", "spec", "interval"))
+		c, _, _ := newTestController(map[string]bool{"test1": true}, suite)
+
+		requeue, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(30*time.Second, requeue)
+	})
+
+	t.Run("the tests run again when the spec changes", func(t *testing.T) {
+		r := require.New(t)
+		c, recorder, runs := newTestController(map[string]bool{"test1": true},
+			newSuite("suite", 1, newTest("test1"), newTest("test2")))
+
+		_, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+
+		obj, err := c.Client.Resource(SuiteGVR).Namespace("netassert").Get(ctx, "suite", metav1.GetOptions{})
+		r.NoError(err)
+		r.NoError(unstructured.SetNestedSlice(obj.Object, []interface{}{newTest("test1")}, "spec", "tests"))
+		obj.SetGeneration(2)
+		_, err = c.Client.Resource(SuiteGVR).Namespace("netassert").Update(ctx, obj, metav1.UpdateOptions{})
+		r.NoError(err)
+
+		_, err = c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Equal(2, *runs)
+
+		status := getStatus(t, c, "suite")
+		r.Equal(int64(2), status.ObservedGeneration)
+		r.Equal(Summary{Total: 1, Passed: 1}, status.Summary)
+		r.True(meta.IsStatusConditionTrue(status.Conditions, ConditionPassed))
+
+		r.Equal([]string{
+			"Warning TestFailed test test2 failed: exit code 1 instead of 0",
+			"Normal TestsPassed all the tests passed again",
+		}, events(recorder))
+	})
+
+	t.Run("invalid suites are rejected once", func(t *testing.T) {
+		r := require.New(t)
+		invalid := newTest("test1")
+		invalid["protocol"] = "icmp"
+		c, recorder, runs := newTestController(nil, newSuite("suite", 1, invalid))
+
+		for range 2 {
+			requeue, err := c.Reconcile(ctx, "netassert/suite")
+			r.NoError(err)
+			r.Zero(requeue)
+		}
+		r.Zero(*runs)
+
+		status := getStatus(t, c, "suite")
+		ready := meta.FindStatusCondition(status.Conditions, ConditionReady)
+		r.NotNil(ready)
+		r.Equal(metav1.ConditionFalse, ready.Status)
+		r.Equal(ReasonInvalidSpec, ready.Reason)
+		r.Nil(status.LastRunTime)
+
+		recorded := events(recorder)
+		r.Len(recorded, 1)
+		r.True(strings.HasPrefix(recorded[0], "Warning InvalidSpec invalid spec.tests"), recorded[0])
+	})
+
+	t.Run("deleted suites are ignored", func(t *testing.T) {
+		r := require.New(t)
+		c, _, runs := newTestController(nil)
+
+		requeue, err := c.Reconcile(ctx, "netassert/suite")
+		r.NoError(err)
+		r.Zero(requeue)
+		r.Zero(*runs)
+	})
+
+	t.Run("the results of an interrupted run are discarded", func(t *testing.T) {
+		r := require.New(t)
+		c, recorder, _ := newTestController(nil, newSuite("suite", 1, newTest("test1")))
+
+		cancelled, cancel := context.WithCancel(ctx)
+		c.run = func(context.Context, data.Tests) { cancel() }
+
+		_, err := c.Reconcile(cancelled, "netassert/suite")
+		r.ErrorIs(err, context.Canceled)
+		r.Nil(getStatus(t, c, "suite").LastRunTime)
+		r.Empty(events(recorder))
+	})
+}
+
+func TestController_Run(t *testing.T) {
+	r := require.New(t)
+	c, _, _ := newTestController(map[string]bool{"test1": true},
+		newSuite("suite1", 1, newTest("test1")), newSuite("suite2", 1, newTest("test2")))
+
+	// ran receives the name of the first test of every run
+	ran := make(chan string, 10)
+	run := c.run
+	c.run = func(ctx context.Context, tests data.Tests) {
+		run(ctx, tests)
+		ran <- tests[0].Name
+	}
+
+	// the suites cannot be triggered before they are watched
+	c.TriggerAffected(func(tests data.Tests) data.Tests { return tests })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	r.ElementsMatch([]string{"test1", "test2"}, []string{<-ran, <-ran})
+
+	r.Eventually(func() bool {
+		return getStatus(t, c, "suite1").LastRunTime != nil && getStatus(t, c, "suite2").LastRunTime != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	r.True(meta.IsStatusConditionTrue(getStatus(t, c, "suite1").Conditions, ConditionPassed))
+	r.True(meta.IsStatusConditionFalse(getStatus(t, c, "suite2").Conditions, ConditionPassed))
+
+	// only the affected tests run again before the interval of their suite has elapsed
+	c.TriggerAffected(func(tests data.Tests) data.Tests {
+		if tests[0].Name == "test2" {
+			return tests
+		}
+		return nil
+	})
+	r.Equal("test2", <-ran)
+
+	cancel()
+	r.NoError(<-done)
+	r.Empty(ran)
+}
+
+func TestParseSuite(t *testing.T) {
+	tests := map[string]struct {
+		mutate  func(obj *unstructured.Unstructured)
+		wantErr string
+	}{
+		"valid suite": {
+			mutate: func(*unstructured.Unstructured) {},
+		},
+		"no tests": {
+			mutate: func(obj *unstructured.Unstructured) {
+				unstructured.RemoveNestedField(obj.Object, "spec", "tests")
+			},
+			wantErr: "spec.tests must contain at least one test",
+		},
+		"invalid interval": {
+			mutate: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, "often", "spec", "interval")
+			},
+			wantErr: `invalid spec.interval "often"`,
+		},
+		"interval too short": {
+			mutate: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, "10ms", "spec", "interval")
+			},
+			wantErr: "spec.interval must be at least 1s",
+		},
+		"duplicated test names": {
+			mutate: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedSlice(obj.Object,
+					[]interface{}{newTest("test1"), newTest("test1")}, "spec", "tests")
+			},
+			wantErr: "invalid spec.tests",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			obj := newSuite("suite", 1, newTest("test1"))
+			tt.mutate(obj)
+
+			suite, err := ParseSuite(obj)
+			if tt.wantErr != "" {
+				r.Error(err)
+				r.Contains(err.Error(), tt.wantErr)
+				return
+			}
+
+			r.NoError(err)
+			r.Len(suite.Tests, 1)
+			// the defaults of the test files apply to the suites
+			r.Equal(15, suite.Tests[0].TimeoutSeconds)
+			r.Equal(3, suite.Tests[0].Attempts)
+			r.Equal(443, suite.Tests[0].TargetPort)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+const (
+	// Group - API group of the netassert custom resources
+	Group = "netassert.controlplane.io"
+	// Version - API version of the netassert custom resources
+	Version = "v1alpha1"
+	// SuiteKind - kind of the NetAssertSuite custom resource
+	SuiteKind = "NetAssertSuite"
+)
+
+// SuiteGVR - group, version and resource of the NetAssertSuite custom resource
+var SuiteGVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "netassertsuites"}
+
+// condition types of a NetAssertSuite
+const (
+	// ConditionReady - the spec of the suite is valid and its tests have run
+	ConditionReady = "Ready"
+	// ConditionPassed - all the tests of the suite passed in the last run
+	ConditionPassed = "Passed"
+)
+
+// reasons of the conditions and the events of a NetAssertSuite
+const (
+	ReasonInvalidSpec    = "InvalidSpec"
+	ReasonRunCompleted   = "RunCompleted"
+	ReasonAllTestsPassed = "AllTestsPassed"
+	ReasonTestsFailed    = "TestsFailed"
+	ReasonTestFailed     = "TestFailed"
+	ReasonTestsPassed    = "TestsPassed"
+)
+
+// Suite - NetAssertSuite custom resource
+type Suite struct {
+	Object   *unstructured.Unstructured // the resource as returned by the API server
+	Interval time.Duration              // interval between two runs, zero when the default applies
+	Tests    data.Tests                 // tests of the suite
+	Status   Status                     // status of the suite
+}
+
+// Status - observed state of a NetAssertSuite
+type Status struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	LastRunTime        *metav1.Time       `json:"lastRunTime,omitempty"`
+	Summary            Summary            `json:"summary"`
+	Results            []*data.Result     `json:"results,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Summary - number of tests of a NetAssertSuite per outcome in the last run
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Todo    int `json:"todo"` // tests marked as todo that did not pass
+}
+
+// ParseSuite - parses and validates a NetAssertSuite, the status is returned even when the spec is invalid
+func ParseSuite(obj *unstructured.Unstructured) (*Suite, error) {
+	suite := &Suite{Object: obj}
+
+	if raw, ok := obj.Object["status"].(map[string]interface{}); ok {
+		// an unreadable status is replaced by the next run
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &suite.Status)
+	}
+
+	interval, _, err := unstructured.NestedString(obj.Object, "spec", "interval")
+	if err != nil {
+		return suite, fmt.Errorf("invalid spec.interval: %w", err)
+	}
+
+	if interval != "" {
+		suite.Interval, err = time.ParseDuration(interval)
+		if err != nil {
+			return suite, fmt.Errorf("invalid spec.interval %q: %w", interval, err)
+		}
+
+		if suite.Interval < time.Second {
+			return suite, fmt.Errorf("spec.interval must be at least 1s, got %s", interval)
+		}
+	}
+
+	rawTests, found, err := unstructured.NestedSlice(obj.Object, "spec", "tests")
+	if err != nil {
+		return suite, fmt.Errorf("invalid spec.tests: %w", err)
+	}
+
+	if !found || len(rawTests) == 0 {
+		return suite, fmt.Errorf("spec.tests must contain at least one test")
+	}
+
+	// the tests are decoded by the same code as the test files, so that they are validated
+	// and defaulted in the same way
+	buf, err := yaml.Marshal(rawTests)
+	if err != nil {
+		return suite, fmt.Errorf("unable to encode spec.tests: %w", err)
+	}
+
+	suite.Tests, err = data.NewFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return suite, fmt.Errorf("invalid spec.tests: %w", err)
+	}
+
+	return suite, nil
+}
+
+// statusFromTests - returns the status of a suite whose tests ran
+func statusFromTests(tests data.Tests) (Summary, []*data.Result) {
+	results := tests.Results().Tests
+	// the logs of the injected containers are too large to be stored in the resource
+	for _, res := range results {
+		dropLogs(res)
+	}
+
+	return summaryFromResults(results), results
+}
+
+// summaryFromResults - returns the summary of the results of the tests of a suite
+func summaryFromResults(results []*data.Result) Summary {
+	summary := Summary{Total: len(results)}
+
+	for _, res := range results {
+		switch {
+		case res.Status == data.StatusSkip:
+			summary.Skipped++
+		case res.Status == data.StatusPass:
+			summary.Passed++
+		case res.Todo == "":
+			summary.Failed++
+		default:
+			summary.Todo++
+		}
+	}
+
+	return summary
+}
+
+// mergeResults - returns the results of the last run of a suite in which the results of the tests that
+// ran since have been replaced, the results of the tests that are new to the suite are appended
+func mergeResults(last, ran []*data.Result) []*data.Result {
+	results := slices.Clone(last)
+	for _, res := range ran {
+		if i := slices.IndexFunc(results, func(r *data.Result) bool { return r.Name == res.Name }); i >= 0 {
+			results[i] = res
+		} else {
+			results = append(results, res)
+		}
+	}
+
+	return results
+}
+
+// dropLogs - removes the logs of the containers from a result and its subtests
+func dropLogs(res *data.Result) {
+	res.Logs = nil
+	for _, sub := range res.SubTests {
+		dropLogs(sub)
+	}
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"strings"
+)
+
+// ResultChange - change of a single test between two runs
+type ResultChange struct {
+	Name      string       `json:"name"`
+	OldStatus ResultStatus `json:"oldStatus,omitempty"`
+	NewStatus ResultStatus `json:"newStatus,omitempty"`
+	OldReason string       `json:"oldReason,omitempty"`
+	NewReason string       `json:"newReason,omitempty"`
+}
+
+// ResultsDiff - differences between the results of two runs
+type ResultsDiff struct {
+	NewlyFailing  []ResultChange `json:"newlyFailing"`
+	NewlyPassing  []ResultChange `json:"newlyPassing"`
+	Added         []ResultChange `json:"added"`
+	Removed       []ResultChange `json:"removed"`
+	ReasonChanged []ResultChange `json:"reasonChanged"`
+}
+
+// Empty - returns true when no differences were found
+func (d *ResultsDiff) Empty() bool {
+	return len(d.NewlyFailing) == 0 && len(d.NewlyPassing) == 0 && len(d.Added) == 0 &&
+		len(d.Removed) == 0 && len(d.ReasonChanged) == 0
+}
+
+// DiffResults - compares the results of two runs, tests are matched by name
+func DiffResults(oldResults, newResults *Results) *ResultsDiff {
+	diff := &ResultsDiff{}
+
+	oldByName := make(map[string]*Result, len(oldResults.Tests))
+	for _, res := range oldResults.Tests {
+		oldByName[res.Name] = res
+	}
+
+	newByName := make(map[string]*Result, len(newResults.Tests))
+	for _, res := range newResults.Tests {
+		newByName[res.Name] = res
+
+		oldRes, ok := oldByName[res.Name]
+		if !ok {
+			diff.Added = append(diff.Added, ResultChange{
+				Name:      res.Name,
+				NewStatus: res.Status,
+				NewReason: res.Reason,
+			})
+			continue
+		}
+
+		change := ResultChange{
+			Name:      res.Name,
+			OldStatus: oldRes.Status,
+			NewStatus: res.Status,
+			OldReason: oldRes.Reason,
+			NewReason: res.Reason,
+		}
+
+		switch {
+		case !oldRes.failing() && res.failing():
+			diff.NewlyFailing = append(diff.NewlyFailing, change)
+		case oldRes.failing() && res.Status == StatusPass:
+			diff.NewlyPassing = append(diff.NewlyPassing, change)
+		case oldRes.failing() && res.failing() && oldRes.normalizedReason() != res.normalizedReason():
+			diff.ReasonChanged = append(diff.ReasonChanged, change)
+		}
+	}
+
+	for _, res := range oldResults.Tests {
+		if _, ok := newByName[res.Name]; !ok {
+			diff.Removed = append(diff.Removed, ResultChange{
+				Name:      res.Name,
+				OldStatus: res.Status,
+				OldReason: res.Reason,
+			})
+		}
+	}
+
+	return diff
+}
+
+// failing - returns true when the test failed, the failures of tests marked as todo are ignored
+func (res *Result) failing() bool {
+	return res.Status == StatusFail && res.Todo == ""
+}
+
+// normalizedReason - returns the failure reason without the names that change from one run to the
+// other, such as the random names of the injected containers and the names of the resolved Pods
+func (res *Result) normalizedReason() string {
+	var replacements []string
+
+	if res.Containers != nil {
+		replacements = appendReplacement(replacements, res.Containers.Scanner, "<scanner>")
+		replacements = appendReplacement(replacements, res.Containers.Sniffer, "<sniffer>")
+	}
+
+	replacements = appendEndpointReplacements(replacements, "src", res.Src)
+	replacements = appendEndpointReplacements(replacements, "dst", res.Dst)
+
+	if len(replacements) == 0 {
+		return res.Reason
+	}
+
+	return strings.NewReplacer(replacements...).Replace(res.Reason)
+}
+
+// appendEndpointReplacements - appends the replacements of the resolved Pod and target of an endpoint
+func appendEndpointReplacements(replacements []string, placeholder string, ep *EndpointResult) []string {
+	if ep == nil {
+		return replacements
+	}
+
+	// the pods are stored as namespace/name
+	_, podName, _ := strings.Cut(ep.Pod, "/")
+	replacements = appendReplacement(replacements, podName, "<"+placeholder+"-pod>")
+
+	// the IP address of a resolved Pod changes when the Pod is recreated
+	if ep.Host == "" {
+		replacements = appendReplacement(replacements, ep.Target, "<"+placeholder+"-target>")
+	}
+
+	return replacements
+}
+
+// appendReplacement - appends the old, new pair to replacements when old is not empty
+func appendReplacement(replacements []string, old, new string) []string {
+	if old == "" {
+		return replacements
+	}
+
+	return append(replacements, old, new)
+}
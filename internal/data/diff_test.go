@@ -0,0 +1,63 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResults(t *testing.T) {
+	r := require.New(t)
+
+	oldResults := &Results{Version: ResultsVersion, Tests: []*Result{
+		{Name: "still-passing", Status: StatusPass},
+		{Name: "regressed", Status: StatusPass},
+		{Name: "fixed", Status: StatusFail, Reason: "timeout"},
+		{
+			Name:       "same-failure",
+			Status:     StatusFail,
+			Reason:     "ephemeral container scanner-abc in pod busybox-123 exit code is 1 instead of 0",
+			Containers: &ContainersResult{Scanner: "scanner-abc"},
+			Src:        &EndpointResult{Pod: "ns1/busybox-123"},
+		},
+		{Name: "other-failure", Status: StatusFail, Reason: "exit code is 1 instead of 0"},
+		{Name: "removed", Status: StatusPass},
+		{Name: "todo", Status: StatusPass},
+	}}
+
+	newResults := &Results{Version: ResultsVersion, Tests: []*Result{
+		{Name: "still-passing", Status: StatusPass},
+		{Name: "regressed", Status: StatusFail, Reason: "exit code is 1 instead of 0"},
+		{Name: "fixed", Status: StatusPass},
+		{
+			Name:       "same-failure",
+			Status:     StatusFail,
+			Reason:     "ephemeral container scanner-def in pod busybox-456 exit code is 1 instead of 0",
+			Containers: &ContainersResult{Scanner: "scanner-def"},
+			Src:        &EndpointResult{Pod: "ns1/busybox-456"},
+		},
+		{Name: "other-failure", Status: StatusFail, Reason: "failed to get exit code"},
+		{Name: "added", Status: StatusFail, Reason: "timeout"},
+		{Name: "todo", Status: StatusFail, Todo: "not ready"},
+	}}
+
+	diff := DiffResults(oldResults, newResults)
+	r.False(diff.Empty())
+	r.Equal([]ResultChange{{
+		Name: "regressed", OldStatus: StatusPass, NewStatus: StatusFail, NewReason: "exit code is 1 instead of 0",
+	}}, diff.NewlyFailing)
+	r.Equal([]ResultChange{{
+		Name: "fixed", OldStatus: StatusFail, NewStatus: StatusPass, OldReason: "timeout",
+	}}, diff.NewlyPassing)
+	r.Equal([]ResultChange{{Name: "added", NewStatus: StatusFail, NewReason: "timeout"}}, diff.Added)
+	r.Equal([]ResultChange{{Name: "removed", OldStatus: StatusPass}}, diff.Removed)
+	r.Equal([]ResultChange{{
+		Name:      "other-failure",
+		OldStatus: StatusFail,
+		NewStatus: StatusFail,
+		OldReason: "exit code is 1 instead of 0",
+		NewReason: "failed to get exit code",
+	}}, diff.ReasonChanged)
+
+	r.True(DiffResults(oldResults, oldResults).Empty())
+}
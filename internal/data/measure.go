@@ -0,0 +1,172 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTransferBytes - number of bytes sent to the destination to measure the throughput by default
+	DefaultTransferBytes = 1 << 20
+	// MaxTransferBytes - maximum number of bytes sent to the destination to measure the throughput
+	MaxTransferBytes = 1 << 30
+)
+
+// throughputRegexp - matches a bit rate such as 500Kbps, 10Mbps or 1.5Gbps
+var throughputRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([kKMG]?)bps$`)
+
+// throughputUnits - multipliers of the units of the bit rates, from the largest to the smallest
+var throughputUnits = []struct {
+	prefix     string
+	multiplier float64
+}{
+	{"G", 1e9},
+	{"M", 1e6},
+	{"K", 1e3},
+	{"", 1},
+}
+
+// Measurements holds the timings reported by the scanner of a test with thresholds
+type Measurements struct {
+	ConnectLatency   time.Duration // time taken to establish the connection
+	TransferredBytes int64         // bytes sent to the destination, 0 when the throughput was not measured
+	TransferDuration time.Duration // time taken to send the bytes to the destination
+}
+
+// Throughput - returns the throughput of the transfer in bits per second, 0 when it was not measured
+func (m *Measurements) Throughput() float64 {
+	if m.TransferredBytes <= 0 || m.TransferDuration <= 0 {
+		return 0
+	}
+
+	return float64(m.TransferredBytes*8) / m.TransferDuration.Seconds()
+}
+
+// ParseThroughput - parses a bit rate such as 500Kbps, 10Mbps or 1.5Gbps into bits per second
+func ParseThroughput(s string) (float64, error) {
+	matches := throughputRegexp.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid throughput %q, must be a number of bps, Kbps, Mbps or Gbps", s)
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid throughput %q: %w", s, err)
+	}
+
+	if value <= 0 {
+		return 0, fmt.Errorf("invalid throughput %q, must be greater than 0", s)
+	}
+
+	for _, unit := range throughputUnits {
+		if unit.prefix == strings.ToUpper(matches[2]) {
+			return value * unit.multiplier, nil
+		}
+	}
+
+	return value, nil
+}
+
+// FormatThroughput - formats a number of bits per second with the largest unit it is not smaller than,
+// rounded to two decimals
+func FormatThroughput(bps float64) string {
+	for _, unit := range throughputUnits {
+		if bps >= unit.multiplier || unit.prefix == "" {
+			value := math.Round(bps/unit.multiplier*100) / 100
+			return strconv.FormatFloat(value, 'f', -1, 64) + unit.prefix + "bps"
+		}
+	}
+
+	return ""
+}
+
+// Measured - returns true when the connection of the test is measured by the scanner
+func (te *Test) Measured() bool {
+	return te.MaxConnectLatency != "" || te.MinThroughput != ""
+}
+
+// TransferSize - returns the number of bytes sent to the destination to measure the throughput, and 0
+// when the test has no minThroughput
+func (te *Test) TransferSize() int {
+	switch {
+	case te.MinThroughput == "":
+		return 0
+	case te.TransferBytes > 0:
+		return te.TransferBytes
+	default:
+		return DefaultTransferBytes
+	}
+}
+
+// CheckMeasurements - returns an error if the measurements reported by the scanner exceed the thresholds
+// of the test
+func (te *Test) CheckMeasurements(m *Measurements) error {
+	if m == nil {
+		return fmt.Errorf("the scanner did not report the measurements of the connection")
+	}
+
+	var latencyErr error
+	if maxLatency, err := time.ParseDuration(te.MaxConnectLatency); err == nil && m.ConnectLatency > maxLatency {
+		latencyErr = fmt.Errorf("connect latency of %v is more than %v", m.ConnectLatency, maxLatency)
+	}
+
+	var throughputErr error
+	if te.MinThroughput != "" {
+		minThroughput, err := ParseThroughput(te.MinThroughput)
+		switch {
+		case err != nil:
+			throughputErr = err
+		case m.TransferredBytes == 0:
+			throughputErr = fmt.Errorf("the scanner did not report the throughput of the connection")
+		case m.Throughput() < minThroughput:
+			throughputErr = fmt.Errorf("throughput of %s is less than %s",
+				FormatThroughput(m.Throughput()), FormatThroughput(minThroughput))
+		}
+	}
+
+	return errors.Join(latencyErr, throughputErr)
+}
+
+// validateThresholds - validates the latency and throughput thresholds, which are measured by the
+// scanner of the TCP tests once the connection is established
+func (te *Test) validateThresholds() error {
+	var latencyErr error
+	if te.MaxConnectLatency != "" {
+		if latency, err := time.ParseDuration(te.MaxConnectLatency); err != nil || latency <= 0 {
+			latencyErr = fmt.Errorf("invalid maxConnectLatency %q, must be a positive duration such as 100ms",
+				te.MaxConnectLatency)
+		}
+	}
+
+	var throughputErr error
+	if te.MinThroughput != "" {
+		_, throughputErr = ParseThroughput(te.MinThroughput)
+	}
+
+	var transferErr error
+	switch {
+	case te.TransferBytes != 0 && te.MinThroughput == "":
+		transferErr = fmt.Errorf("transferBytes is only supported together with minThroughput")
+	case te.TransferBytes < 0 || te.TransferBytes > MaxTransferBytes:
+		transferErr = fmt.Errorf("transferBytes out of range: %d, must be between 1 and %d",
+			te.TransferBytes, MaxTransferBytes)
+	}
+
+	var notSupportedErr error
+	if te.Measured() && te.Protocol != ProtocolTCP {
+		notSupportedErr = fmt.Errorf("latency and throughput thresholds are only supported by tcp tests")
+	}
+
+	var exitCodeErr error
+	if te.Measured() && te.ExitCode != 0 {
+		exitCodeErr = fmt.Errorf("latency and throughput thresholds need an exitCode of 0, " +
+			"as the connection must be established to be measured")
+	}
+
+	return errors.Join(latencyErr, throughputErr, transferErr, notSupportedErr, exitCodeErr)
+}
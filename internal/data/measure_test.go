@@ -0,0 +1,65 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThroughput(t *testing.T) {
+	r := require.New(t)
+
+	tests := map[string]float64{
+		"800bps":  800,
+		"500Kbps": 500e3,
+		"500kbps": 500e3,
+		"10Mbps":  10e6,
+		"1.5Gbps": 1.5e9,
+	}
+	for s, want := range tests {
+		got, err := ParseThroughput(s)
+		r.NoError(err, s)
+		r.InDelta(want, got, 1e-6, s)
+	}
+
+	for _, s := range []string{"", "10", "10MB/s", "0Mbps", "-1Mbps", "1Tbps"} {
+		_, err := ParseThroughput(s)
+		r.Error(err, s)
+	}
+
+	r.Equal("85.25Mbps", FormatThroughput(85.2467e6))
+	r.Equal("1.5Gbps", FormatThroughput(1.5e9))
+	r.Equal("0bps", FormatThroughput(0))
+}
+
+func TestTest_CheckMeasurements(t *testing.T) {
+	r := require.New(t)
+
+	te := &Test{Name: "web-to-api", MaxConnectLatency: "50ms", MinThroughput: "100Mbps"}
+	r.Equal(DefaultTransferBytes, te.TransferSize())
+
+	// 1MiB in 10ms is about 839Mbps
+	fast := &Measurements{ConnectLatency: 5 * time.Millisecond, TransferredBytes: 1 << 20,
+		TransferDuration: 10 * time.Millisecond}
+	r.NoError(te.CheckMeasurements(fast))
+
+	slow := &Measurements{ConnectLatency: 80 * time.Millisecond, TransferredBytes: 1 << 20,
+		TransferDuration: time.Second}
+	err := te.CheckMeasurements(slow)
+	r.ErrorContains(err, "connect latency of 80ms is more than 50ms")
+	r.ErrorContains(err, "throughput of 8.39Mbps is less than 100Mbps")
+
+	r.ErrorContains(te.CheckMeasurements(&Measurements{ConnectLatency: time.Millisecond}),
+		"the scanner did not report the throughput of the connection")
+	r.ErrorContains(te.CheckMeasurements(nil), "the scanner did not report the measurements")
+
+	te.Observation = &Observation{Measurements: slow}
+	r.Equal(&MeasurementsResult{
+		ConnectLatency:    "80ms",
+		MaxConnectLatency: "50ms",
+		Throughput:        "8.39Mbps",
+		MinThroughput:     "100Mbps",
+		TransferredBytes:  1 << 20,
+	}, te.Result().Measurements)
+}
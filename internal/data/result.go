@@ -0,0 +1,278 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ResultsVersion - version of the structured results format
+const ResultsVersion = "netassert/v1"
+
+// ResultStatus - represents the outcome of a test
+type ResultStatus string
+
+const (
+	// StatusPass - the test passed
+	StatusPass ResultStatus = "pass"
+
+	// StatusFail - the test failed
+	StatusFail ResultStatus = "fail"
+
+	// StatusSkip - the test was skipped
+	StatusSkip ResultStatus = "skip"
+
+	// StatusNotRun - the test did not run because the run was aborted
+	StatusNotRun ResultStatus = "notrun"
+)
+
+// Results - structured results of a netassert run
+type Results struct {
+	Version string    `json:"version"`
+	Tests   []*Result `json:"tests"`
+}
+
+// Result - structured result of a single test
+type Result struct {
+	Name         string              `json:"name"`
+	Status       ResultStatus        `json:"status"`
+	Reason       string              `json:"reason,omitempty"`
+	Flaky        bool                `json:"flaky,omitempty"`
+	Runs         int                 `json:"runs,omitempty"`
+	Skip         string              `json:"skip,omitempty"`
+	Todo         string              `json:"todo,omitempty"`
+	Protocol     Protocol            `json:"protocol,omitempty"`
+	Port         int                 `json:"port,omitempty"`
+	IPFamily     IPFamily            `json:"ipFamily,omitempty"`
+	Direction    Direction           `json:"direction,omitempty"`
+	Src          *EndpointResult     `json:"src,omitempty"`
+	Dst          *EndpointResult     `json:"dst,omitempty"`
+	ExitCode     *ExitCodeResult     `json:"exitCode,omitempty"`
+	Expect       Expect              `json:"expect,omitempty"`
+	Outcome      Outcome             `json:"outcome,omitempty"`
+	Source       *SourceResult       `json:"source,omitempty"`
+	Measurements *MeasurementsResult `json:"measurements,omitempty"`
+	Containers   *ContainersResult   `json:"containers,omitempty"`
+	DurationMS   int64               `json:"durationMs,omitempty"`
+	Logs         []ContainerLog      `json:"logs,omitempty"`
+	SubTests     []*Result           `json:"subTests,omitempty"`
+}
+
+// EndpointResult - source or destination of a test together with what it resolved to
+type EndpointResult struct {
+	Kind      K8sResourceKind `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Name      string          `json:"name,omitempty" yaml:"name,omitempty"`
+	Namespace string          `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Container string          `json:"container,omitempty" yaml:"container,omitempty"`
+	Selector  string          `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Host      string          `json:"host,omitempty" yaml:"host,omitempty"`
+	Hosts     string          `json:"hosts,omitempty" yaml:"hosts,omitempty"` // comma separated names of the dst hosts
+	CIDR      string          `json:"cidr,omitempty" yaml:"cidr,omitempty"`
+	Pod       string          `json:"pod,omitempty" yaml:"pod,omitempty"`
+	Node      string          `json:"node,omitempty" yaml:"node,omitempty"`
+	Target    string          `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// ExitCodeResult - expected and observed exit codes of a test
+type ExitCodeResult struct {
+	Expected int `json:"expected" yaml:"expected"`
+	Observed int `json:"observed" yaml:"observed"`
+}
+
+// SourceResult - expected and observed source addresses of the packets received by the destination
+type SourceResult struct {
+	Expected string   `json:"expected" yaml:"expected"`
+	Observed []string `json:"observed,omitempty" yaml:"observed,omitempty"`
+}
+
+// MeasurementsResult - thresholds of a test together with the measurements reported by its scanner
+type MeasurementsResult struct {
+	ConnectLatency    string `json:"connectLatency,omitempty" yaml:"connectLatency,omitempty"`
+	MaxConnectLatency string `json:"maxConnectLatency,omitempty" yaml:"maxConnectLatency,omitempty"`
+	Throughput        string `json:"throughput,omitempty" yaml:"throughput,omitempty"`
+	MinThroughput     string `json:"minThroughput,omitempty" yaml:"minThroughput,omitempty"`
+	TransferredBytes  int64  `json:"transferredBytes,omitempty" yaml:"transferredBytes,omitempty"`
+}
+
+// ContainersResult - names of the containers injected by a test
+type ContainersResult struct {
+	Scanner string `json:"scanner,omitempty" yaml:"scanner,omitempty"`
+	Sniffer string `json:"sniffer,omitempty" yaml:"sniffer,omitempty"`
+}
+
+// Results - returns the structured results of the tests
+func (ts Tests) Results() *Results {
+	results := &Results{Version: ResultsVersion, Tests: make([]*Result, 0, len(ts))}
+	for _, te := range ts {
+		results.Tests = append(results.Tests, te.Result())
+	}
+
+	return results
+}
+
+// Result - returns the structured result of the test
+func (te *Test) Result() *Result {
+	res := &Result{
+		Name:      te.Name,
+		Status:    te.status(),
+		Skip:      te.Skip,
+		Todo:      te.Todo,
+		Protocol:  te.Protocol,
+		Port:      te.TargetPort,
+		IPFamily:  te.IPFamily,
+		Direction: te.Direction,
+		Logs:      te.ContainerLogs,
+	}
+
+	if !te.Pass {
+		res.Reason = te.FailureReason
+	}
+
+	obs := te.Observation
+	if obs == nil {
+		obs = &Observation{}
+	}
+
+	if te.Src != nil {
+		res.Src = newEndpointResult(te.Src.K8sResource, nil, obs.SrcPod, obs.SrcNode, "")
+	}
+
+	if te.Dst != nil {
+		res.Dst = newEndpointResult(te.Dst.K8sResource, te.Dst.Host, obs.DstPod, obs.DstNode, obs.TargetHost)
+	}
+
+	// the targets of a set of hosts are in the results of the sub-tests
+	if te.Dst != nil && te.Dst.Hosts != nil {
+		res.Dst = &EndpointResult{Hosts: strings.Join(te.Dst.Hosts.Names, ","), CIDR: te.Dst.Hosts.CIDR}
+	}
+
+	if obs.ExitCode != nil {
+		res.ExitCode = &ExitCodeResult{Expected: te.ExitCode, Observed: *obs.ExitCode}
+	}
+
+	res.Flaky = te.Flaky()
+	if obs.Runs > 1 {
+		res.Runs = obs.Runs
+	}
+
+	res.Expect = te.Expect
+	res.Outcome = obs.Outcome
+
+	if expected, ok := te.ExpectedSource(); ok {
+		res.Source = &SourceResult{Expected: expected.String(), Observed: obs.SourceIPs}
+	}
+
+	if te.Measured() {
+		res.Measurements = &MeasurementsResult{MaxConnectLatency: te.MaxConnectLatency, MinThroughput: te.MinThroughput}
+		if m := obs.Measurements; m != nil {
+			res.Measurements.ConnectLatency = m.ConnectLatency.String()
+			res.Measurements.TransferredBytes = m.TransferredBytes
+			if m.TransferredBytes > 0 {
+				res.Measurements.Throughput = FormatThroughput(m.Throughput())
+			}
+		}
+	}
+
+	if obs.ScannerContainer != "" || obs.SnifferContainer != "" {
+		res.Containers = &ContainersResult{Scanner: obs.ScannerContainer, Sniffer: obs.SnifferContainer}
+	}
+
+	res.DurationMS = obs.Duration.Milliseconds()
+
+	for _, sub := range te.SubTests {
+		res.SubTests = append(res.SubTests, sub.Result())
+	}
+
+	return res
+}
+
+// status - returns the outcome of the test
+func (te *Test) status() ResultStatus {
+	switch {
+	case te.Pass:
+		return StatusPass
+	case te.Skipped():
+		return StatusSkip
+	case te.ran():
+		return StatusFail
+	default:
+		return StatusNotRun
+	}
+}
+
+// newEndpointResult - returns the result of a source or destination, nil if there is nothing to show
+func newEndpointResult(res *K8sResource, host *Host, pod, node, target string) *EndpointResult {
+	ep := &EndpointResult{Pod: pod, Node: node, Target: target}
+
+	if res != nil {
+		ep.Kind = res.Kind
+		ep.Name = res.Name
+		ep.Namespace = res.Namespace
+		ep.Container = res.Container
+		ep.Selector = res.SelectorString()
+	}
+
+	if host != nil {
+		ep.Host = host.Name
+	}
+
+	if *ep == (EndpointResult{}) {
+		return nil
+	}
+
+	return ep
+}
+
+// JSONResult - outputs result of tests into the structured JSON format
+func (ts *Tests) JSONResult(w io.Writer) error {
+	if ts == nil {
+		return fmt.Errorf("empty ts")
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(ts.Results())
+}
+
+// ReadResults - reads results written by JSONResult or TAPResult, the format is detected from the content
+func ReadResults(r io.Reader) (*Results, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read results: %w", err)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(buf), []byte("{")) {
+		return ParseTAP(bytes.NewReader(buf))
+	}
+
+	var results Results
+	if err := json.Unmarshal(buf, &results); err != nil {
+		return nil, fmt.Errorf("unable to decode JSON results: %w", err)
+	}
+
+	if results.Version != ResultsVersion {
+		return nil, fmt.Errorf("unsupported results version %q, expected %q", results.Version, ResultsVersion)
+	}
+
+	return &results, nil
+}
+
+// ReadResultsFromFile - reads results from a JSON or TAP file
+func ReadResultsFromFile(fileName string) (*Results, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open results file %q: %w", fileName, err)
+	}
+	defer fp.Close()
+
+	results, err := ReadResults(fp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read results file %q: %w", fileName, err)
+	}
+
+	return results, nil
+}
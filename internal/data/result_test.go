@@ -0,0 +1,162 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sampleResultTests - returns tests in all the possible states
+func sampleResultTests() Tests {
+	return Tests{
+		&Test{
+			Name:       "pod2pod",
+			Protocol:   ProtocolTCP,
+			TargetPort: 8080,
+			Src:        &Src{K8sResource: &K8sResource{Kind: KindDeployment, Name: "busybox", Namespace: "ns1"}},
+			Dst:        &Dst{K8sResource: &K8sResource{Kind: KindPod, Name: "echoserver", Namespace: "ns2"}},
+			Pass:       true,
+			Observation: &Observation{
+				SrcPod:           "ns1/busybox-abc",
+				DstPod:           "ns2/echoserver",
+				TargetHost:       "10.0.0.2",
+				ExitCode:         ptr(0),
+				ScannerContainer: "scanner-abc",
+				Duration:         2 * time.Second,
+			},
+		},
+		&Test{
+			Name:          "pod2host #2",
+			Protocol:      ProtocolTCP,
+			TargetPort:    443,
+			Dst:           &Dst{Host: &Host{Name: "1.1.1.1"}},
+			FailureReason: "ephemeral container scanner-def exit code for test pod2host is 1 instead of 0",
+			Todo:          "egress is not allowed yet",
+			Observation:   &Observation{TargetHost: "1.1.1.1", ExitCode: ptr(1), ScannerContainer: "scanner-def"},
+		},
+		&Test{Name: "skipped", Skip: "not deployed"},
+		&Test{Name: "not run"},
+	}
+}
+
+func TestTests_Results(t *testing.T) {
+	r := require.New(t)
+
+	results := sampleResultTests().Results()
+	r.Equal(ResultsVersion, results.Version)
+	r.Len(results.Tests, 4)
+
+	r.Equal(StatusPass, results.Tests[0].Status)
+	r.Equal(&EndpointResult{Kind: KindPod, Name: "echoserver", Namespace: "ns2", Pod: "ns2/echoserver", Target: "10.0.0.2"},
+		results.Tests[0].Dst)
+	r.Equal(&ExitCodeResult{Expected: 0, Observed: 0}, results.Tests[0].ExitCode)
+	r.Equal(int64(2000), results.Tests[0].DurationMS)
+
+	r.Equal(StatusFail, results.Tests[1].Status)
+	r.Equal("egress is not allowed yet", results.Tests[1].Todo)
+	r.Equal(StatusSkip, results.Tests[2].Status)
+	r.Equal(StatusNotRun, results.Tests[3].Status)
+}
+
+func TestTest_Result_Nodes(t *testing.T) {
+	r := require.New(t)
+
+	te := &Test{
+		Name:       "node2node",
+		Protocol:   ProtocolTCP,
+		TargetPort: 10250,
+		Src: &Src{K8sResource: &K8sResource{Kind: KindNode, Namespace: "netassert",
+			Selector: map[string]string{"pool": "web", "node-role.kubernetes.io/worker": ""}}},
+		Dst:         &Dst{K8sResource: &K8sResource{Kind: KindNode, Name: "control-plane"}},
+		Observation: &Observation{SrcNode: "worker-1", DstNode: "control-plane", TargetHost: "192.168.0.10"},
+	}
+
+	res := te.Result()
+	r.Equal(&EndpointResult{Kind: KindNode, Namespace: "netassert", Selector: "node-role.kubernetes.io/worker=,pool=web",
+		Node: "worker-1"}, res.Src)
+	r.Equal(&EndpointResult{Kind: KindNode, Name: "control-plane", Node: "control-plane", Target: "192.168.0.10"},
+		res.Dst)
+}
+
+func TestTest_Result_Source(t *testing.T) {
+	r := require.New(t)
+
+	te := &Test{
+		Name:             "egress-gateway",
+		ExpectedSourceIP: "10.10.0.5",
+		Observation:      &Observation{SourceIPs: []string{"10.10.0.6"}},
+	}
+
+	r.Equal(&SourceResult{Expected: "10.10.0.5/32", Observed: []string{"10.10.0.6"}}, te.Result().Source)
+
+	te.ExpectedSourceIP = ""
+	r.Nil(te.Result().Source)
+}
+
+func TestReadResults(t *testing.T) {
+	tests := sampleResultTests()
+
+	t.Run("json", func(t *testing.T) {
+		r := require.New(t)
+		w := &bytes.Buffer{}
+		r.NoError(tests.JSONResult(w))
+
+		got, err := ReadResults(w)
+		r.NoError(err)
+		r.Equal(tests.Results(), got)
+	})
+
+	t.Run("tap", func(t *testing.T) {
+		r := require.New(t)
+		w := &bytes.Buffer{}
+		r.NoError(tests.TAPResult(w))
+
+		got, err := ReadResults(w)
+		r.NoError(err)
+
+		// tests that did not run are reported as failed in TAP
+		want := tests.Results()
+		want.Tests[3].Status = StatusFail
+		r.Equal(want, got)
+	})
+
+	t.Run("tap with subtests and bail out", func(t *testing.T) {
+		r := require.New(t)
+		got, err := ReadResults(strings.NewReader(`TAP version 14
+1..3
+    # Subtest: fan out
+    1..1
+    not ok 1 - port 80
+      ---
+      reason: timeout
+      ...
+ok 1 - fan out
+not ok 2 - failed
+  ---
+  reason: exit code 1 instead of 0
+  ...
+Bail out! received signal from OS: context canceled
+`))
+		r.NoError(err)
+		r.Equal(&Results{Version: ResultsVersion, Tests: []*Result{
+			{Name: "fan out", Status: StatusPass},
+			{Name: "failed", Status: StatusFail, Reason: "exit code 1 instead of 0"},
+		}}, got)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		r := require.New(t)
+		_, err := ReadResults(strings.NewReader(`{"version": "netassert/v0", "tests": []}`))
+		r.Error(err)
+		r.Contains(err.Error(), "unsupported results version")
+	})
+
+	t.Run("not a results file", func(t *testing.T) {
+		r := require.New(t)
+		_, err := ReadResults(strings.NewReader("- name: test\n"))
+		r.Error(err)
+	})
+}
@@ -1,14 +1,56 @@
 package data
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	// tapSubtestIndent - indentation of the lines of a TAP 14 subtest
+	tapSubtestIndent = "    "
+	// tapDiagnosticsIndent - indentation of a YAML diagnostics block relative to its test point
+	tapDiagnosticsIndent = "  "
+)
+
+// tapDiagnostics - YAML diagnostics block of a test
+type tapDiagnostics struct {
+	Reason       *string             `yaml:"reason,omitempty"`
+	Flaky        bool                `yaml:"flaky,omitempty"`
+	Runs         int                 `yaml:"runs,omitempty"`
+	Protocol     Protocol            `yaml:"protocol,omitempty"`
+	Port         int                 `yaml:"port,omitempty"`
+	IPFamily     IPFamily            `yaml:"ipFamily,omitempty"`
+	Direction    Direction           `yaml:"direction,omitempty"`
+	Src          *EndpointResult     `yaml:"src,omitempty"`
+	Dst          *EndpointResult     `yaml:"dst,omitempty"`
+	ExitCode     *ExitCodeResult     `yaml:"exitCode,omitempty"`
+	Expect       Expect              `yaml:"expect,omitempty"`
+	Outcome      Outcome             `yaml:"outcome,omitempty"`
+	Source       *SourceResult       `yaml:"source,omitempty"`
+	Measurements *MeasurementsResult `yaml:"measurements,omitempty"`
+	Containers   *ContainersResult   `yaml:"containers,omitempty"`
+	DurationMS   int64               `yaml:"duration_ms,omitempty"`
+	Logs         []ContainerLog      `yaml:"logs,omitempty"`
+}
+
 // TAPResult - outputs result of tests into a TAP format
 func (ts *Tests) TAPResult(w io.Writer) error {
+	return ts.tapResult(w, "")
+}
+
+// TAPBailOut - outputs result of the tests that ran into a TAP format, followed by a
+// "Bail out!" line with the reason the run was aborted
+func (ts *Tests) TAPBailOut(w io.Writer, reason string) error {
+	return ts.tapResult(w, "Bail out! "+reason)
+}
+
+// tapResult - outputs the TAP document, the tests that did not run are omitted when bailOut is set
+func (ts *Tests) tapResult(w io.Writer, bailOut string) error {
 	if ts == nil {
 		return fmt.Errorf("empty ts")
 	}
@@ -17,31 +59,293 @@ func (ts *Tests) TAPResult(w io.Writer) error {
 		return fmt.Errorf("no test were found")
 	}
 
-	header := "TAP version 14\n"
-	header += fmt.Sprintf("1..%v\n", len(*ts))
-	_, err := fmt.Fprint(w, header)
-	if err != nil {
+	if _, err := fmt.Fprint(w, "TAP version 14\n"); err != nil {
 		return err
 	}
 
-	for index, test := range *ts {
-		result := ""
-		switch test.Pass {
-		case true:
-			result = fmt.Sprintf("ok %v - %v", index+1, test.Name)
-		case false:
-			frEscaped, err := yaml.Marshal(&test.FailureReason) // frEscaped ends with "\n"
-			if err != nil {
+	tests := *ts
+	if bailOut != "" {
+		// the tests run in order, so the ones that did not run are at the end of the list
+		for i, test := range tests {
+			if !test.ran() {
+				tests = tests[:i]
+				break
+			}
+		}
+	}
+
+	if err := writeTAPTests(w, tests, "", len(*ts)); err != nil {
+		return err
+	}
+
+	if bailOut != "" {
+		if _, err := fmt.Fprintln(w, bailOut); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTAPTests - writes the plan and the test points of tests, the subtests are
+// written before the test point of their parent
+func writeTAPTests(w io.Writer, tests Tests, indent string, plan int) error {
+	if _, err := fmt.Fprintf(w, "%s1..%d\n", indent, plan); err != nil {
+		return err
+	}
+
+	for index, test := range tests {
+		if len(test.SubTests) > 0 {
+			subIndent := indent + tapSubtestIndent
+			if _, err := fmt.Fprintf(w, "%s# Subtest: %s\n", subIndent, tapEscape(test.Name)); err != nil {
+				return err
+			}
+
+			if err := writeTAPTests(w, test.SubTests, subIndent, len(test.SubTests)); err != nil {
 				return err
 			}
-			result = fmt.Sprintf("not ok %v - %v", index+1, test.Name)
-			result += fmt.Sprintf("\n  ---\n  reason: %s  ...", frEscaped)
 		}
 
-		if _, err := fmt.Fprintln(w, result); err != nil {
+		if _, err := fmt.Fprintln(w, indent+tapTestPoint(index+1, test)); err != nil {
 			return err
 		}
+
+		diagnostics, err := test.tapDiagnostics()
+		if err != nil {
+			return err
+		}
+
+		if diagnostics != "" {
+			block := "---\n" + diagnostics + "...\n"
+			if _, err := fmt.Fprint(w, indentLines(block, indent+tapDiagnosticsIndent)); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
+
+// tapTestPoint - returns the test point line of a test, including its directive
+func tapTestPoint(number int, test *Test) string {
+	status := "not ok"
+	if test.Pass || test.Skipped() {
+		status = "ok"
+	}
+
+	line := fmt.Sprintf("%s %v - %v", status, number, tapEscape(test.Name))
+
+	switch {
+	case test.Skipped():
+		line += " # SKIP " + tapEscape(test.Skip)
+	case test.Todo != "":
+		line += " # TODO " + tapEscape(test.Todo)
+	}
+
+	return line
+}
+
+// tapDiagnostics - returns the YAML diagnostics of a test, or an empty string when there are none.
+// Failed tests always have a diagnostics block, passed ones only when they were observed
+func (te *Test) tapDiagnostics() (string, error) {
+	if te.Skipped() || (te.Pass && te.Observation == nil) {
+		return "", nil
+	}
+
+	res := te.Result()
+	diag := tapDiagnostics{
+		Protocol:     res.Protocol,
+		Port:         res.Port,
+		IPFamily:     res.IPFamily,
+		Direction:    res.Direction,
+		Src:          res.Src,
+		Dst:          res.Dst,
+		ExitCode:     res.ExitCode,
+		Flaky:        res.Flaky,
+		Runs:         res.Runs,
+		Expect:       res.Expect,
+		Outcome:      res.Outcome,
+		Source:       res.Source,
+		Measurements: res.Measurements,
+		Containers:   res.Containers,
+		DurationMS:   res.DurationMS,
+		Logs:         res.Logs,
+	}
+
+	if !te.Pass {
+		diag.Reason = &res.Reason
+	}
+
+	out, err := yaml.Marshal(&diag) // out ends with "\n"
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// tapEscape - escapes the characters that have a special meaning in a test point description
+func tapEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "#", `\#`).Replace(s)
+}
+
+// indentLines - prefixes every non empty line of s with indent
+func indentLines(s, indent string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" && line != "\n" {
+			lines[i] = indent + line
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+// tapTestPointRegex - matches a top level TAP test point e.g. "not ok 2 - name # TODO reason"
+var tapTestPointRegex = regexp.MustCompile(`^(not ok|ok)\b\s*(?:\d+)?\s*(?:-\s*)?(.*)$`)
+
+// tapDirectiveRegex - matches the SKIP and TODO directives of a test point
+var tapDirectiveRegex = regexp.MustCompile(`(?i)^(SKIP|TODO)\S*\s*(.*)$`)
+
+// ParseTAP - reads the results of the top level tests from a TAP document, the subtests are ignored
+func ParseTAP(r io.Reader) (*Results, error) {
+	results := &Results{Version: ResultsVersion}
+
+	var (
+		current  *Result // the last test point that was read
+		inYAML   bool    // true when reading the diagnostics block of current
+		yamlDoc  strings.Builder
+		lineNo   int
+		foundTAP bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if inYAML {
+			if line == tapDiagnosticsIndent+"..." {
+				inYAML = false
+				if err := current.applyTAPDiagnostics(yamlDoc.String()); err != nil {
+					return nil, fmt.Errorf("invalid YAML diagnostics of test %q at line %d: %w", current.Name, lineNo, err)
+				}
+				yamlDoc.Reset()
+				continue
+			}
+
+			yamlDoc.WriteString(strings.TrimPrefix(line, tapDiagnosticsIndent) + "\n")
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "TAP version "):
+			foundTAP = true
+		case current != nil && line == tapDiagnosticsIndent+"---":
+			inYAML = true
+		case strings.HasPrefix(line, "Bail out!"):
+			return results, nil
+		case strings.HasPrefix(line, "ok") || strings.HasPrefix(line, "not ok"):
+			m := tapTestPointRegex.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			foundTAP = true
+			current = newTAPResult(m[1] == "ok", m[2])
+			results.Tests = append(results.Tests, current)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read TAP document: %w", err)
+	}
+
+	if !foundTAP {
+		return nil, fmt.Errorf("no TAP version line or test points were found")
+	}
+
+	if inYAML {
+		return nil, fmt.Errorf("unterminated YAML diagnostics block of test %q", current.Name)
+	}
+
+	return results, nil
+}
+
+// newTAPResult - returns the result of a test point from its status and description
+func newTAPResult(ok bool, description string) *Result {
+	res := &Result{Status: StatusFail}
+	if ok {
+		res.Status = StatusPass
+	}
+
+	name, directive := splitTAPDirective(description)
+	res.Name = tapUnescape(strings.TrimSpace(name))
+
+	if m := tapDirectiveRegex.FindStringSubmatch(directive); m != nil {
+		reason := tapUnescape(strings.TrimSpace(m[2]))
+		switch strings.ToUpper(m[1]) {
+		case "SKIP":
+			res.Status = StatusSkip
+			res.Skip = reason
+		case "TODO":
+			res.Todo = reason
+		}
+	}
+
+	return res
+}
+
+// splitTAPDirective - splits a test point description on the first unescaped "#"
+func splitTAPDirective(description string) (string, string) {
+	escaped := false
+	for i, c := range description {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '#':
+			return description[:i], strings.TrimSpace(description[i+1:])
+		}
+	}
+
+	return description, ""
+}
+
+// applyTAPDiagnostics - sets the fields of the result from a YAML diagnostics block
+func (res *Result) applyTAPDiagnostics(doc string) error {
+	var diag tapDiagnostics
+	if err := yaml.Unmarshal([]byte(doc), &diag); err != nil {
+		return err
+	}
+
+	if diag.Reason != nil {
+		res.Reason = *diag.Reason
+	}
+
+	res.Protocol = diag.Protocol
+	res.Port = diag.Port
+	res.IPFamily = diag.IPFamily
+	res.Direction = diag.Direction
+	res.Src = diag.Src
+	res.Dst = diag.Dst
+	res.ExitCode = diag.ExitCode
+	res.Flaky = diag.Flaky
+	res.Runs = diag.Runs
+	res.Expect = diag.Expect
+	res.Outcome = diag.Outcome
+	res.Source = diag.Source
+	res.Measurements = diag.Measurements
+	res.Containers = diag.Containers
+	res.DurationMS = diag.DurationMS
+	res.Logs = diag.Logs
+
+	return nil
+}
+
+// tapUnescape - reverts tapEscape
+func tapUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\#`, "#").Replace(s)
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +35,147 @@ not ok 4 - don'tknow
   ---
   reason: ""
   ...
+`,
+			wantErr: false,
+		},
+		{
+			name: "container logs",
+			tests: Tests{
+				&Test{
+					Name:          "test1",
+					Pass:          false,
+					FailureReason: "exit code 1 instead of 0",
+					ContainerLogs: []ContainerLog{{
+						Container: "scanner-abc",
+						Pod:       "busybox",
+						Namespace: "ns1",
+						Log:       "connecting to 10.0.0.1:80\nconnection refused\n",
+					}},
+				},
+			},
+			want: `TAP version 14
+1..1
+not ok 1 - test1
+  ---
+  reason: exit code 1 instead of 0
+  logs:
+  - container: scanner-abc
+    pod: busybox
+    namespace: ns1
+    log: |
+      connecting to 10.0.0.1:80
+      connection refused
+  ...
+`,
+			wantErr: false,
+		},
+		{
+			name: "observed tests",
+			tests: Tests{
+				&Test{
+					Name:       "pod2pod",
+					Protocol:   ProtocolTCP,
+					TargetPort: 8080,
+					ExitCode:   0,
+					Src: &Src{K8sResource: &K8sResource{
+						Kind: KindDeployment, Name: "busybox", Namespace: "ns1", Container: "app",
+					}},
+					Dst: &Dst{K8sResource: &K8sResource{
+						Kind: KindPod, Name: "echoserver", Namespace: "ns2",
+					}},
+					Pass:          false,
+					FailureReason: "exit code 1 instead of 0",
+					Observation: &Observation{
+						SrcPod:           "ns1/busybox-abc",
+						DstPod:           "ns2/echoserver",
+						TargetHost:       "10.0.0.2",
+						ExitCode:         ptr(1),
+						ScannerContainer: "scanner-abc",
+						Duration:         1500 * time.Millisecond,
+					},
+				},
+				&Test{
+					Name:        "pod2host",
+					Protocol:    ProtocolTCP,
+					TargetPort:  443,
+					Dst:         &Dst{Host: &Host{Name: "1.1.1.1"}},
+					Pass:        true,
+					Observation: &Observation{TargetHost: "1.1.1.1", ExitCode: ptr(0)},
+				},
+			},
+			want: `TAP version 14
+1..2
+not ok 1 - pod2pod
+  ---
+  reason: exit code 1 instead of 0
+  protocol: tcp
+  port: 8080
+  src:
+    kind: deployment
+    name: busybox
+    namespace: ns1
+    container: app
+    pod: ns1/busybox-abc
+  dst:
+    kind: pod
+    name: echoserver
+    namespace: ns2
+    pod: ns2/echoserver
+    target: 10.0.0.2
+  exitCode:
+    expected: 0
+    observed: 1
+  containers:
+    scanner: scanner-abc
+  duration_ms: 1500
+  ...
+ok 2 - pod2host
+  ---
+  protocol: tcp
+  port: 443
+  dst:
+    host: 1.1.1.1
+    target: 1.1.1.1
+  exitCode:
+    expected: 0
+    observed: 0
+  ...
+`,
+			wantErr: false,
+		},
+		{
+			name: "subtests and directives",
+			tests: Tests{
+				&Test{
+					Name: "fan out",
+					Pass: false,
+					SubTests: Tests{
+						&Test{Name: "port 80", Pass: true},
+						&Test{Name: "port 443", Pass: false, FailureReason: "timeout"},
+					},
+					FailureReason: "1 of 2 subtests failed",
+				},
+				&Test{Name: "skipped", Skip: "not ready"},
+				&Test{Name: "todo #1", Todo: "policy not applied yet", FailureReason: "timeout"},
+			},
+			want: `TAP version 14
+1..3
+    # Subtest: fan out
+    1..2
+    ok 1 - port 80
+    not ok 2 - port 443
+      ---
+      reason: timeout
+      ...
+not ok 1 - fan out
+  ---
+  reason: 1 of 2 subtests failed
+  ...
+ok 2 - skipped # SKIP not ready
+not ok 3 - todo \#1 # TODO policy not applied yet
+  ---
+  reason: timeout
+  ...
 `,
 			wantErr: false,
 		},
@@ -60,3 +202,31 @@ not ok 4 - don'tknow
 		})
 	}
 }
+
+func TestTests_TAPBailOut(t *testing.T) {
+	r := require.New(t)
+
+	tests := Tests{
+		&Test{Name: "test1", Pass: true},
+		&Test{Name: "test2", Pass: false, FailureReason: "context canceled"},
+		&Test{Name: "test3"},
+		&Test{Name: "test4"},
+	}
+
+	w := &bytes.Buffer{}
+	r.NoError(tests.TAPBailOut(w, "received signal interrupt"))
+	r.Equal(`TAP version 14
+1..4
+ok 1 - test1
+not ok 2 - test2
+  ---
+  reason: context canceled
+  ...
+Bail out! received signal interrupt
+`, w.String())
+}
+
+// ptr - returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -1,11 +1,23 @@
 package data
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Protocol - represents the Layer 4 protocol
@@ -27,6 +39,7 @@ const (
 	KindStatefulSet K8sResourceKind = "statefulset"
 	KindDaemonSet   K8sResourceKind = "daemonset"
 	KindPod         K8sResourceKind = "pod"
+	KindNode        K8sResourceKind = "node"
 )
 
 // ValidK8sResourceKinds - holds a map of valid K8sResourceKind
@@ -35,6 +48,38 @@ var ValidK8sResourceKinds = map[K8sResourceKind]bool{
 	KindStatefulSet: true,
 	KindDaemonSet:   true,
 	KindPod:         true,
+	KindNode:        true,
+}
+
+// IPFamily - represents the IP family of the addresses targeted by a test
+type IPFamily string
+
+// IP families supported by the tests
+const (
+	IPFamilyIPv4 IPFamily = "ipv4"
+	IPFamilyIPv6 IPFamily = "ipv6"
+	IPFamilyBoth IPFamily = "both" // the test is run once for each family
+)
+
+// ValidIPFamilies - holds a map of valid IPFamily, the empty one targets the primary address of the Pods
+var ValidIPFamilies = map[IPFamily]bool{
+	"":           true,
+	IPFamilyIPv4: true,
+	IPFamilyIPv6: true,
+	IPFamilyBoth: true,
+}
+
+// IPFamilyOf - returns the IP family of a literal IP address, and false if ip is not a literal IP address
+func IPFamilyOf(ip string) (IPFamily, bool) {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return "", false
+	case parsed.To4() != nil:
+		return IPFamilyIPv4, true
+	default:
+		return IPFamilyIPv6, true
+	}
 }
 
 // TestType - represents a K8s test type, right now
@@ -55,9 +100,24 @@ type K8sResource struct {
 	Kind      K8sResourceKind `yaml:"kind"`
 	Name      string          `yaml:"name"`
 	Namespace string          `yaml:"namespace"`
+	Container string          `yaml:"container,omitempty"` // container of the resolved Pod targeted by the injected containers
+	// Selector selects the nodes by their labels, it can only be set instead of the name of a node
+	Selector map[string]string `yaml:"selector,omitempty"`
 	// Clone     bool            `yaml:"clone"`
 }
 
+// SelectorString - returns the selector in the key=value,key=value form, sorted by key
+func (r *K8sResource) SelectorString() string {
+	keys := slices.Sorted(maps.Keys(r.Selector))
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+r.Selector[k])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
 // Src represents a source in the K8s test
 type Src struct {
 	K8sResource *K8sResource `yaml:"k8sResource"`
@@ -68,25 +128,430 @@ type Host struct {
 	Name string `yaml:"name"`
 }
 
+// Sampling - represents how the targets of a set of hosts are selected
+type Sampling string
+
+const (
+	SamplingFirst  Sampling = "first"  // the first count targets
+	SamplingRandom Sampling = "random" // count targets picked at random
+	SamplingAll    Sampling = "all"    // all the targets, there cannot be more than count of them
+)
+
+// ValidSamplings - holds a map of valid Sampling, the empty one selects all the targets
+var ValidSamplings = map[Sampling]bool{
+	"":             true,
+	SamplingFirst:  true,
+	SamplingRandom: true,
+	SamplingAll:    true,
+}
+
+// MaxHostTargets - maximum number of targets a set of hosts can expand into
+const MaxHostTargets = 256
+
+// Hosts represents a set of hosts that can be used as Dst in a K8s test, the test is run once
+// for each of the selected targets
+type Hosts struct {
+	Names []string `yaml:"names,omitempty"`
+	CIDR  string   `yaml:"cidr,omitempty"`
+	// Sample selects the targets, it defaults to all
+	Sample Sampling `yaml:"sample,omitempty"`
+	// Count is the number of targets selected by first and random, 1 by default, or the maximum
+	// number of targets of all, MaxHostTargets by default
+	Count int `yaml:"count,omitempty"`
+}
+
 // Dst holds the destination or the target resource of the test
 type Dst struct {
 	K8sResource *K8sResource `yaml:"k8sResource,omitempty"`
 	Host        *Host        `yaml:"host,omitempty"`
+	Hosts       *Hosts       `yaml:"hosts,omitempty"`
+}
+
+// Resources holds the compute resources requested by the injected containers
+type Resources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+// Containers holds the settings of the scanner and sniffer containers injected by a test
+type Containers struct {
+	ScannerImage     string     `yaml:"scannerImage,omitempty"`
+	SnifferImage     string     `yaml:"snifferImage,omitempty"`
+	ImagePullPolicy  string     `yaml:"imagePullPolicy,omitempty"`
+	ImagePullSecrets []string   `yaml:"imagePullSecrets,omitempty"`
+	Resources        *Resources `yaml:"resources,omitempty"`
+}
+
+// ValidImagePullPolicies - holds a map of valid image pull policies
+var ValidImagePullPolicies = map[string]bool{
+	"Always":       true,
+	"IfNotPresent": true,
+	"Never":        true,
+}
+
+// validResourceNames - holds a map of the resources that can be set on the injected containers
+var validResourceNames = map[string]bool{
+	"cpu":               true,
+	"memory":            true,
+	"ephemeral-storage": true,
+}
+
+// UDPProbeType - represents the protocol spoken by the scanner of a UDP test waiting for a reply
+type UDPProbeType string
+
+const (
+	UDPProbeDNS    UDPProbeType = "dns"    // a DNS query, any DNS response is a reply
+	UDPProbeNTP    UDPProbeType = "ntp"    // an NTP client request, any NTP server response is a reply
+	UDPProbeCustom UDPProbeType = "custom" // a custom payload, the reply must match the response pattern
+)
+
+// ValidUDPProbeTypes - holds a map of valid UDPProbeType
+var ValidUDPProbeTypes = map[UDPProbeType]bool{
+	UDPProbeDNS:    true,
+	UDPProbeNTP:    true,
+	UDPProbeCustom: true,
 }
 
+// UDPProbe holds the request sent by the scanner of a UDP test which waits for a reply of the
+// destination, rather than relying on a sniffer injected at the destination
+type UDPProbe struct {
+	Type       UDPProbeType `yaml:"type"`
+	Query      string       `yaml:"query,omitempty"`      // name resolved by the dns probe, the root zone by default
+	Payload    string       `yaml:"payload,omitempty"`    // text sent by the custom probe
+	PayloadHex string       `yaml:"payloadHex,omitempty"` // hex encoded payload sent by the custom probe
+	Response   string       `yaml:"response,omitempty"`   // regular expression matching the reply of the custom probe
+}
+
+// Direction - represents the direction of the sub-tests of a test run in both directions
+type Direction string
+
+const (
+	DirectionForward Direction = "forward" // from the source to the destination
+	DirectionReverse Direction = "reverse" // from the destination to the source
+)
+
+// Outcome - represents what the scanner or the sniffer container observed, as reported in its
+// termination message
+type Outcome string
+
+const (
+	OutcomeConnected   Outcome = "connected"    // the connection was established, or the probe was replied to
+	OutcomeRefused     Outcome = "refused"      // the connection was refused, e.g. nothing listens on the port
+	OutcomeReset       Outcome = "reset"        // the connection was reset once established
+	OutcomeTimeout     Outcome = "timeout"      // no reply was received before the timeout
+	OutcomeDNSFailure  Outcome = "dns-failure"  // the name of the destination could not be resolved
+	OutcomeSent        Outcome = "sent"         // the UDP packets were sent without waiting for a reply
+	OutcomeReceived    Outcome = "received"     // the sniffer received the packets of the test
+	OutcomeNotReceived Outcome = "not-received" // the sniffer did not receive the packets of the test
+	OutcomeError       Outcome = "error"        // the container could not run the check, e.g. an invalid argument
+)
+
+// ValidOutcomes - outcomes reported by the scanner and the sniffer containers
+var ValidOutcomes = map[Outcome]bool{
+	OutcomeConnected:   true,
+	OutcomeRefused:     true,
+	OutcomeReset:       true,
+	OutcomeTimeout:     true,
+	OutcomeDNSFailure:  true,
+	OutcomeSent:        true,
+	OutcomeReceived:    true,
+	OutcomeNotReceived: true,
+	OutcomeError:       true,
+}
+
+// Expect - represents the expected outcome of a test, an alternative to its exitCode
+type Expect string
+
+const (
+	ExpectAllowed Expect = "allowed" // the connection is established
+	ExpectDenied  Expect = "denied"  // the connection is not established, whatever the reason
+	ExpectRefused Expect = "refused" // the connection is refused, e.g. nothing listens on the port
+	ExpectTimeout Expect = "timeout" // no reply is received before the timeout
+	ExpectDropped Expect = "dropped" // the packets are silently dropped, i.e. a timeout or packets not received
+)
+
+// expectedOutcomes - outcomes reported by the containers matching each expectation
+var expectedOutcomes = map[Expect][]Outcome{
+	ExpectAllowed: {OutcomeConnected, OutcomeReceived},
+	ExpectDenied:  {OutcomeRefused, OutcomeReset, OutcomeTimeout, OutcomeDNSFailure, OutcomeNotReceived},
+	ExpectRefused: {OutcomeRefused},
+	ExpectTimeout: {OutcomeTimeout},
+	ExpectDropped: {OutcomeTimeout, OutcomeNotReceived},
+}
+
+// ExitCode - returns the exit code of the containers matching the expectation
+func (e Expect) ExitCode() int {
+	if e == ExpectAllowed {
+		return 0
+	}
+
+	return 1
+}
+
+// Matches - returns true when an outcome reported by a container matches the expectation
+func (e Expect) Matches(outcome Outcome) bool {
+	return slices.Contains(expectedOutcomes[e], outcome)
+}
+
+// NeedsOutcome - returns true when the exit code alone cannot tell whether the expectation is met, and the
+// outcome must be reported by the containers
+func (e Expect) NeedsOutcome() bool {
+	return e == ExpectRefused || e == ExpectTimeout || e == ExpectDropped
+}
+
+// Reverse holds the expectations of a test run from its destination to its source
+type Reverse struct {
+	TargetPort int    `yaml:"targetPort,omitempty"` // port of the source, the targetPort of the test by default
+	ExitCode   *int   `yaml:"exitCode,omitempty"`   // expected exit code, the expectation of the test by default
+	Expect     Expect `yaml:"expect,omitempty"`     // expected outcome, the expectation of the test by default
+}
+
+// MaxRetries - maximum number of times a failed test is run again
+const MaxRetries = 10
+
 // Test holds a single netAssert test
 type Test struct {
-	Name           string   `yaml:"name"`
-	Type           TestType `yaml:"type"`
-	Protocol       Protocol `yaml:"protocol"`
-	TargetPort     int      `yaml:"targetPort"`
-	TimeoutSeconds int      `yaml:"timeoutSeconds"`
-	Attempts       int      `yaml:"attempts"`
-	ExitCode       int      `yaml:"exitCode"`
-	Src            *Src     `yaml:"src"`
-	Dst            *Dst     `yaml:"dst"`
-	Pass           bool     `yaml:"pass"`
-	FailureReason  string   `yaml:"failureReason"`
+	Name               string         `yaml:"name"`
+	Type               TestType       `yaml:"type"`
+	Protocol           Protocol       `yaml:"protocol"`
+	TargetPort         int            `yaml:"targetPort"`
+	TimeoutSeconds     int            `yaml:"timeoutSeconds"`
+	Attempts           int            `yaml:"attempts"`
+	ExitCode           int            `yaml:"exitCode"`
+	Expect             Expect         `yaml:"expect,omitempty"`             // expected outcome, an alternative to exitCode
+	IPFamily           IPFamily       `yaml:"ipFamily,omitempty"`           // IP family of the targeted addresses, ipv4, ipv6 or both
+	UDPProbe           *UDPProbe      `yaml:"udpProbe,omitempty"`           // request of the UDP tests waiting for a reply
+	ExpectedSourceIP   string         `yaml:"expectedSourceIP,omitempty"`   // source address of the packets received by the dst
+	ExpectedSourceCIDR string         `yaml:"expectedSourceCIDR,omitempty"` // range of the source addresses of the packets
+	MaxConnectLatency  string         `yaml:"maxConnectLatency,omitempty"`  // maximum time to establish the connection
+	MinThroughput      string         `yaml:"minThroughput,omitempty"`      // minimum bit rate of the transfer, e.g. 10Mbps
+	TransferBytes      int            `yaml:"transferBytes,omitempty"`      // bytes sent to measure the throughput
+	Src                *Src           `yaml:"src"`
+	Dst                *Dst           `yaml:"dst"`
+	Reverse            *Reverse       `yaml:"reverse,omitempty"`           // the test is also run from dst to src when set
+	Retries            *int           `yaml:"retries,omitempty"`           // times a failed test is run again, the run default when nil
+	RetryBackoff       string         `yaml:"retryBackoff,omitempty"`      // delay before the first retry, doubled after each retry
+	ContainerOverhead  string         `yaml:"containerOverhead,omitempty"` // time given to the containers to come online, the run default when empty
+	Containers         *Containers    `yaml:"containers,omitempty"`
+	Skip               string         `yaml:"skip,omitempty"` // reason the test is skipped, it is not run when set
+	Todo               string         `yaml:"todo,omitempty"` // reason the test is not expected to pass yet
+	Pass               bool           `yaml:"pass"`
+	FailureReason      string         `yaml:"failureReason"`
+	ContainerLogs      []ContainerLog `yaml:"containerLogs,omitempty"`
+	Observation        *Observation   `yaml:"-"` // what was observed while running the test, nil if it did not run
+	SubTests           Tests          `yaml:"-"` // results of the tests the test fanned out into
+	Direction          Direction      `yaml:"-"` // direction of the sub-test of a test run in both directions
+}
+
+// Observation holds what was observed while running a test
+type Observation struct {
+	SrcPod           string        // namespace/name of the resolved source Pod
+	DstPod           string        // namespace/name of the resolved destination Pod
+	SrcNode          string        // name of the resolved source node
+	DstNode          string        // name of the resolved destination node
+	TargetHost       string        // host or IP address targeted by the scanner
+	ExitCode         *int          // exit code compared against the expected one, nil if it was not retrieved
+	SourceIPs        []string      // source addresses of the packets received by the sniffer
+	Measurements     *Measurements // timings reported by the scanner, nil if they were not measured
+	Outcome          Outcome       // outcome reported by the container deciding the test, empty if none was reported
+	Runs             int           // number of times the test was run, more than 1 when it was retried
+	Flaky            bool          // true when the test passed after being retried
+	ScannerContainer string        // name of the injected scanner container
+	SnifferContainer string        // name of the injected sniffer container
+	Duration         time.Duration // time taken to run the test
+}
+
+// Observe - returns the observation of the test, creating it if needed
+func (te *Test) Observe() *Observation {
+	if te.Observation == nil {
+		te.Observation = &Observation{}
+	}
+
+	return te.Observation
+}
+
+// ExpectedSource - returns the range of the expected source addresses of the packets received by the
+// destination, and false when the test does not expect a source address
+func (te *Test) ExpectedSource() (netip.Prefix, bool) {
+	if te.ExpectedSourceCIDR != "" {
+		prefix, err := netip.ParsePrefix(te.ExpectedSourceCIDR)
+		return prefix.Masked(), err == nil
+	}
+
+	if te.ExpectedSourceIP != "" {
+		addr, err := netip.ParseAddr(te.ExpectedSourceIP)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+
+	return netip.Prefix{}, false
+}
+
+// ReverseTest - returns the test run from the destination to the source of the test, and nil when the
+// test has no reverse block. The expected source addresses and the thresholds only apply to the forward
+// test.
+func (te *Test) ReverseTest() *Test {
+	if te.Reverse == nil || te.Src == nil || te.Dst == nil {
+		return nil
+	}
+
+	reverse := te.subTest(string(DirectionReverse))
+	reverse.Direction = DirectionReverse
+	reverse.Reverse = nil
+	reverse.ExpectedSourceIP = ""
+	reverse.ExpectedSourceCIDR = ""
+	reverse.MaxConnectLatency = ""
+	reverse.MinThroughput = ""
+	reverse.TransferBytes = 0
+	reverse.Src = &Src{K8sResource: te.Dst.K8sResource}
+	reverse.Dst = &Dst{K8sResource: te.Src.K8sResource}
+
+	if te.Reverse.TargetPort != 0 {
+		reverse.TargetPort = te.Reverse.TargetPort
+	}
+
+	if te.Reverse.ExitCode != nil {
+		reverse.ExitCode = *te.Reverse.ExitCode
+		reverse.Expect = ""
+	}
+
+	if te.Reverse.Expect != "" {
+		reverse.Expect = te.Reverse.Expect
+		reverse.ExitCode = te.Reverse.Expect.ExitCode()
+	}
+
+	return reverse
+}
+
+// DirectionSubTests - returns the forward and the reverse tests of a test with a reverse block, and nil
+// otherwise. The copies have not run yet.
+func (te *Test) DirectionSubTests() Tests {
+	reverse := te.ReverseTest()
+	if reverse == nil {
+		return nil
+	}
+
+	forward := te.subTest(string(DirectionForward))
+	forward.Direction = DirectionForward
+	forward.Reverse = nil
+
+	return Tests{forward, reverse}
+}
+
+// IPFamilySubTests - returns a copy of the test for each IP family when its ipFamily is both, and nil
+// otherwise. The copies have not run yet.
+func (te *Test) IPFamilySubTests() Tests {
+	if te.IPFamily != IPFamilyBoth {
+		return nil
+	}
+
+	subTests := make(Tests, 0, 2)
+	for _, family := range []IPFamily{IPFamilyIPv4, IPFamilyIPv6} {
+		sub := te.subTest(string(family))
+		sub.IPFamily = family
+		subTests = append(subTests, sub)
+	}
+
+	return subTests
+}
+
+// HostSubTests - returns a copy of the test for each target selected from its dst hosts, and nil
+// when the destination is not a set of hosts. The copies have not run yet.
+func (te *Test) HostSubTests() (Tests, error) {
+	if te.Dst == nil || te.Dst.Hosts == nil {
+		return nil, nil
+	}
+
+	targets, err := te.Dst.Hosts.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	subTests := make(Tests, 0, len(targets))
+	for _, target := range targets {
+		sub := te.subTest(target)
+		sub.Dst = &Dst{Host: &Host{Name: target}}
+		subTests = append(subTests, sub)
+	}
+
+	return subTests, nil
+}
+
+// subTest - returns a copy of the test which has not run yet, named after the test and the label
+func (te *Test) subTest(label string) *Test {
+	sub := *te
+	sub.Name = fmt.Sprintf("%s [%s]", te.Name, label)
+	sub.Pass = false
+	sub.FailureReason = ""
+	sub.ContainerLogs = nil
+	sub.Observation = nil
+	sub.SubTests = nil
+
+	return &sub
+}
+
+// RetryPolicy - returns the number of times the test is run again when it fails and the delay before the
+// first retry, defaultRetries and defaultBackoff apply when the test does not set them
+func (te *Test) RetryPolicy(defaultRetries int, defaultBackoff time.Duration) (int, time.Duration) {
+	retries := defaultRetries
+	if te.Retries != nil {
+		retries = *te.Retries
+	}
+
+	backoff := defaultBackoff
+	if d, err := time.ParseDuration(te.RetryBackoff); err == nil && d > 0 {
+		backoff = d
+	}
+
+	return retries, backoff
+}
+
+// ContainerTimeout - returns the maximum duration to wait for the exit status of an injected container of
+// the test, i.e. its timeout and the overhead of the containers, defaultOverhead applies when the test does
+// not set its own
+func (te *Test) ContainerTimeout(defaultOverhead time.Duration) time.Duration {
+	overhead := defaultOverhead
+	if d, err := time.ParseDuration(te.ContainerOverhead); err == nil && d >= 0 {
+		overhead = d
+	}
+
+	return time.Duration(te.TimeoutSeconds)*time.Second + overhead
+}
+
+// Flaky - returns true when the test passed after being retried, or when one of its sub-tests did, a
+// flaky test is failed when flaky tests are failures
+func (te *Test) Flaky() bool {
+	if te.Observation != nil && te.Observation.Flaky {
+		return true
+	}
+
+	return slices.ContainsFunc(te.SubTests, (*Test).Flaky)
+}
+
+// Skipped - returns true when the test is marked to be skipped
+func (te *Test) Skipped() bool {
+	return te.Skip != ""
+}
+
+// ran - returns true when the test was run, or deliberately skipped
+func (te *Test) ran() bool {
+	return te.Pass || te.Skipped() || te.FailureReason != "" || te.Observation != nil
+}
+
+// Failed - returns true when the test ran and did not pass, failures of tests marked as todo are ignored
+func (te *Test) Failed() bool {
+	return !te.Pass && !te.Skipped() && te.Todo == ""
+}
+
+// ContainerLog holds the tail of the logs of a container injected by a test
+type ContainerLog struct {
+	Container string `yaml:"container" json:"container"`
+	Pod       string `yaml:"pod" json:"pod"`
+	Namespace string `yaml:"namespace" json:"namespace"`
+	Log       string `yaml:"log" json:"log"`
 }
 
 // Tests - holds a slice of NetAssertTests
@@ -102,8 +567,13 @@ func (r *K8sResource) validate() error {
 		kindErr         error
 		nameSpaceErr    error
 		resourceKindErr error
+		containerErr    error
 	)
 
+	if r.Kind == KindNode {
+		return r.validateNode()
+	}
+
 	if r.Name == "" {
 		nameErr = fmt.Errorf("k8sResource name is missing")
 	}
@@ -116,11 +586,51 @@ func (r *K8sResource) validate() error {
 		nameSpaceErr = fmt.Errorf("k8sResource namespace is missing")
 	}
 
+	var selectorErr error
+	if len(r.Selector) > 0 {
+		selectorErr = fmt.Errorf("k8sResource selector is only supported by the node kind")
+	}
+
 	if _, ok := ValidK8sResourceKinds[r.Kind]; !ok {
 		resourceKindErr = fmt.Errorf("k8sResource invalid kind '%s'", r.Kind)
 	}
 
-	return errors.Join(nameErr, kindErr, nameSpaceErr, resourceKindErr)
+	if r.Container != "" {
+		if msgs := validation.IsDNS1123Label(r.Container); len(msgs) > 0 {
+			containerErr = fmt.Errorf("k8sResource invalid container name '%s': %s",
+				r.Container, strings.Join(msgs, ", "))
+		}
+	}
+
+	return errors.Join(nameErr, kindErr, nameSpaceErr, resourceKindErr, containerErr, selectorErr)
+}
+
+// validateNode - validates a K8sResource of the node kind, the nodes are selected either by name
+// or by labels and are not namespaced
+func (r *K8sResource) validateNode() error {
+	var nameErr, selectorErr, containerErr error
+
+	switch {
+	case r.Name == "" && len(r.Selector) == 0:
+		nameErr = fmt.Errorf("k8sResource of kind node needs a name or a selector")
+	case r.Name != "" && len(r.Selector) > 0:
+		nameErr = fmt.Errorf("k8sResource of kind node cannot have both a name and a selector")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(r.Selector)) {
+		value := r.Selector[key]
+		msgs := validation.IsQualifiedName(key)
+		msgs = append(msgs, validation.IsValidLabelValue(value)...)
+		if len(msgs) > 0 {
+			selectorErr = fmt.Errorf("k8sResource invalid selector '%s=%s': %s", key, value, strings.Join(msgs, ", "))
+		}
+	}
+
+	if r.Container != "" {
+		containerErr = fmt.Errorf("k8sResource of kind node cannot have a container")
+	}
+
+	return errors.Join(nameErr, selectorErr, containerErr)
 }
 
 // validate - validates the Host type
@@ -133,9 +643,196 @@ func (h *Host) validate() error {
 		return fmt.Errorf("host field is set to empty string")
 	}
 
+	if strings.HasPrefix(h.Name, "[") {
+		if family, ok := IPFamilyOf(h.Target()); !ok || family != IPFamilyIPv6 || !strings.HasSuffix(h.Name, "]") {
+			return fmt.Errorf("host %s is not a valid IPv6 address", h.Name)
+		}
+	}
+
 	return nil
 }
 
+// Target - returns the name or the IP address of the host, without the brackets of the IPv6 addresses
+func (h *Host) Target() string {
+	return strings.TrimSuffix(strings.TrimPrefix(h.Name, "["), "]")
+}
+
+// validate - validates the Hosts type
+func (h *Hosts) validate() error {
+	if h == nil {
+		return fmt.Errorf("hosts field is nil")
+	}
+
+	var targetsErr error
+	switch {
+	case len(h.Names) == 0 && h.CIDR == "":
+		targetsErr = fmt.Errorf("hosts field needs names or a cidr")
+	case len(h.Names) > 0 && h.CIDR != "":
+		targetsErr = fmt.Errorf("hosts field cannot have both names and a cidr")
+	}
+
+	var namesErr error
+	seen := make(map[string]struct{}, len(h.Names))
+	for _, name := range h.Names {
+		host := Host{Name: name}
+		if err := host.validate(); err != nil {
+			namesErr = err
+			continue
+		}
+
+		if _, ok := seen[host.Target()]; ok {
+			namesErr = fmt.Errorf("duplicate host %s", name)
+		}
+		seen[host.Target()] = struct{}{}
+	}
+
+	var cidrErr error
+	if h.CIDR != "" {
+		if _, err := netip.ParsePrefix(h.CIDR); err != nil {
+			cidrErr = fmt.Errorf("invalid cidr %q: %w", h.CIDR, err)
+		}
+	}
+
+	var sampleErr error
+	switch {
+	case !ValidSamplings[h.Sample]:
+		sampleErr = fmt.Errorf("invalid sample %q, must be first, random or all", h.Sample)
+	case h.Count < 0 || h.Count > MaxHostTargets:
+		sampleErr = fmt.Errorf("hosts count out of range: %d, must be between 1 and %d", h.Count, MaxHostTargets)
+	}
+
+	if err := errors.Join(targetsErr, namesErr, cidrErr, sampleErr); err != nil {
+		return err
+	}
+
+	// all the targets are run, so there cannot be more of them than the limit
+	if size := h.size(); h.sampling() == SamplingAll && size > uint64(h.limit()) {
+		return fmt.Errorf("hosts expand into %d targets, more than the limit of %d, use the first or random sample",
+			size, h.limit())
+	}
+
+	return nil
+}
+
+// sampling - returns the sampling strategy of the hosts, all by default
+func (h *Hosts) sampling() Sampling {
+	if h.Sample == "" {
+		return SamplingAll
+	}
+
+	return h.Sample
+}
+
+// limit - returns the number of targets selected by first and random, or the maximum number of
+// targets of all
+func (h *Hosts) limit() int {
+	switch {
+	case h.Count > 0:
+		return h.Count
+	case h.sampling() == SamplingAll:
+		return MaxHostTargets
+	default:
+		return 1
+	}
+}
+
+// size - returns the number of targets the hosts can be sampled from, it saturates for the large
+// IPv6 prefixes
+func (h *Hosts) size() uint64 {
+	if h.CIDR == "" {
+		return uint64(len(h.Names))
+	}
+
+	prefix, err := netip.ParsePrefix(h.CIDR)
+	if err != nil {
+		return 0
+	}
+
+	_, size := cidrRange(prefix.Masked())
+	return size
+}
+
+// cidrRange - returns the offset of the first usable address of the prefix and the number of usable
+// addresses. The network address, and the broadcast address in IPv4, are not usable when the prefix
+// holds more than two addresses. The range is capped at 2^62 addresses.
+func cidrRange(prefix netip.Prefix) (uint64, uint64) {
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 62 {
+		return 1, 1 << 62
+	}
+
+	size := uint64(1) << hostBits
+	switch {
+	case size <= 2:
+		return 0, size
+	case prefix.Addr().Is4():
+		return 1, size - 2
+	default:
+		return 1, size - 1
+	}
+}
+
+// addrAt - returns the address of the prefix at the given offset, offset must be in the prefix
+func addrAt(prefix netip.Prefix, offset uint64) netip.Addr {
+	if prefix.Addr().Is4() {
+		b := prefix.Addr().As4()
+		binary.BigEndian.PutUint32(b[:], binary.BigEndian.Uint32(b[:])+uint32(offset))
+		return netip.AddrFrom4(b)
+	}
+
+	b := prefix.Addr().As16()
+	binary.BigEndian.PutUint64(b[8:], binary.BigEndian.Uint64(b[8:])+offset)
+	return netip.AddrFrom16(b)
+}
+
+// Targets - returns the names or IP addresses selected by the sampling strategy of the hosts, the
+// random ones change on every call
+func (h *Hosts) Targets() ([]string, error) {
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+
+	count := uint64(h.limit())
+	size := h.size()
+	if h.sampling() == SamplingAll || count > size {
+		count = size
+	}
+
+	offsets := make([]uint64, 0, count)
+	if h.sampling() == SamplingRandom {
+		picked := make(map[uint64]struct{}, count)
+		for uint64(len(offsets)) < count {
+			offset := rand.Uint64N(size)
+			if _, ok := picked[offset]; !ok {
+				picked[offset] = struct{}{}
+				offsets = append(offsets, offset)
+			}
+		}
+		slices.Sort(offsets)
+	} else {
+		for offset := range count {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	targets := make([]string, 0, count)
+	if h.CIDR == "" {
+		for _, offset := range offsets {
+			targets = append(targets, h.Names[offset])
+		}
+
+		return targets, nil
+	}
+
+	prefix := netip.MustParsePrefix(h.CIDR).Masked()
+	first, _ := cidrRange(prefix)
+	for _, offset := range offsets {
+		targets = append(targets, addrAt(prefix, first+offset).String())
+	}
+
+	return targets, nil
+}
+
 // validate - validates the Dst type
 func (d *Dst) validate() error {
 	if d == nil {
@@ -146,6 +843,10 @@ func (d *Dst) validate() error {
 		return fmt.Errorf("dst field only supports K8sResource or Host but not both")
 	}
 
+	if d.Hosts != nil && (d.K8sResource != nil || d.Host != nil) {
+		return fmt.Errorf("dst field does not support Hosts together with K8sResource or Host")
+	}
+
 	if d.K8sResource != nil {
 		return d.K8sResource.validate()
 	}
@@ -154,9 +855,147 @@ func (d *Dst) validate() error {
 		return d.Host.validate()
 	}
 
+	if d.Hosts != nil {
+		return d.Hosts.validate()
+	}
+
+	return nil
+}
+
+// validateIPFamily - ensures that the literal addresses of the hosts belong to the IP family, the
+// hostnames are resolved by the scanner, but the literal addresses belong to a single family
+func (d *Dst) validateIPFamily(ipFamily IPFamily) error {
+	var hosts []string
+	switch {
+	case d.Host != nil:
+		hosts = []string{d.Host.Name}
+	case d.Hosts != nil && d.Hosts.CIDR != "":
+		hosts = []string{d.Hosts.CIDR}
+	case d.Hosts != nil:
+		hosts = d.Hosts.Names
+	}
+
+	for _, name := range hosts {
+		target := (&Host{Name: name}).Target()
+		if prefix, err := netip.ParsePrefix(target); err == nil {
+			target = prefix.Addr().String()
+		}
+
+		family, ok := IPFamilyOf(target)
+		switch {
+		case ok && ipFamily == IPFamilyBoth:
+			return fmt.Errorf("ipFamily both cannot be used with the literal address %s", name)
+		case ok && family != ipFamily:
+			return fmt.Errorf("host %s is not an %s address", name, ipFamily)
+		}
+	}
+
 	return nil
 }
 
+// validate - validates the Resources type
+func (r *Resources) validate() error {
+	if r == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, rl := range []map[string]string{r.Requests, r.Limits} {
+		for name, value := range rl {
+			if !validResourceNames[name] {
+				errs = append(errs, fmt.Errorf("invalid resource name %q", name))
+				continue
+			}
+
+			if _, err := resource.ParseQuantity(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid quantity %q for resource %q", value, name))
+			}
+		}
+	}
+
+	for name, limit := range r.Limits {
+		request, ok := r.Requests[name]
+		if !ok {
+			continue
+		}
+
+		lq, lErr := resource.ParseQuantity(limit)
+		rq, rErr := resource.ParseQuantity(request)
+		if lErr == nil && rErr == nil && lq.Cmp(rq) < 0 {
+			errs = append(errs, fmt.Errorf("limit of resource %q must be greater than or equal to its request", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate - validates the Containers type
+func (c *Containers) validate() error {
+	if c == nil {
+		return nil
+	}
+
+	var pullPolicyErr error
+	if c.ImagePullPolicy != "" && !ValidImagePullPolicies[c.ImagePullPolicy] {
+		pullPolicyErr = fmt.Errorf("invalid imagePullPolicy %q", c.ImagePullPolicy)
+	}
+
+	var pullSecretErr error
+	for _, secret := range c.ImagePullSecrets {
+		if secret == "" {
+			pullSecretErr = fmt.Errorf("imagePullSecrets cannot contain an empty string")
+		}
+	}
+
+	return errors.Join(pullPolicyErr, pullSecretErr, c.Resources.validate())
+}
+
+// validate - validates the UDPProbe type
+func (p *UDPProbe) validate() error {
+	if p == nil {
+		return nil
+	}
+
+	if !ValidUDPProbeTypes[p.Type] {
+		return fmt.Errorf("invalid udpProbe type %q, must be dns, ntp or custom", p.Type)
+	}
+
+	var queryErr error
+	switch {
+	case p.Query != "" && p.Type != UDPProbeDNS:
+		queryErr = fmt.Errorf("udpProbe query is only supported by the dns type")
+	case p.Query != "" && p.Query != ".":
+		for _, label := range strings.Split(strings.TrimSuffix(p.Query, "."), ".") {
+			if len(label) == 0 || len(label) > 63 {
+				queryErr = fmt.Errorf("udpProbe query %q is not a valid domain name", p.Query)
+			}
+		}
+	}
+
+	var payloadErr error
+	switch {
+	case p.Type != UDPProbeCustom && (p.Payload != "" || p.PayloadHex != "" || p.Response != ""):
+		payloadErr = fmt.Errorf("udpProbe payload, payloadHex and response are only supported by the custom type")
+	case p.Type != UDPProbeCustom:
+	case p.Payload == "" && p.PayloadHex == "":
+		payloadErr = fmt.Errorf("udpProbe of type custom needs a payload or a payloadHex")
+	case p.Payload != "" && p.PayloadHex != "":
+		payloadErr = fmt.Errorf("udpProbe cannot have both a payload and a payloadHex")
+	case p.PayloadHex != "":
+		if _, err := hex.DecodeString(p.PayloadHex); err != nil {
+			payloadErr = fmt.Errorf("udpProbe invalid payloadHex: %w", err)
+		}
+	}
+
+	var responseErr error
+	if _, err := regexp.Compile(p.Response); err != nil {
+		responseErr = fmt.Errorf("udpProbe invalid response pattern: %w", err)
+	}
+
+	return errors.Join(queryErr, payloadErr, responseErr)
+}
+
 // validate - validates the Src type
 func (d *Src) validate() error {
 	if d == nil {
@@ -167,7 +1006,13 @@ func (d *Src) validate() error {
 		return fmt.Errorf("k8sResource field in src is currently the only source allowed")
 	}
 
-	return d.K8sResource.validate()
+	// the scanner of a node runs in a hostNetwork probe Pod, which needs a namespace
+	var namespaceErr error
+	if d.K8sResource.Kind == KindNode && d.K8sResource.Namespace == "" {
+		namespaceErr = fmt.Errorf("k8sResource of kind node in src needs the namespace of its probe Pod")
+	}
+
+	return errors.Join(d.K8sResource.validate(), namespaceErr)
 }
 
 // validate - validates the Test case
@@ -220,14 +1065,145 @@ func (te *Test) validate() error {
 		dstValidationErr = te.Dst.validate()
 	}
 
+	// the sniffer container must be injected in a Pod at the destination, unless the scanner waits for
+	// a reply of the destination
 	var notSupportedTest error
-	if te.Protocol == ProtocolUDP && te.Dst != nil && te.Dst.Host != nil {
-		notSupportedTest = fmt.Errorf("with udp tests the destination must be a k8sResource")
+	if te.Protocol == ProtocolUDP && te.UDPProbe == nil && te.Dst != nil &&
+		(te.Dst.Host != nil || te.Dst.Hosts != nil) {
+		notSupportedTest = fmt.Errorf("with udp tests the destination must be a k8sResource, unless a udpProbe is set")
+	}
+
+	if te.Protocol == ProtocolUDP && te.UDPProbe == nil && te.Dst != nil && te.Dst.K8sResource != nil &&
+		te.Dst.K8sResource.Kind == KindNode {
+		notSupportedTest = fmt.Errorf("with udp tests the destination cannot be a node, unless a udpProbe is set")
+	}
+
+	var udpProbeErr error
+	if te.UDPProbe != nil && te.Protocol != ProtocolUDP {
+		udpProbeErr = fmt.Errorf("udpProbe is only supported by udp tests")
+	} else {
+		udpProbeErr = te.UDPProbe.validate()
+	}
+
+	var expectedSourceErr error
+	if te.ExpectedSourceIP != "" || te.ExpectedSourceCIDR != "" {
+		expectedSourceErr = te.validateExpectedSource()
+	}
+
+	var ipFamilyErr error
+	if _, ok := ValidIPFamilies[te.IPFamily]; !ok {
+		ipFamilyErr = fmt.Errorf("invalid ipFamily %q, must be ipv4, ipv6 or both", te.IPFamily)
+	} else if te.IPFamily != "" && te.Dst != nil {
+		ipFamilyErr = te.Dst.validateIPFamily(te.IPFamily)
+	}
+
+	// the reverse test is validated as any other test, its source must be a k8sResource
+	var reverseErr error
+	switch {
+	case te.Reverse == nil || te.Src == nil || te.Dst == nil:
+	case te.Dst.K8sResource == nil:
+		reverseErr = fmt.Errorf("reverse needs a k8sResource destination")
+	case te.Reverse.TargetPort < 0 || te.Reverse.TargetPort > 65535:
+		reverseErr = fmt.Errorf("reverse targetPort out of range: %d", te.Reverse.TargetPort)
+	case te.Reverse.ExitCode != nil && te.Reverse.Expect != "":
+		reverseErr = fmt.Errorf("reverse expect and exitCode cannot be set at the same time")
+	default:
+		if err := te.ReverseTest().validate(); err != nil {
+			reverseErr = fmt.Errorf("invalid reverse test: %w", err)
+		}
+	}
+
+	var retriesErr error
+	if te.Retries != nil && (*te.Retries < 0 || *te.Retries > MaxRetries) {
+		retriesErr = fmt.Errorf("retries out of range: %d, must be between 0 and %d", *te.Retries, MaxRetries)
+	}
+
+	var retryBackoffErr error
+	if te.RetryBackoff != "" {
+		if backoff, err := time.ParseDuration(te.RetryBackoff); err != nil || backoff <= 0 {
+			retryBackoffErr = fmt.Errorf("invalid retryBackoff %q, must be a positive duration such as 5s",
+				te.RetryBackoff)
+		}
+	}
+
+	var containerOverheadErr error
+	if te.ContainerOverhead != "" {
+		if overhead, err := time.ParseDuration(te.ContainerOverhead); err != nil || overhead < 0 {
+			containerOverheadErr = fmt.Errorf("invalid containerOverhead %q, must be a duration such as 30s",
+				te.ContainerOverhead)
+		}
+	}
+
+	var expectErr error
+	if te.Expect != "" {
+		expectErr = te.validateExpect()
+	}
+
+	var directiveErr error
+	if te.Skip != "" && te.Todo != "" {
+		directiveErr = fmt.Errorf("skip and todo cannot be set at the same time")
 	}
 
 	return errors.Join(nameErr, invalidProtocolErr, targetPortErr,
 		invalidAttemptsErr, timeoutSecondsErr, invalidTestTypeErr, k8sResourceErr,
-		dstValidationErr, missingSrcErr, missingDstErr, notSupportedTest)
+		dstValidationErr, missingSrcErr, missingDstErr, notSupportedTest, udpProbeErr, expectedSourceErr,
+		ipFamilyErr, reverseErr, expectErr, retriesErr, retryBackoffErr, containerOverheadErr, directiveErr,
+		te.validateThresholds(),
+		te.Containers.validate())
+}
+
+// validateExpectedSource - validates the expected source address of the packets, which is recorded by
+// the sniffer injected in the destination Pod of the UDP tests
+func (te *Test) validateExpectedSource() error {
+	var sourceErr error
+	switch {
+	case te.ExpectedSourceIP != "" && te.ExpectedSourceCIDR != "":
+		sourceErr = fmt.Errorf("expectedSourceIP and expectedSourceCIDR cannot be set at the same time")
+	case te.ExpectedSourceIP != "":
+		if _, err := netip.ParseAddr(te.ExpectedSourceIP); err != nil {
+			sourceErr = fmt.Errorf("invalid expectedSourceIP %q", te.ExpectedSourceIP)
+		}
+	default:
+		if _, err := netip.ParsePrefix(te.ExpectedSourceCIDR); err != nil {
+			sourceErr = fmt.Errorf("invalid expectedSourceCIDR %q", te.ExpectedSourceCIDR)
+		}
+	}
+
+	var notSupportedErr error
+	if te.Protocol != ProtocolUDP || te.UDPProbe != nil || te.Dst == nil || te.Dst.K8sResource == nil ||
+		te.Dst.K8sResource.Kind == KindNode {
+		notSupportedErr = fmt.Errorf("expected source addresses are only supported by udp tests towards a " +
+			"k8sResource, whose sniffer records the source addresses")
+	}
+
+	var exitCodeErr error
+	if te.ExitCode != 0 {
+		exitCodeErr = fmt.Errorf("expected source addresses need an exitCode of 0, as the packets must be received")
+	}
+
+	return errors.Join(sourceErr, notSupportedErr, exitCodeErr)
+}
+
+// validateExpect - validates the expected outcome of the test, the outcomes that the exit code alone
+// cannot tell apart must be observable by the containers of the test
+func (te *Test) validateExpect() error {
+	if _, ok := expectedOutcomes[te.Expect]; !ok {
+		return fmt.Errorf("invalid expect %q, must be allowed, denied, refused, timeout or dropped", te.Expect)
+	}
+
+	var exitCodeErr error
+	if te.ExitCode != te.Expect.ExitCode() {
+		exitCodeErr = fmt.Errorf("exitCode %d contradicts expect %s, set only one of them", te.ExitCode, te.Expect)
+	}
+
+	// the sniffer of the UDP tests only tells whether the packets were received
+	var notSupportedErr error
+	if te.Protocol == ProtocolUDP && te.UDPProbe == nil && (te.Expect == ExpectRefused || te.Expect == ExpectTimeout) {
+		notSupportedErr = fmt.Errorf("expect %s is not supported by udp tests without a udpProbe, "+
+			"use denied or dropped", te.Expect)
+	}
+
+	return errors.Join(exitCodeErr, notSupportedErr)
 }
 
 // Validate - validates the Tests type
@@ -251,7 +1227,9 @@ func (ts *Tests) Validate() error {
 }
 
 // setDefaults - sets sensible defaults to the Test
-func (te *Test) setDefaults() {
+func (te *Test) setDefaults(
+	exitCodeSet bool, // true when exitCode is set explicitly, even to 0
+) {
 	if te.TimeoutSeconds == 0 {
 		te.TimeoutSeconds = 15
 	}
@@ -263,6 +1241,11 @@ func (te *Test) setDefaults() {
 	if te.Protocol == "" {
 		te.Protocol = ProtocolTCP
 	}
+
+	// the expected outcome sets the expected exit code, a different exitCode is rejected by validate
+	if te.Expect != "" && !exitCodeSet {
+		te.ExitCode = te.Expect.ExitCode()
+	}
 }
 
 // UnmarshalYAML - decodes Tests type
@@ -316,7 +1299,8 @@ func (te *Test) UnmarshalYAML(node *yaml.Node) error {
 	// we need to type cast ta back to p to call the original
 	// methods on that type to validate the Test
 	p := Test(ta)
-	p.setDefaults()
+	// an explicit exitCode of 0 cannot be told apart from an unset one once decoded
+	p.setDefaults(hasKey(node, "exitCode"))
 	if err := p.validate(); err != nil {
 		return err
 	}
@@ -326,3 +1310,18 @@ func (te *Test) UnmarshalYAML(node *yaml.Node) error {
 
 	return nil
 }
+
+// hasKey - returns true when node is a mapping holding key
+func hasKey(node *yaml.Node, key string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,10 +1,12 @@
 package data
 
 import (
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -72,6 +74,509 @@ func TestNewFromReader(t *testing.T) {
 			confFile:       "host-as-dst-udp.yaml",
 			wantErrMatches: []string{"with udp tests the destination must be a k8sResource"},
 		},
+		"skip and todo": {
+			confFile:       "skip-and-todo.yaml",
+			wantErrMatches: []string{"skip and todo cannot be set at the same time"},
+		},
+		"wrong container settings": {
+			confFile: "wrong-container-settings.yaml",
+			wantErrMatches: []string{
+				"invalid imagePullPolicy",
+				"imagePullSecrets cannot contain an empty string",
+				"invalid resource name \"gpu\"",
+				"invalid quantity \"lots\"",
+				"limit of resource \"cpu\" must be greater than or equal to its request",
+				"k8sResource invalid container name 'App_1'",
+			},
+		},
+		"wrong nodes": {
+			confFile: "wrong-nodes.yaml",
+			wantErrMatches: []string{
+				"k8sResource of kind node cannot have both a name and a selector",
+				"k8sResource invalid selector 'node-role.kubernetes.io/worker=not valid'",
+				"k8sResource of kind node cannot have a container",
+				"k8sResource of kind node in src needs the namespace of its probe Pod",
+				"k8sResource of kind node needs a name or a selector",
+				"with udp tests the destination cannot be a node",
+			},
+		},
+		"selector on a pod": {
+			confFile:       "selector-on-pod.yaml",
+			wantErrMatches: []string{"k8sResource selector is only supported by the node kind"},
+		},
+		"nodes": {
+			confFile: "nodes.yaml",
+			want: Tests{
+				&Test{
+					Name:           "node-to-metadata",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     80,
+					ExitCode:       1,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Kind:      KindNode,
+							Namespace: "netassert",
+							Selector:  map[string]string{"node-role.kubernetes.io/worker": ""},
+						},
+					},
+					Dst: &Dst{
+						Host: &Host{
+							Name: "169.254.169.254",
+						},
+					},
+				},
+				&Test{
+					Name:           "pod-to-node",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     10250,
+					ExitCode:       1,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name: "node1",
+							Kind: KindNode,
+						},
+					},
+				},
+			},
+		},
+		"wrong ip families": {
+			confFile: "wrong-ip-families.yaml",
+			wantErrMatches: []string{
+				`invalid ipFamily "ipv5", must be ipv4, ipv6 or both`,
+				"host [fd00::1 is not a valid IPv6 address",
+			},
+		},
+		"host not in the ip family": {
+			confFile:       "host-not-in-ip-family.yaml",
+			wantErrMatches: []string{"host 1.1.1.1 is not an ipv6 address"},
+		},
+		"both ip families with a literal host": {
+			confFile:       "both-ip-families-literal-host.yaml",
+			wantErrMatches: []string{"ipFamily both cannot be used with the literal address [2606:4700:4700::1111]"},
+		},
+		"ip families": {
+			confFile: "ip-families.yaml",
+			want: Tests{
+				&Test{
+					Name:           "pod-to-pod-dual-stack",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     8080,
+					IPFamily:       IPFamilyBoth,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "mypod",
+							Kind:      KindPod,
+							Namespace: "ns2",
+						},
+					},
+				},
+				&Test{
+					Name:           "pod-to-ipv6-host",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     443,
+					IPFamily:       IPFamilyIPv6,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						Host: &Host{
+							Name: "[2606:4700:4700::1111]",
+						},
+					},
+				},
+			},
+		},
+		"wrong hosts": {
+			confFile: "wrong-hosts.yaml",
+			wantErrMatches: []string{
+				"hosts field cannot have both names and a cidr",
+				`invalid cidr "10.0.0.0/300"`,
+				`invalid sample "some", must be first, random or all`,
+			},
+		},
+		"hosts over the limit": {
+			confFile:       "hosts-over-limit.yaml",
+			wantErrMatches: []string{"hosts expand into 16777214 targets, more than the limit of 256"},
+		},
+		"udp hosts": {
+			confFile:       "udp-hosts.yaml",
+			wantErrMatches: []string{"with udp tests the destination must be a k8sResource"},
+		},
+		"hosts": {
+			confFile: "hosts.yaml",
+			want: Tests{
+				&Test{
+					Name:           "no-egress-to-private-range",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     443,
+					ExitCode:       1,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						Hosts: &Hosts{
+							CIDR:   "10.0.0.0/8",
+							Sample: SamplingRandom,
+							Count:  5,
+						},
+					},
+				},
+				&Test{
+					Name:           "saas-endpoints-reachable",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     443,
+					IPFamily:       IPFamilyIPv6,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						Hosts: &Hosts{
+							Names: []string{"api.example.com", "[2606:4700:4700::1111]"},
+						},
+					},
+				},
+			},
+		},
+		"wrong udp probes": {
+			confFile: "wrong-udp-probes.yaml",
+			wantErrMatches: []string{
+				"udpProbe cannot have both a payload and a payloadHex",
+				"udpProbe invalid response pattern",
+			},
+		},
+		"udp probe on a tcp test": {
+			confFile:       "udp-probe-on-tcp.yaml",
+			wantErrMatches: []string{"udpProbe is only supported by udp tests"},
+		},
+		"udp probes": {
+			confFile: "udp-probes.yaml",
+			want: Tests{
+				&Test{
+					Name:           "pod-to-dns",
+					Type:           "k8s",
+					Protocol:       ProtocolUDP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     53,
+					UDPProbe:       &UDPProbe{Type: UDPProbeDNS, Query: "example.com"},
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						Host: &Host{
+							Name: "1.1.1.1",
+						},
+					},
+				},
+				&Test{
+					Name:           "pod-to-syslog",
+					Type:           "k8s",
+					Protocol:       ProtocolUDP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     514,
+					ExitCode:       1,
+					UDPProbe:       &UDPProbe{Type: UDPProbeCustom, PayloadHex: "3c31343e", Response: "^ok"},
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						Hosts: &Hosts{
+							Names: []string{"syslog-1.example.com", "syslog-2.example.com"},
+						},
+					},
+				},
+			},
+		},
+		"wrong expected source": {
+			confFile: "wrong-expected-source.yaml",
+			wantErrMatches: []string{
+				"expectedSourceIP and expectedSourceCIDR cannot be set at the same time",
+				"expected source addresses are only supported by udp tests towards a k8sResource",
+				"expected source addresses need an exitCode of 0",
+			},
+		},
+		"expected source": {
+			confFile: "expected-source.yaml",
+			want: Tests{
+				&Test{
+					Name:               "pod-to-pod-through-egress-gateway",
+					Type:               "k8s",
+					Protocol:           ProtocolUDP,
+					Attempts:           3,
+					TimeoutSeconds:     15,
+					TargetPort:         53,
+					ExpectedSourceCIDR: "10.10.0.0/24",
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "deployment2",
+							Kind:      KindDeployment,
+							Namespace: "ns2",
+						},
+					},
+				},
+			},
+		},
+		"wrong reverse": {
+			confFile:       "wrong-reverse.yaml",
+			wantErrMatches: []string{"reverse needs a k8sResource destination"},
+		},
+		"reverse from a node": {
+			confFile: "reverse-from-node.yaml",
+			wantErrMatches: []string{
+				"invalid reverse test: k8sResource of kind node in src needs the namespace of its probe Pod",
+			},
+		},
+		"reverse": {
+			confFile: "reverse.yaml",
+			want: Tests{
+				&Test{
+					Name:           "web-to-db-one-way",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     5432,
+					Reverse:        &Reverse{TargetPort: 8080, ExitCode: ptr(1)},
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "web",
+							Kind:      KindDeployment,
+							Namespace: "web",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "db",
+							Kind:      KindStatefulSet,
+							Namespace: "db",
+						},
+					},
+				},
+			},
+		},
+		"expect contradicting the exitCode": {
+			confFile:       "wrong-expect.yaml",
+			wantErrMatches: []string{"exitCode 1 contradicts expect allowed, set only one of them"},
+		},
+		"explicit exitCode of 0 contradicting expect": {
+			confFile:       "zero-exit-code-expect.yaml",
+			wantErrMatches: []string{"exitCode 0 contradicts expect denied, set only one of them"},
+		},
+		"unknown expect": {
+			confFile:       "unknown-expect.yaml",
+			wantErrMatches: []string{`invalid expect "blocked"`},
+		},
+		"expect refused of a udp test": {
+			confFile:       "udp-expect-refused.yaml",
+			wantErrMatches: []string{"expect refused is not supported by udp tests without a udpProbe"},
+		},
+		"expect": {
+			confFile: "expect.yaml",
+			want: Tests{
+				&Test{
+					Name:           "web-to-db-blocked-by-policy",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     5432,
+					ExitCode:       1,
+					Expect:         ExpectTimeout,
+					Reverse:        &Reverse{Expect: ExpectRefused},
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "web",
+							Kind:      KindDeployment,
+							Namespace: "web",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "db",
+							Kind:      KindStatefulSet,
+							Namespace: "db",
+						},
+					},
+				},
+			},
+		},
+		"wrong retries": {
+			confFile: "wrong-retries.yaml",
+			wantErrMatches: []string{
+				"retries out of range: 11, must be between 0 and 10",
+				`invalid retryBackoff "soon"`,
+				`invalid containerOverhead "-5s"`,
+			},
+		},
+		"retries": {
+			confFile: "retries.yaml",
+			want: Tests{
+				&Test{
+					Name:           "web-to-api-retried",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     8080,
+					Retries:        ptr(2),
+					RetryBackoff:   "10s",
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "web",
+							Kind:      KindDeployment,
+							Namespace: "web",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "api",
+							Kind:      KindDeployment,
+							Namespace: "api",
+						},
+					},
+				},
+			},
+		},
+		"wrong thresholds": {
+			confFile: "wrong-thresholds.yaml",
+			wantErrMatches: []string{
+				`invalid maxConnectLatency "fast"`,
+				`invalid throughput "10MB/s"`,
+				"latency and throughput thresholds need an exitCode of 0",
+			},
+		},
+		"thresholds of a udp test": {
+			confFile: "udp-thresholds.yaml",
+			wantErrMatches: []string{
+				"transferBytes is only supported together with minThroughput",
+				"latency and throughput thresholds are only supported by tcp tests",
+			},
+		},
+		"thresholds": {
+			confFile: "thresholds.yaml",
+			want: Tests{
+				&Test{
+					Name:              "web-to-api-fast-path",
+					Type:              "k8s",
+					Protocol:          ProtocolTCP,
+					Attempts:          3,
+					TimeoutSeconds:    15,
+					TargetPort:        8080,
+					MaxConnectLatency: "50ms",
+					MinThroughput:     "100Mbps",
+					TransferBytes:     4194304,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "web",
+							Kind:      KindDeployment,
+							Namespace: "web",
+						},
+					},
+					Dst: &Dst{
+						K8sResource: &K8sResource{
+							Name:      "api",
+							Kind:      KindDeployment,
+							Namespace: "api",
+						},
+					},
+				},
+			},
+		},
+		"container settings": {
+			confFile: "containers.yaml",
+			want: Tests{
+				&Test{
+					Name:           "testname-containers",
+					Type:           "k8s",
+					Protocol:       ProtocolTCP,
+					Attempts:       3,
+					TimeoutSeconds: 15,
+					TargetPort:     80,
+					Src: &Src{
+						K8sResource: &K8sResource{
+							Name:      "deployment1",
+							Kind:      KindDeployment,
+							Namespace: "ns1",
+							Container: "app",
+						},
+					},
+					Dst: &Dst{
+						Host: &Host{
+							Name: "1.1.1.1",
+						},
+					},
+					Containers: &Containers{
+						ScannerImage:     "registry.example.com/netassertv2-l4-client:latest",
+						ImagePullPolicy:  "IfNotPresent",
+						ImagePullSecrets: []string{"registry-mirror"},
+						Resources: &Resources{
+							Requests: map[string]string{"cpu": "10m", "memory": "32Mi"},
+							Limits:   map[string]string{"memory": "64Mi"},
+						},
+					},
+				},
+			},
+		},
 		"multi valid": {
 			confFile: "multi.yaml",
 			want: Tests{
@@ -149,3 +654,243 @@ func TestNewFromReader(t *testing.T) {
 		})
 	}
 }
+
+func TestTest_IPFamilySubTests(t *testing.T) {
+	r := require.New(t)
+
+	te := &Test{Name: "dual-stack", IPFamily: IPFamilyIPv4, Pass: true}
+	r.Nil(te.IPFamilySubTests())
+
+	te.IPFamily = IPFamilyBoth
+	subTests := te.IPFamilySubTests()
+	r.Len(subTests, 2)
+	r.Equal("dual-stack [ipv4]", subTests[0].Name)
+	r.Equal(IPFamilyIPv4, subTests[0].IPFamily)
+	r.Equal("dual-stack [ipv6]", subTests[1].Name)
+	r.Equal(IPFamilyIPv6, subTests[1].IPFamily)
+	r.False(subTests[1].Pass)
+
+	r.Equal("2606:4700:4700::1111", (&Host{Name: "[2606:4700:4700::1111]"}).Target())
+	r.Equal("example.com", (&Host{Name: "example.com"}).Target())
+}
+
+func TestHosts_Targets(t *testing.T) {
+	tests := map[string]struct {
+		hosts *Hosts
+		want  []string
+	}{
+		"all the names": {
+			hosts: &Hosts{Names: []string{"example.com", "[fd00::1]"}},
+			want:  []string{"example.com", "[fd00::1]"},
+		},
+		"first names": {
+			hosts: &Hosts{Names: []string{"a.example.com", "b.example.com"}, Sample: SamplingFirst},
+			want:  []string{"a.example.com"},
+		},
+		"all the usable addresses of an IPv4 cidr": {
+			hosts: &Hosts{CIDR: "192.168.0.0/30"},
+			want:  []string{"192.168.0.1", "192.168.0.2"},
+		},
+		"both addresses of a /31": {
+			hosts: &Hosts{CIDR: "192.168.0.0/31"},
+			want:  []string{"192.168.0.0", "192.168.0.1"},
+		},
+		"first addresses of a non masked cidr": {
+			hosts: &Hosts{CIDR: "10.1.2.3/8", Sample: SamplingFirst, Count: 3},
+			want:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		"first addresses of an IPv6 cidr": {
+			hosts: &Hosts{CIDR: "fd00::/64", Sample: SamplingFirst, Count: 2},
+			want:  []string{"fd00::1", "fd00::2"},
+		},
+		"count larger than the cidr": {
+			hosts: &Hosts{CIDR: "192.168.0.0/30", Sample: SamplingRandom, Count: 10},
+			want:  []string{"192.168.0.1", "192.168.0.2"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.hosts.Targets()
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("random addresses", func(t *testing.T) {
+		r := require.New(t)
+		hosts := &Hosts{CIDR: "10.0.0.0/8", Sample: SamplingRandom, Count: 20}
+
+		got, err := hosts.Targets()
+		r.NoError(err)
+		r.Len(got, 20)
+
+		prefix := netip.MustParsePrefix(hosts.CIDR)
+		seen := map[string]bool{}
+		for _, target := range got {
+			addr := netip.MustParseAddr(target)
+			r.True(prefix.Contains(addr))
+			r.NotEqual("10.0.0.0", target)
+			r.NotEqual("10.255.255.255", target)
+			r.False(seen[target])
+			seen[target] = true
+		}
+	})
+
+	t.Run("random addresses of an IPv6 /48", func(t *testing.T) {
+		r := require.New(t)
+		got, err := (&Hosts{CIDR: "fd00:1::/48", Sample: SamplingRandom, Count: 5}).Targets()
+		r.NoError(err)
+		r.Len(got, 5)
+		for _, target := range got {
+			r.True(netip.MustParsePrefix("fd00:1::/48").Contains(netip.MustParseAddr(target)))
+		}
+	})
+}
+
+func TestTest_HostSubTests(t *testing.T) {
+	r := require.New(t)
+
+	te := &Test{Name: "egress", Dst: &Dst{Host: &Host{Name: "example.com"}}}
+	subTests, err := te.HostSubTests()
+	r.NoError(err)
+	r.Nil(subTests)
+
+	te = &Test{
+		Name:          "egress",
+		FailureReason: "failed",
+		Dst:           &Dst{Hosts: &Hosts{Names: []string{"example.com", "1.1.1.1"}}},
+	}
+	subTests, err = te.HostSubTests()
+	r.NoError(err)
+	r.Len(subTests, 2)
+	r.Equal("egress [example.com]", subTests[0].Name)
+	r.Equal(&Dst{Host: &Host{Name: "example.com"}}, subTests[0].Dst)
+	r.Equal("egress [1.1.1.1]", subTests[1].Name)
+	r.Empty(subTests[1].FailureReason)
+
+	// the results are broken down per target
+	te.SubTests = subTests
+	res := te.Result()
+	r.Equal(&EndpointResult{Hosts: "example.com,1.1.1.1"}, res.Dst)
+	r.Len(res.SubTests, 2)
+	r.Equal("1.1.1.1", res.SubTests[1].Dst.Host)
+}
+
+func TestTest_DirectionSubTests(t *testing.T) {
+	r := require.New(t)
+
+	web := &K8sResource{Kind: KindDeployment, Name: "web", Namespace: "web"}
+	db := &K8sResource{Kind: KindStatefulSet, Name: "db", Namespace: "db"}
+
+	te := &Test{Name: "web-to-db", TargetPort: 5432, Src: &Src{K8sResource: web}, Dst: &Dst{K8sResource: db}}
+	r.Nil(te.DirectionSubTests())
+
+	te.Reverse = &Reverse{}
+	te.ExpectedSourceIP = "10.10.0.5"
+	subTests := te.DirectionSubTests()
+	r.Len(subTests, 2)
+
+	forward, reverse := subTests[0], subTests[1]
+	r.Equal("web-to-db [forward]", forward.Name)
+	r.Equal(DirectionForward, forward.Direction)
+	r.Nil(forward.Reverse)
+	r.Equal(web, forward.Src.K8sResource)
+	r.Equal("10.10.0.5", forward.ExpectedSourceIP)
+
+	// the reverse test has the expectations of the test unless they are overridden
+	r.Equal("web-to-db [reverse]", reverse.Name)
+	r.Equal(DirectionReverse, reverse.Direction)
+	r.Equal(db, reverse.Src.K8sResource)
+	r.Equal(web, reverse.Dst.K8sResource)
+	r.Equal(5432, reverse.TargetPort)
+	r.Equal(0, reverse.ExitCode)
+	r.Empty(reverse.ExpectedSourceIP)
+
+	te.Reverse = &Reverse{TargetPort: 8080, ExitCode: ptr(1)}
+	reverse = te.ReverseTest()
+	r.Equal(8080, reverse.TargetPort)
+	r.Equal(1, reverse.ExitCode)
+	r.Equal(DirectionReverse, reverse.Result().Direction)
+}
+
+func TestExpect(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(0, ExpectAllowed.ExitCode())
+	r.Equal(1, ExpectDenied.ExitCode())
+	r.Equal(1, ExpectDropped.ExitCode())
+
+	r.True(ExpectDenied.Matches(OutcomeRefused))
+	r.True(ExpectDenied.Matches(OutcomeTimeout))
+	r.False(ExpectDenied.Matches(OutcomeConnected))
+	r.False(ExpectDenied.Matches(OutcomeError))
+	r.True(ExpectDropped.Matches(OutcomeNotReceived))
+	r.False(ExpectDropped.Matches(OutcomeRefused))
+	r.False(ExpectTimeout.Matches(OutcomeReset))
+
+	r.False(ExpectAllowed.NeedsOutcome())
+	r.False(ExpectDenied.NeedsOutcome())
+	r.True(ExpectRefused.NeedsOutcome())
+
+	// the expectation of the reverse test overrides the one of the test
+	te := &Test{
+		Name:     "web-to-db",
+		ExitCode: 1,
+		Expect:   ExpectTimeout,
+		Src:      &Src{K8sResource: &K8sResource{Kind: KindDeployment, Name: "web", Namespace: "web"}},
+		Dst:      &Dst{K8sResource: &K8sResource{Kind: KindStatefulSet, Name: "db", Namespace: "db"}},
+		Reverse:  &Reverse{Expect: ExpectAllowed},
+	}
+	reverse := te.ReverseTest()
+	r.Equal(ExpectAllowed, reverse.Expect)
+	r.Equal(0, reverse.ExitCode)
+
+	te.Reverse = &Reverse{ExitCode: ptr(0)}
+	reverse = te.ReverseTest()
+	r.Empty(reverse.Expect)
+	r.Equal(0, reverse.ExitCode)
+}
+
+func TestTest_ContainerTimeout(t *testing.T) {
+	r := require.New(t)
+
+	// the overhead of the run applies to the tests that do not set their own
+	te := &Test{Name: "web-to-api", TimeoutSeconds: 15}
+	r.Equal(38*time.Second, te.ContainerTimeout(23*time.Second))
+
+	te.ContainerOverhead = "1m"
+	r.Equal(75*time.Second, te.ContainerTimeout(23*time.Second))
+
+	te.ContainerOverhead = "0s"
+	r.Equal(15*time.Second, te.ContainerTimeout(23*time.Second))
+}
+
+func TestTest_Retries(t *testing.T) {
+	r := require.New(t)
+
+	// the retry policy of the run applies to the tests that do not set their own
+	te := &Test{Name: "web-to-api"}
+	retries, backoff := te.RetryPolicy(1, 5*time.Second)
+	r.Equal(1, retries)
+	r.Equal(5*time.Second, backoff)
+
+	te.Retries = ptr(0)
+	te.RetryBackoff = "1s"
+	retries, backoff = te.RetryPolicy(1, 5*time.Second)
+	r.Equal(0, retries)
+	r.Equal(time.Second, backoff)
+
+	// a test is flaky when it passed after being retried, or when one of its sub-tests did
+	r.False(te.Flaky())
+	te.Observe().Runs = 2
+	te.Observation.Flaky = true
+	r.True(te.Flaky())
+	r.True(te.Result().Flaky)
+	r.Equal(2, te.Result().Runs)
+
+	parent := &Test{Name: "web-to-api", Pass: true, SubTests: Tests{{Name: "web-to-api [ipv4]", Pass: true}, te}}
+	r.True(parent.Flaky())
+	te.Observation.Flaky = false
+	r.False(parent.Flaky())
+}
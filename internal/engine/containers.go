@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
+)
+
+// ContainerConfig - run level configuration of the injected scanner and sniffer containers
+type ContainerConfig struct {
+	Settings              kubeops.ContainerSettings // settings applied to all the injected containers
+	ScannerImageOverrides map[string]string         // scanner image to use for Pods in a namespace
+	SnifferImageOverrides map[string]string         // sniffer image to use for Pods in a namespace
+	ImagePullSecrets      []string                  // image pull secrets that the target Pods must reference
+}
+
+// containerSettings - returns the settings of the injected containers for a test, the per test
+// settings take precedence over the run level ones
+func (e *Engine) containerSettings(te *data.Test) (kubeops.ContainerSettings, error) {
+	settings := e.Containers.Settings
+
+	if te.Containers == nil {
+		return settings, nil
+	}
+
+	if te.Containers.ImagePullPolicy != "" {
+		settings.ImagePullPolicy = corev1.PullPolicy(te.Containers.ImagePullPolicy)
+	}
+
+	if te.Containers.Resources != nil {
+		requests, err := kubeops.ParseResourceList(te.Containers.Resources.Requests)
+		if err != nil {
+			return settings, fmt.Errorf("invalid resource requests for test %s: %w", te.Name, err)
+		}
+
+		limits, err := kubeops.ParseResourceList(te.Containers.Resources.Limits)
+		if err != nil {
+			return settings, fmt.Errorf("invalid resource limits for test %s: %w", te.Name, err)
+		}
+
+		settings.Resources = corev1.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+
+	return settings, nil
+}
+
+// ephemeralContainerSettings - returns the settings of the injected ephemeral containers for a test
+func (e *Engine) ephemeralContainerSettings(te *data.Test) (kubeops.ContainerSettings, error) {
+	settings, err := e.containerSettings(te)
+	if err != nil {
+		return settings, err
+	}
+
+	if settings.HasResources() && !e.Service.SupportsContainerResources() {
+		e.Log.Warn("Resources cannot be set on ephemeral containers and will be ignored", "testName", te.Name)
+	}
+
+	return settings, nil
+}
+
+// scannerImage - returns the scanner image used for a test whose scanner is injected in a Pod in namespace
+func (e *Engine) scannerImage(te *data.Test, namespace, defaultImage string) string {
+	if te.Containers != nil && te.Containers.ScannerImage != "" {
+		return te.Containers.ScannerImage
+	}
+
+	if image, ok := e.Containers.ScannerImageOverrides[namespace]; ok {
+		return image
+	}
+
+	return defaultImage
+}
+
+// snifferImage - returns the sniffer image used for a test whose sniffer is injected in a Pod in namespace
+func (e *Engine) snifferImage(te *data.Test, namespace, defaultImage string) string {
+	if te.Containers != nil && te.Containers.SnifferImage != "" {
+		return te.Containers.SnifferImage
+	}
+
+	if image, ok := e.Containers.SnifferImageOverrides[namespace]; ok {
+		return image
+	}
+
+	return defaultImage
+}
+
+// imagePullSecrets - returns the image pull secrets needed by a test, the per test ones take precedence
+func (e *Engine) imagePullSecrets(te *data.Test) []string {
+	if te.Containers != nil && len(te.Containers.ImagePullSecrets) > 0 {
+		return te.Containers.ImagePullSecrets
+	}
+
+	return e.Containers.ImagePullSecrets
+}
+
+// checkImagePullSecrets - ensures that the Pod references all the image pull secrets needed by a test,
+// ephemeral containers can only use the image pull secrets of the Pod they are injected in
+func (e *Engine) checkImagePullSecrets(te *data.Test, pod *corev1.Pod) error {
+	for _, secret := range e.imagePullSecrets(te) {
+		found := slices.ContainsFunc(pod.Spec.ImagePullSecrets, func(ref corev1.LocalObjectReference) bool {
+			return ref.Name == secret
+		})
+
+		if !found {
+			return fmt.Errorf("pod %s in namespace %s does not reference the image pull secret %q required by test %s",
+				pod.Name, pod.Namespace, secret, te.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkTargetContainer - ensures that the container referenced by the K8sResource exists in the resolved Pod
+func checkTargetContainer(res *data.K8sResource, pod *corev1.Pod) error {
+	if res == nil || res.Container == "" {
+		return nil
+	}
+
+	found := slices.ContainsFunc(pod.Spec.Containers, func(c corev1.Container) bool {
+		return c.Name == res.Container
+	})
+
+	if !found {
+		return fmt.Errorf("container %q does not exist in pod %s in namespace %s resolved from %s %s",
+			res.Container, pod.Name, pod.Namespace, res.Kind, res.Name)
+	}
+
+	return nil
+}
+
+// collectContainerLogs - attaches the tail of the logs of an injected container to the test,
+// failing to fetch the logs does not fail the test
+func (e *Engine) collectContainerLogs(ctx context.Context, te *data.Test, containerName string, pod *corev1.Pod) {
+	e.collectLogs(ctx, te, containerName, pod, e.Service.GetEphemeralContainerLogs)
+}
+
+// logsFunc - returns the tail of the logs of a container, at most maxBytes long
+type logsFunc func(ctx context.Context, containerName string, maxBytes int64, podName, podNamespace string) (string, error)
+
+// collectLogs - attaches the tail of the logs of a container returned by getLogs to the test
+func (e *Engine) collectLogs(
+	ctx context.Context, // the context
+	te *data.Test, // the test
+	containerName string, // name of the container
+	pod *corev1.Pod, // the Pod running the container
+	getLogs logsFunc, // returns the logs of the container
+) {
+	if e.LogsMaxBytes <= 0 || containerName == "" || pod == nil {
+		return
+	}
+
+	logs, err := getLogs(ctx, containerName, e.LogsMaxBytes, pod.Name, pod.Namespace)
+	if err != nil {
+		e.Log.Warn("Unable to collect the logs of the ephemeral container",
+			"testName", te.Name, "containerName", containerName, "error", err)
+		return
+	}
+
+	te.ContainerLogs = append(te.ContainerLogs, data.ContainerLog{
+		Container: containerName,
+		Pod:       pod.Name,
+		Namespace: pod.Namespace,
+		Log:       logs,
+	})
+}
+
+// releaseContainer - releases the resources held by the backend for a container once the test is over
+func (e *Engine) releaseContainer(ctx context.Context, te *data.Test, containerName string, pod *corev1.Pod) {
+	releaser, ok := e.Service.(ContainerReleaser)
+	if !ok || containerName == "" || pod == nil {
+		return
+	}
+
+	if err := releaser.ReleaseContainer(ctx, pod, containerName); err != nil {
+		e.Log.Warn("Unable to release the container", "testName", te.Name, "containerName", containerName,
+			"pod", podRef(pod), "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
+)
+
+func TestEngine_ContainerConfig(t *testing.T) {
+	eng := New(nil, hclog.NewNullLogger())
+	eng.Containers = ContainerConfig{
+		Settings:              kubeops.ContainerSettings{ImagePullPolicy: corev1.PullAlways},
+		ScannerImageOverrides: map[string]string{"mirror": "mirror.example.com/scanner:latest"},
+		SnifferImageOverrides: map[string]string{"mirror": "mirror.example.com/sniffer:latest"},
+		ImagePullSecrets:      []string{"mirror-creds"},
+	}
+
+	t.Run("images are overridden per namespace", func(t *testing.T) {
+		r := require.New(t)
+		te := &data.Test{Name: "test"}
+
+		r.Equal("mirror.example.com/scanner:latest", eng.scannerImage(te, "mirror", "scanner:latest"))
+		r.Equal("mirror.example.com/sniffer:latest", eng.snifferImage(te, "mirror", "sniffer:latest"))
+		r.Equal("scanner:latest", eng.scannerImage(te, "other", "scanner:latest"))
+		r.Equal("sniffer:latest", eng.snifferImage(te, "other", "sniffer:latest"))
+	})
+
+	t.Run("per test images take precedence", func(t *testing.T) {
+		r := require.New(t)
+		te := &data.Test{Name: "test", Containers: &data.Containers{ScannerImage: "custom:1"}}
+
+		r.Equal("custom:1", eng.scannerImage(te, "mirror", "scanner:latest"))
+	})
+
+	t.Run("per test settings take precedence", func(t *testing.T) {
+		r := require.New(t)
+		te := &data.Test{Name: "test", Containers: &data.Containers{
+			ImagePullPolicy: "Never",
+			Resources:       &data.Resources{Limits: map[string]string{"memory": "64Mi"}},
+		}}
+
+		settings, err := eng.containerSettings(te)
+		r.NoError(err)
+		r.Equal(corev1.PullNever, settings.ImagePullPolicy)
+		r.True(settings.HasResources())
+
+		settings, err = eng.containerSettings(&data.Test{Name: "test"})
+		r.NoError(err)
+		r.Equal(corev1.PullAlways, settings.ImagePullPolicy)
+		r.False(settings.HasResources())
+	})
+
+	t.Run("pod must reference the image pull secrets", func(t *testing.T) {
+		r := require.New(t)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "mirror"},
+			Spec: corev1.PodSpec{
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "mirror-creds"}},
+			},
+		}
+
+		r.NoError(eng.checkImagePullSecrets(&data.Test{Name: "test"}, pod))
+
+		te := &data.Test{Name: "test", Containers: &data.Containers{ImagePullSecrets: []string{"other-creds"}}}
+		err := eng.checkImagePullSecrets(te, pod)
+		r.Error(err)
+		r.Contains(err.Error(), `does not reference the image pull secret "other-creds"`)
+	})
+
+	t.Run("target container must exist in the pod", func(t *testing.T) {
+		r := require.New(t)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns1"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}, {Name: "istio-proxy"}},
+			},
+		}
+		res := &data.K8sResource{Kind: data.KindDeployment, Name: "deploy1", Namespace: "ns1"}
+
+		r.NoError(checkTargetContainer(res, pod))
+
+		res.Container = "istio-proxy"
+		r.NoError(checkTargetContainer(res, pod))
+
+		res.Container = "sidecar"
+		err := checkTargetContainer(res, pod)
+		r.Error(err)
+		r.Contains(err.Error(), `container "sidecar" does not exist in pod pod`)
+	})
+}
@@ -1,9 +1,10 @@
-//go:generate mockgen -destination=engine_mocks_test.go -package=engine github.com/controlplaneio/netassert/internal/engine NetAssertTestRunner
+//go:generate mockgen -destination=engine_mocks_test.go -package=engine github.com/controlplaneio/netassert/v2/internal/engine NetAssertTestRunner
 
 package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,17 +13,42 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
 )
 
 // Engine - type responsible for running the netAssert test(s)
 type Engine struct {
-	Service NetAssertTestRunner
-	Log     hclog.Logger
+	Service    NetAssertTestRunner
+	Log        hclog.Logger
+	Containers ContainerConfig // run level configuration of the injected containers
+	// LogsMaxBytes is the maximum size of the logs of each injected container attached to a test,
+	// the logs are not collected when it is zero
+	LogsMaxBytes int64
+	// Retries and RetryBackoff are the retry policy of the tests that do not set their own
+	Retries      int
+	RetryBackoff time.Duration
+	// FlakyIsFailure fails the tests that only pass after being retried
+	FlakyIsFailure bool
+	// ContainerOverhead is the time given to the injected containers of a test to be scheduled, to pull
+	// their images and to start, on top of the timeout of the test
+	ContainerOverhead time.Duration
 }
 
+const (
+	// DefaultRetryBackoff - delay before the first retry of a failed test by default, doubled after each retry
+	DefaultRetryBackoff = 5 * time.Second
+	// DefaultContainerOverhead - time given to the injected containers to come online by default
+	DefaultContainerOverhead = 23 * time.Second
+)
+
 // New - Returns a new instance of Engine
 func New(service NetAssertTestRunner, log hclog.Logger) *Engine {
-	return &Engine{Service: service, Log: log}
+	return &Engine{
+		Service:           service,
+		Log:               log,
+		RetryBackoff:      DefaultRetryBackoff,
+		ContainerOverhead: DefaultContainerOverhead,
+	}
 }
 
 // GetPod - returns a running Pod defined by the K8sResource
@@ -46,6 +72,17 @@ func (e *Engine) GetPod(ctx context.Context, res *data.K8sResource) (*corev1.Pod
 	}
 }
 
+// containerTimeout - returns the maximum duration to wait for the exit status of an injected container of
+// a test, i.e. the timeout of the test and the overhead of the containers, the one of the engine by default
+func (e *Engine) containerTimeout(te *data.Test) time.Duration {
+	return te.ContainerTimeout(e.ContainerOverhead)
+}
+
+// podRef - returns the namespace/name reference of a Pod
+func podRef(pod *corev1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
 // RunTests - runs a list of net assert test cases
 func (e *Engine) RunTests(
 	ctx context.Context, // context information
@@ -61,12 +98,19 @@ func (e *Engine) RunTests(
 	var wg sync.WaitGroup
 
 	for i, tc := range te {
+		if tc.Skipped() {
+			e.Log.Info("⏭ Skipping test", "Name", tc.Name, "reason", tc.Skip)
+			continue
+		}
+
 		wg.Add(1)
 		go func(tc *data.Test, wg *sync.WaitGroup) {
 			defer wg.Done()
+			start := time.Now()
 			// run the test case
 			err := e.RunTest(ctx, tc, snifferContainerPrefix, snifferContainerImage,
 				scannerContainerPrefix, scannerContainerImage, suffixLength, packetCaptureInterface)
+			tc.Observe().Duration = time.Since(start)
 			if err != nil {
 				e.Log.Error("Test execution failed", "Name", tc.Name, "error", err)
 				tc.FailureReason = err.Error()
@@ -105,6 +149,26 @@ func cancellableDelay(ctx context.Context, duration time.Duration) {
 	}
 }
 
+// subTestsOf - returns the tests a test fans out into, the test is run once for each target of its dst
+// hosts, in both directions or for each IP family, and label returns what tells the sub-tests apart.
+// The sub-tests can fan out again, e.g. a test run in both directions for each IP family.
+func subTestsOf(te *data.Test) (data.Tests, func(sub *data.Test) string, error) {
+	subTests, err := te.HostSubTests()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid destination of test %s: %w", te.Name, err)
+	}
+
+	if len(subTests) > 0 {
+		return subTests, func(sub *data.Test) string { return sub.Dst.Host.Name }, nil
+	}
+
+	if subTests := te.DirectionSubTests(); len(subTests) > 0 {
+		return subTests, func(sub *data.Test) string { return string(sub.Direction) }, nil
+	}
+
+	return te.IPFamilySubTests(), func(sub *data.Test) string { return string(sub.IPFamily) }, nil
+}
+
 // RunTest - Runs a single netAssert test case
 func (e *Engine) RunTest(
 	ctx context.Context, // context passed to this function
@@ -120,21 +184,86 @@ func (e *Engine) RunTest(
 		return fmt.Errorf("only k8s test type is supported at this time: %s", te.Type)
 	}
 
-	switch te.Protocol {
-	case data.ProtocolTCP:
-		return e.RunTCPTest(ctx, te, scannerContainerPrefix, scannerContainerImage, suffixLength)
-	case data.ProtocolUDP:
-		return e.RunUDPTest(ctx,
-			te,
-			snifferContainerPrefix,
-			snifferContainerImage,
-			scannerContainerPrefix,
-			scannerContainerImage,
-			suffixLength,
-			packetCaptureInterface,
-		)
-	default:
-		e.Log.Error("error", hclog.Fmt("Only TCP/UDP protocol is supported at this time and not %s", te.Protocol))
-		return fmt.Errorf("only TCP/UDP protocol is supported at this time and not %v", te.Protocol)
+	subTests, label, err := subTestsOf(te)
+	if err != nil {
+		return err
 	}
+
+	if len(subTests) > 0 {
+		var errs []error
+		for _, sub := range subTests {
+			start := time.Now()
+			err := e.RunTest(ctx, sub, snifferContainerPrefix, snifferContainerImage, scannerContainerPrefix,
+				scannerContainerImage, suffixLength, packetCaptureInterface)
+			sub.Observe().Duration = time.Since(start)
+			if err != nil {
+				sub.FailureReason = err.Error()
+				errs = append(errs, fmt.Errorf("%s: %w", label(sub), err))
+			}
+		}
+
+		// the test passes when all its sub-tests pass
+		te.SubTests = subTests
+		te.Observe()
+		te.Pass = len(errs) == 0
+		return errors.Join(errs...)
+	}
+
+	return e.runWithRetries(ctx, te, func() error {
+		switch te.Protocol {
+		case data.ProtocolTCP:
+			return e.RunTCPTest(ctx, te, scannerContainerPrefix, scannerContainerImage, suffixLength)
+		case data.ProtocolUDP:
+			return e.RunUDPTest(ctx,
+				te,
+				snifferContainerPrefix,
+				snifferContainerImage,
+				scannerContainerPrefix,
+				scannerContainerImage,
+				suffixLength,
+				packetCaptureInterface,
+			)
+		default:
+			e.Log.Error("error", hclog.Fmt("Only TCP/UDP protocol is supported at this time and not %s", te.Protocol))
+			return fmt.Errorf("only TCP/UDP protocol is supported at this time and not %v", te.Protocol)
+		}
+	})
+}
+
+// runWithRetries - runs a test, and runs it again from scratch after a backoff when it fails, i.e. with a
+// new Pod selection and new containers, until the retries of the test are exhausted or the images of its
+// containers cannot be pulled. A test passing after a retry is flaky, and fails when FlakyIsFailure is set
+func (e *Engine) runWithRetries(ctx context.Context, te *data.Test, run func() error) error {
+	retries, backoff := te.RetryPolicy(e.Retries, e.RetryBackoff)
+
+	var err error
+	for runs := 1; ; runs++ {
+		// what was observed by a failed run, and the logs of its containers, do not apply to the next one
+		te.Observation = &data.Observation{Runs: runs}
+		te.ContainerLogs = nil
+
+		// the images of the containers are not pulled any better by new containers
+		err = run()
+		if err == nil || runs > retries || ctx.Err() != nil || errors.Is(err, kubeops.ErrContainerNotStarted) {
+			break
+		}
+
+		e.Log.Warn("Retrying failed test", "Name", te.Name, "run", runs, "retries", retries,
+			"backoff", backoff, "error", err)
+		cancellableDelay(ctx, backoff)
+		backoff *= 2
+	}
+
+	if err != nil || te.Observation.Runs == 1 {
+		return err
+	}
+
+	te.Observation.Flaky = true
+	e.Log.Warn("Test passed after being retried", "Name", te.Name, "runs", te.Observation.Runs)
+	if e.FlakyIsFailure {
+		te.Pass = false
+		return fmt.Errorf("test %s is flaky, it only passed after %d runs", te.Name, te.Observation.Runs)
+	}
+
+	return nil
 }
@@ -1,5 +1,10 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/controlplaneio/netassert/internal/engine (interfaces: NetAssertTestRunner)
+// Source: github.com/controlplaneio/netassert/v2/internal/engine (interfaces: NetAssertTestRunner)
+//
+// Generated by this command:
+//
+//	mockgen -destination=engine_mocks_test.go -package=engine github.com/controlplaneio/netassert/v2/internal/engine NetAssertTestRunner
+//
 
 // Package engine is a generated GoMock package.
 package engine
@@ -9,6 +14,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	kubeops "github.com/controlplaneio/netassert/v2/internal/kubeops"
 	gomock "go.uber.org/mock/gomock"
 	v1 "k8s.io/api/core/v1"
 )
@@ -37,50 +43,111 @@ func (m *MockNetAssertTestRunner) EXPECT() *MockNetAssertTestRunnerMockRecorder
 }
 
 // BuildEphemeralScannerContainer mocks base method.
-func (m *MockNetAssertTestRunner) BuildEphemeralScannerContainer(arg0, arg1, arg2, arg3, arg4, arg5 string, arg6 int) (*v1.EphemeralContainer, error) {
+func (m *MockNetAssertTestRunner) BuildEphemeralScannerContainer(arg0, arg1, arg2, arg3, arg4, arg5 string, arg6 int, arg7 kubeops.ContainerSettings) (*v1.EphemeralContainer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuildEphemeralScannerContainer", arg0, arg1, arg2, arg3, arg4, arg5, arg6)
+	ret := m.ctrl.Call(m, "BuildEphemeralScannerContainer", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
 	ret0, _ := ret[0].(*v1.EphemeralContainer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BuildEphemeralScannerContainer indicates an expected call of BuildEphemeralScannerContainer.
-func (mr *MockNetAssertTestRunnerMockRecorder) BuildEphemeralScannerContainer(arg0, arg1, arg2, arg3, arg4, arg5, arg6 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) BuildEphemeralScannerContainer(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildEphemeralScannerContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).BuildEphemeralScannerContainer), arg0, arg1, arg2, arg3, arg4, arg5, arg6)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildEphemeralScannerContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).BuildEphemeralScannerContainer), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
 }
 
 // BuildEphemeralSnifferContainer mocks base method.
-func (m *MockNetAssertTestRunner) BuildEphemeralSnifferContainer(arg0, arg1, arg2 string, arg3 int, arg4 string, arg5 int, arg6 string, arg7 int) (*v1.EphemeralContainer, error) {
+func (m *MockNetAssertTestRunner) BuildEphemeralSnifferContainer(arg0, arg1, arg2 string, arg3 int, arg4 string, arg5 int, arg6 string, arg7 int, arg8 string, arg9 kubeops.ContainerSettings) (*v1.EphemeralContainer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuildEphemeralSnifferContainer", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+	ret := m.ctrl.Call(m, "BuildEphemeralSnifferContainer", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9)
 	ret0, _ := ret[0].(*v1.EphemeralContainer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BuildEphemeralSnifferContainer indicates an expected call of BuildEphemeralSnifferContainer.
-func (mr *MockNetAssertTestRunnerMockRecorder) BuildEphemeralSnifferContainer(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) BuildEphemeralSnifferContainer(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildEphemeralSnifferContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).BuildEphemeralSnifferContainer), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildEphemeralSnifferContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).BuildEphemeralSnifferContainer), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9)
+}
+
+// DeleteProbePod mocks base method.
+func (m *MockNetAssertTestRunner) DeleteProbePod(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProbePod", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProbePod indicates an expected call of DeleteProbePod.
+func (mr *MockNetAssertTestRunnerMockRecorder) DeleteProbePod(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProbePod", reflect.TypeOf((*MockNetAssertTestRunner)(nil).DeleteProbePod), arg0, arg1, arg2)
+}
+
+// GetEphemeralContainerLogs mocks base method.
+func (m *MockNetAssertTestRunner) GetEphemeralContainerLogs(arg0 context.Context, arg1 string, arg2 int64, arg3, arg4 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEphemeralContainerLogs", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEphemeralContainerLogs indicates an expected call of GetEphemeralContainerLogs.
+func (mr *MockNetAssertTestRunnerMockRecorder) GetEphemeralContainerLogs(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEphemeralContainerLogs", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetEphemeralContainerLogs), arg0, arg1, arg2, arg3, arg4)
 }
 
 // GetExitStatusOfEphemeralContainer mocks base method.
-func (m *MockNetAssertTestRunner) GetExitStatusOfEphemeralContainer(arg0 context.Context, arg1 string, arg2 time.Duration, arg3, arg4 string) (int, error) {
+func (m *MockNetAssertTestRunner) GetExitStatusOfEphemeralContainer(arg0 context.Context, arg1 string, arg2 time.Duration, arg3, arg4 string) (int, *kubeops.ContainerReport, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetExitStatusOfEphemeralContainer", arg0, arg1, arg2, arg3, arg4)
 	ret0, _ := ret[0].(int)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(*kubeops.ContainerReport)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetExitStatusOfEphemeralContainer indicates an expected call of GetExitStatusOfEphemeralContainer.
-func (mr *MockNetAssertTestRunnerMockRecorder) GetExitStatusOfEphemeralContainer(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) GetExitStatusOfEphemeralContainer(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExitStatusOfEphemeralContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetExitStatusOfEphemeralContainer), arg0, arg1, arg2, arg3, arg4)
 }
 
+// GetExitStatusOfProbeContainer mocks base method.
+func (m *MockNetAssertTestRunner) GetExitStatusOfProbeContainer(arg0 context.Context, arg1 string, arg2 time.Duration, arg3, arg4 string) (int, *kubeops.ContainerReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExitStatusOfProbeContainer", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*kubeops.ContainerReport)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetExitStatusOfProbeContainer indicates an expected call of GetExitStatusOfProbeContainer.
+func (mr *MockNetAssertTestRunnerMockRecorder) GetExitStatusOfProbeContainer(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExitStatusOfProbeContainer", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetExitStatusOfProbeContainer), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetNode mocks base method.
+func (m *MockNetAssertTestRunner) GetNode(arg0 context.Context, arg1 string, arg2 map[string]string) (*v1.Node, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*v1.Node)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNode indicates an expected call of GetNode.
+func (mr *MockNetAssertTestRunnerMockRecorder) GetNode(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNode", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetNode), arg0, arg1, arg2)
+}
+
 // GetPod mocks base method.
 func (m *MockNetAssertTestRunner) GetPod(arg0 context.Context, arg1, arg2 string) (*v1.Pod, error) {
 	m.ctrl.T.Helper()
@@ -91,7 +158,7 @@ func (m *MockNetAssertTestRunner) GetPod(arg0 context.Context, arg1, arg2 string
 }
 
 // GetPod indicates an expected call of GetPod.
-func (mr *MockNetAssertTestRunnerMockRecorder) GetPod(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) GetPod(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPod", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetPod), arg0, arg1, arg2)
 }
@@ -106,7 +173,7 @@ func (m *MockNetAssertTestRunner) GetPodInDaemonSet(arg0 context.Context, arg1,
 }
 
 // GetPodInDaemonSet indicates an expected call of GetPodInDaemonSet.
-func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInDaemonSet(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInDaemonSet(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodInDaemonSet", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetPodInDaemonSet), arg0, arg1, arg2)
 }
@@ -121,7 +188,7 @@ func (m *MockNetAssertTestRunner) GetPodInDeployment(arg0 context.Context, arg1,
 }
 
 // GetPodInDeployment indicates an expected call of GetPodInDeployment.
-func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInDeployment(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInDeployment(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodInDeployment", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetPodInDeployment), arg0, arg1, arg2)
 }
@@ -136,11 +203,26 @@ func (m *MockNetAssertTestRunner) GetPodInStatefulSet(arg0 context.Context, arg1
 }
 
 // GetPodInStatefulSet indicates an expected call of GetPodInStatefulSet.
-func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInStatefulSet(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) GetPodInStatefulSet(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodInStatefulSet", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetPodInStatefulSet), arg0, arg1, arg2)
 }
 
+// GetProbeContainerLogs mocks base method.
+func (m *MockNetAssertTestRunner) GetProbeContainerLogs(arg0 context.Context, arg1 string, arg2 int64, arg3, arg4 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProbeContainerLogs", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProbeContainerLogs indicates an expected call of GetProbeContainerLogs.
+func (mr *MockNetAssertTestRunnerMockRecorder) GetProbeContainerLogs(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProbeContainerLogs", reflect.TypeOf((*MockNetAssertTestRunner)(nil).GetProbeContainerLogs), arg0, arg1, arg2, arg3, arg4)
+}
+
 // LaunchEphemeralContainerInPod mocks base method.
 func (m *MockNetAssertTestRunner) LaunchEphemeralContainerInPod(arg0 context.Context, arg1 *v1.Pod, arg2 *v1.EphemeralContainer) (*v1.Pod, string, error) {
 	m.ctrl.T.Helper()
@@ -152,7 +234,37 @@ func (m *MockNetAssertTestRunner) LaunchEphemeralContainerInPod(arg0 context.Con
 }
 
 // LaunchEphemeralContainerInPod indicates an expected call of LaunchEphemeralContainerInPod.
-func (mr *MockNetAssertTestRunnerMockRecorder) LaunchEphemeralContainerInPod(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockNetAssertTestRunnerMockRecorder) LaunchEphemeralContainerInPod(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LaunchEphemeralContainerInPod", reflect.TypeOf((*MockNetAssertTestRunner)(nil).LaunchEphemeralContainerInPod), arg0, arg1, arg2)
 }
+
+// LaunchNodeProbe mocks base method.
+func (m *MockNetAssertTestRunner) LaunchNodeProbe(arg0 context.Context, arg1 *v1.Node, arg2 string, arg3 []string, arg4 *v1.EphemeralContainer, arg5 kubeops.ContainerSettings) (*v1.Pod, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LaunchNodeProbe", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(*v1.Pod)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// LaunchNodeProbe indicates an expected call of LaunchNodeProbe.
+func (mr *MockNetAssertTestRunnerMockRecorder) LaunchNodeProbe(arg0, arg1, arg2, arg3, arg4, arg5 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LaunchNodeProbe", reflect.TypeOf((*MockNetAssertTestRunner)(nil).LaunchNodeProbe), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// SupportsContainerResources mocks base method.
+func (m *MockNetAssertTestRunner) SupportsContainerResources() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SupportsContainerResources")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// SupportsContainerResources indicates an expected call of SupportsContainerResources.
+func (mr *MockNetAssertTestRunnerMockRecorder) SupportsContainerResources() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SupportsContainerResources", reflect.TypeOf((*MockNetAssertTestRunner)(nil).SupportsContainerResources))
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
 )
 
 // PodGetter - gets a running Pod from various kubernetes resources
@@ -25,6 +27,7 @@ type EphemeralContainerOperator interface {
 		protocol string, // protocol to used for connection
 		message string, // message to pass to the remote target
 		attempts int, // Number of attempts
+		settings kubeops.ContainerSettings, // optional settings of the container
 	) (*corev1.EphemeralContainer, error)
 
 	GetExitStatusOfEphemeralContainer(
@@ -33,7 +36,15 @@ type EphemeralContainerOperator interface {
 		timeOut time.Duration, // maximum duration to poll for the ephemeral container status
 		podName string, // name of the pod that houses the ephemeral container
 		podNamespace string, // namespace of the pod that houses the ephemeral container
-	) (int, error)
+	) (int, *kubeops.ContainerReport, error)
+
+	GetEphemeralContainerLogs(
+		ctx context.Context, // context passed to the function
+		containerName string, // name of the ephemeral container
+		maxBytes int64, // maximum number of bytes of the logs to return
+		podName string, // name of the pod that houses the ephemeral container
+		podNamespace string, // namespace of the pod that houses the ephemeral container
+	) (string, error)
 
 	BuildEphemeralSnifferContainer(
 		name string, // name of the ephemeral container
@@ -44,6 +55,8 @@ type EphemeralContainerOperator interface {
 		numberOfmatches int, // no. of matches
 		intFace string, // the network interface to read the packets from
 		timeoutSec int, // timeout for the ephemeral container in seconds
+		sourceCIDR string, // only the packets sent from this range of addresses match, all of them when empty
+		settings kubeops.ContainerSettings, // optional settings of the container
 	) (*corev1.EphemeralContainer, error)
 
 	LaunchEphemeralContainerInPod(
@@ -51,10 +64,54 @@ type EphemeralContainerOperator interface {
 		pod *corev1.Pod, // the target Pod
 		ec *corev1.EphemeralContainer, // the ephemeralContainer that needs to be injected to the Pod
 	) (*corev1.Pod, string, error)
+
+	// SupportsContainerResources - returns true when the resources of the containers are applied
+	SupportsContainerResources() bool
+}
+
+// NodeOperator - resolves the nodes and runs the scanner containers of the node sources in
+// hostNetwork probe Pods
+type NodeOperator interface {
+	GetNode(ctx context.Context, name string, selector map[string]string) (*corev1.Node, error)
+
+	LaunchNodeProbe(
+		ctx context.Context, // the context
+		node *corev1.Node, // the node the probe Pod runs on
+		namespace string, // namespace of the probe Pod
+		imagePullSecrets []string, // image pull secrets of the probe Pod
+		ec *corev1.EphemeralContainer, // the container run in the probe Pod
+		settings kubeops.ContainerSettings, // optional settings of the container
+	) (*corev1.Pod, string, error)
+
+	GetExitStatusOfProbeContainer(
+		ctx context.Context, // context passed to the function
+		containerName string, // name of the container
+		timeOut time.Duration, // maximum duration to poll for the container status
+		podName string, // name of the probe Pod
+		podNamespace string, // namespace of the probe Pod
+	) (int, *kubeops.ContainerReport, error)
+
+	GetProbeContainerLogs(
+		ctx context.Context, // context passed to the function
+		containerName string, // name of the container
+		maxBytes int64, // maximum number of bytes of the logs to return
+		podName string, // name of the probe Pod
+		podNamespace string, // namespace of the probe Pod
+	) (string, error)
+
+	DeleteProbePod(ctx context.Context, name, namespace string) error
 }
 
 // NetAssertTestRunner - runs netassert test case(s)
 type NetAssertTestRunner interface {
 	EphemeralContainerOperator
 	PodGetter
+	NodeOperator
+}
+
+// ContainerReleaser - implemented by the NetAssertTestRunner backends that hold resources for the
+// containers they launch, such as the probe Pods, which are released once the test is over
+type ContainerReleaser interface {
+	// ReleaseContainer - releases a container launched in pod by LaunchEphemeralContainerInPod
+	ReleaseContainer(ctx context.Context, pod *corev1.Pod, containerName string) error
 }
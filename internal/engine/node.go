@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
+)
+
+// source - the Pod or the node the scanner container of a test runs from
+type source struct {
+	res  *data.K8sResource // the source of the test
+	pod  *corev1.Pod       // the source Pod, or the probe Pod of the source node once it is launched
+	node *corev1.Node      // the source node, nil when the source is a Pod
+}
+
+// GetNode - returns a Ready node defined by the K8sResource of kind node
+func (e *Engine) GetNode(ctx context.Context, res *data.K8sResource) (*corev1.Node, error) {
+	if res == nil {
+		return nil, fmt.Errorf("res parameter is nil")
+	}
+
+	if res.Kind != data.KindNode {
+		return nil, fmt.Errorf("%s is not a node K8sResource", res.Kind)
+	}
+
+	return e.Service.GetNode(ctx, res.Name, res.Selector)
+}
+
+// getSource - resolves the source of a test to a running Pod, or to a Ready node
+func (e *Engine) getSource(ctx context.Context, te *data.Test) (*source, error) {
+	src := &source{res: te.Src.K8sResource}
+	obs := te.Observe()
+
+	if src.res.Kind == data.KindNode {
+		node, err := e.GetNode(ctx, src.res)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get source node for test %s: %w", te.Name, err)
+		}
+
+		src.node = node
+		obs.SrcNode = node.Name
+		return src, nil
+	}
+
+	pod, err := e.GetPod(ctx, src.res)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get source pod for test %s: %w", te.Name, err)
+	}
+
+	src.pod = pod
+	obs.SrcPod = podRef(pod)
+	return src, nil
+}
+
+// namespace - returns the namespace the scanner container runs in
+func (src *source) namespace() string {
+	if src.pod != nil {
+		return src.pod.Namespace
+	}
+
+	return src.res.Namespace
+}
+
+// getNodeTarget - returns the InternalIP address of a node destination in the IP family of the test
+func (e *Engine) getNodeTarget(ctx context.Context, te *data.Test) (string, error) {
+	node, err := e.GetNode(ctx, te.Dst.K8sResource)
+	if err != nil {
+		return "", fmt.Errorf("unable to get destination node for test %s: %w", te.Name, err)
+	}
+	te.Observe().DstNode = node.Name
+
+	ip, err := kubeops.NodeInternalIP(node, te.IPFamily)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination of test %s: %w", te.Name, err)
+	}
+
+	return ip, nil
+}
+
+// scannerSettings - returns the settings of the scanner container of a test, ensuring that it can be
+// injected in the source Pod. The scanner of a node runs in its own probe Pod, which references the
+// image pull secrets of the test.
+func (e *Engine) scannerSettings(
+	te *data.Test, // the test
+	src *source, // the source of the test
+	settings kubeops.ContainerSettings, // settings of the containers of the test
+) (kubeops.ContainerSettings, error) {
+	if src.node != nil {
+		return settings, nil
+	}
+
+	if err := e.checkImagePullSecrets(te, src.pod); err != nil {
+		return settings, err
+	}
+
+	if err := checkTargetContainer(src.res, src.pod); err != nil {
+		return settings, fmt.Errorf("invalid source of test %s: %w", te.Name, err)
+	}
+
+	settings.TargetContainerName = src.res.Container
+	return settings, nil
+}
+
+// launchScanner - launches the scanner container in the source Pod, or in a hostNetwork probe Pod on
+// the source node, src.pod is updated with the Pod running the container
+func (e *Engine) launchScanner(
+	ctx context.Context, // the context
+	te *data.Test, // the test
+	src *source, // the source of the test
+	ec *corev1.EphemeralContainer, // the scanner container
+	settings kubeops.ContainerSettings, // settings of the scanner container
+) (string, error) {
+	var (
+		pod  *corev1.Pod
+		name string
+		err  error
+	)
+
+	if src.node != nil {
+		pod, name, err = e.Service.LaunchNodeProbe(ctx, src.node, src.res.Namespace, e.imagePullSecrets(te), ec,
+			settings)
+	} else {
+		pod, name, err = e.Service.LaunchEphemeralContainerInPod(ctx, src.pod, ec)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	src.pod = pod
+	return name, nil
+}
+
+// scannerExitStatus - returns the exit status and the report of the scanner container launched by
+// launchScanner
+func (e *Engine) scannerExitStatus(
+	ctx context.Context, // the context
+	src *source, // the source of the test
+	containerName string, // name of the scanner container
+	timeout time.Duration, // maximum duration to poll for the container status
+) (int, *kubeops.ContainerReport, error) {
+	if src.node != nil {
+		return e.Service.GetExitStatusOfProbeContainer(ctx, containerName, timeout, src.pod.Name, src.pod.Namespace)
+	}
+
+	return e.Service.GetExitStatusOfEphemeralContainer(ctx, containerName, timeout, src.pod.Name, src.pod.Namespace)
+}
+
+// releaseScanner - collects the logs of the scanner container launched by launchScanner, and then
+// releases it or deletes the probe Pod of the source node
+func (e *Engine) releaseScanner(ctx context.Context, te *data.Test, src *source, containerName string) {
+	if src.node == nil {
+		e.collectContainerLogs(ctx, te, containerName, src.pod)
+		e.releaseContainer(ctx, te, containerName, src.pod)
+		return
+	}
+
+	e.collectLogs(ctx, te, containerName, src.pod, e.Service.GetProbeContainerLogs)
+
+	if err := e.Service.DeleteProbePod(ctx, src.pod.Name, src.pod.Namespace); err != nil {
+		e.Log.Warn("Unable to delete the node probe Pod", "testName", te.Name, "pod", podRef(src.pod),
+			"error", err)
+	}
+}
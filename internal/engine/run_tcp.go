@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/controlplaneio/netassert/v2/internal/data"
 	"github.com/controlplaneio/netassert/v2/internal/kubeops"
@@ -19,11 +18,6 @@ func (e *Engine) RunTCPTest(
 	scannerContainerImage string, // docker image location of the scanner container image
 	suffixLength int, // length of random string that will be appended to the ephemeral container name
 ) error {
-	var (
-		dstPod     *corev1.Pod
-		targetHost string
-	)
-
 	if te.Dst.Host != nil && te.Dst.K8sResource != nil {
 		return fmt.Errorf("both Dst.Host and Dst.K8sResource cannot be set at the same time")
 	}
@@ -42,22 +36,54 @@ func (e *Engine) RunTCPTest(
 
 	e.Log.Info("🟢 Running TCP test", "Name", te.Name)
 
-	srcPod, err := e.GetPod(ctx, te.Src.K8sResource)
+	return e.runScanner(ctx, te, scannerContainerName, scannerContainerImage, suffixLength, nil)
+}
+
+// runScanner - runs a test whose outcome is the exit code of the scanner container alone, the
+// environment env is added to the one of the scanner
+func (e *Engine) runScanner(
+	ctx context.Context, // context information
+	te *data.Test, // test case we want to run
+	scannerContainerName string, // name of the scanner container to use
+	scannerContainerImage string, // docker image location of the scanner container image
+	suffixLength int, // length of random string that will be appended to the ephemeral container name
+	env []corev1.EnvVar, // extra environment of the scanner container
+) error {
+	var (
+		dstPod     *corev1.Pod
+		targetHost string
+	)
+
+	obs := te.Observe()
+
+	src, err := e.getSource(ctx, te)
 	if err != nil {
 		return err
 	}
 
-	// if Destination K8sResource is not set to nil
-	if te.Dst.K8sResource != nil {
+	switch {
+	case te.Dst.K8sResource != nil && te.Dst.K8sResource.Kind == data.KindNode:
+		// the node is reached through its InternalIP address
+		targetHost, err = e.getNodeTarget(ctx, te)
+		if err != nil {
+			return err
+		}
+	case te.Dst.K8sResource != nil:
 		// we need to find a running Pod  with IP Address in the Dst K8sResource
 		dstPod, err = e.GetPod(ctx, te.Dst.K8sResource)
 		if err != nil {
 			return err
 		}
-		targetHost = dstPod.Status.PodIP
-	} else {
-		targetHost = te.Dst.Host.Name
+		obs.DstPod = podRef(dstPod)
+
+		targetHost, err = kubeops.PodIP(dstPod, te.IPFamily)
+		if err != nil {
+			return fmt.Errorf("invalid destination of test %s: %w", te.Name, err)
+		}
+	default:
+		targetHost = te.Dst.Host.Target()
 	}
+	obs.TargetHost = targetHost
 
 	// build ephemeral container with details of the IP addresses
 	msg, err := kubeops.NewUUIDString()
@@ -65,64 +91,116 @@ func (e *Engine) RunTCPTest(
 		return fmt.Errorf("unable to genereate random UUID for test %s: %w", te.Name, err)
 	}
 
+	// the scanner of a node runs in its own probe Pod, so its resources are not ignored
+	containerSettings := e.ephemeralContainerSettings
+	if src.node != nil {
+		containerSettings = e.containerSettings
+	}
+
+	settings, err := containerSettings(te)
+	if err != nil {
+		return err
+	}
+
+	settings, err = e.scannerSettings(te, src, settings)
+	if err != nil {
+		return err
+	}
+
 	debugContainer, err := e.Service.BuildEphemeralScannerContainer(
 		scannerContainerName+"-"+kubeops.RandString(suffixLength),
-		scannerContainerImage,
+		e.scannerImage(te, src.namespace(), scannerContainerImage),
 		targetHost,
 		strconv.Itoa(te.TargetPort),
 		string(te.Protocol),
 		msg,
 		te.Attempts,
+		settings,
 	)
 	if err != nil {
 		return fmt.Errorf("unable to build ephemeral scanner container for test %s: %w", te.Name, err)
 	}
+	debugContainer.Env = append(debugContainer.Env, env...)
+
+	// the scanner measures the connection and writes the timings to the report of its termination message
+	if te.Measured() {
+		debugContainer.Env = append(debugContainer.Env, kubeops.MeasurementEnv(te.TransferSize())...)
+	}
 
 	// run the ephemeral/debug container
 	// grab the exit code
 	// make sure that the exit code matches the one that is specified in the test
-	srcPod, ephContainerName, err := e.Service.LaunchEphemeralContainerInPod(ctx, srcPod, debugContainer)
+	ephContainerName, err := e.launchScanner(ctx, te, src, debugContainer, settings)
 	if err != nil {
 		return fmt.Errorf("ephemeral container launch failed for test %s: %w", te.Name, err)
 	}
+	obs.ScannerContainer = ephContainerName
 
-	err = e.CheckExitStatusOfEphContainer(
-		ctx,
-		ephContainerName,
-		te.Name,
-		srcPod.Name,
-		srcPod.Namespace,
-		time.Duration(te.TimeoutSeconds)*time.Second,
-		te.ExitCode,
-	)
+	// the logs are collected once the exit status is known, or the test has failed, and the
+	// container is then released, e.g. its probe Pod is deleted
+	defer e.releaseScanner(ctx, te, src, ephContainerName)
+
+	containerExitCode, report, err := e.scannerExitStatus(ctx, src, ephContainerName, e.containerTimeout(te))
+	exitCode, err := e.checkExitCode(ephContainerName, te.Name, containerExitCode, report, err, te.ExitCode,
+		te.Expect)
+	if exitCode >= 0 {
+		obs.ExitCode = &exitCode
+	}
+
+	if report != nil {
+		obs.Outcome = report.Outcome
+	}
 
 	if err != nil {
 		return err
 	}
 
+	if te.Measured() {
+		if err := e.checkMeasurements(te, ephContainerName, report); err != nil {
+			return err
+		}
+	}
+
 	te.Pass = true // set the test as pass
 	return nil
 }
 
-// CheckExitStatusOfEphContainer - returns an error if exit code of the ephemeral container does not match expExitCode
-func (e *Engine) CheckExitStatusOfEphContainer(
-	ctx context.Context, // context to pass to our function
-	ephContainerName string, // name of the ephemeral container
+// checkMeasurements - returns an error if the measurements in the report of the scanner container exceed
+// the thresholds of the test
+func (e *Engine) checkMeasurements(te *data.Test, scannerName string, report *kubeops.ContainerReport) error {
+	measurements := report.Measurements()
+	te.Observe().Measurements = measurements
+
+	if measurements != nil {
+		e.Log.Info("Got measurements from the scanner container",
+			"testName", te.Name,
+			"connectLatency", measurements.ConnectLatency,
+			"throughput", data.FormatThroughput(measurements.Throughput()),
+			"container", scannerName,
+		)
+	}
+
+	if err := te.CheckMeasurements(measurements); err != nil {
+		return fmt.Errorf("scanner container %s of test %s: %w", scannerName, te.Name, err)
+	}
+
+	return nil
+}
+
+// checkExitCode - returns the exit code of a container and an error if it could not be retrieved, does
+// not match expExitCode or if the outcome of the container does not match expect, the exit code is -1 when
+// it could not be retrieved
+func (e *Engine) checkExitCode(
+	ephContainerName string, // name of the container
 	testCaseName string, // name of the test case
-	podName string, // name of the pod that houses the ephemeral container
-	podNamespace string, // namespace of the pod that houses the ephemeral container
-	timeout time.Duration, // timeout for the exit status to reach the desired exit code
-	expExitCode int, // expected exit code from the ephemeral container
-) error {
-	containerExitCode, err := e.Service.GetExitStatusOfEphemeralContainer(
-		ctx,
-		ephContainerName,
-		timeout,
-		podName,
-		podNamespace,
-	)
+	containerExitCode int, // exit code of the container
+	report *kubeops.ContainerReport, // report of the container, nil when it did not write one
+	err error, // error returned while retrieving the exit code
+	expExitCode int, // expected exit code from the container
+	expect data.Expect, // expected outcome of the container, only the exit code is checked when empty
+) (int, error) {
 	if err != nil {
-		return fmt.Errorf("failed to get exit code of the ephemeral container %s for test %s: %w",
+		return -1, fmt.Errorf("failed to get exit code of the ephemeral container %s for test %s: %w",
 			ephContainerName, testCaseName, err)
 	}
 
@@ -130,6 +208,7 @@ func (e *Engine) CheckExitStatusOfEphContainer(
 		"testName", testCaseName,
 		"exitCode", containerExitCode,
 		"container", ephContainerName,
+		"outcome", report.Reason(),
 	)
 
 	if containerExitCode != expExitCode {
@@ -138,10 +217,53 @@ func (e *Engine) CheckExitStatusOfEphContainer(
 			"exitCode", containerExitCode,
 			"expectedExitCode", expExitCode,
 			"container", ephContainerName,
+			"outcome", report.Reason(),
 		)
-		return fmt.Errorf("ephemeral container %s exit code for test %v is %v instead of %v",
-			ephContainerName, testCaseName, containerExitCode, expExitCode)
+		return containerExitCode, fmt.Errorf("ephemeral container %s exit code for test %v is %v instead of %v%s%s",
+			ephContainerName, testCaseName, containerExitCode, expExitCode, expectSuffix(expect), reasonSuffix(report))
 	}
 
-	return nil
+	if err := checkOutcome(expect, report); err != nil {
+		return containerExitCode, fmt.Errorf("ephemeral container %s of test %v: %w", ephContainerName, testCaseName, err)
+	}
+
+	return containerExitCode, nil
+}
+
+// checkOutcome - returns an error if the outcome reported by a container does not match expect, the exit
+// code alone is trusted when the container did not report an outcome and expect does not need one
+func checkOutcome(expect data.Expect, report *kubeops.ContainerReport) error {
+	switch {
+	case expect == "":
+		return nil
+	case report == nil || report.Outcome == "":
+		if expect.NeedsOutcome() {
+			return fmt.Errorf("expect %s needs the outcome of the connection, which was not reported", expect)
+		}
+		return nil
+	case !expect.Matches(report.Outcome):
+		return fmt.Errorf("outcome is %s instead of %s", report.Reason(), expect)
+	default:
+		return nil
+	}
+}
+
+// expectSuffix - returns the expected outcome to append to an error, or an empty string when the test
+// only expects an exit code
+func expectSuffix(expect data.Expect) string {
+	if expect == "" {
+		return ""
+	}
+
+	return " (expect " + string(expect) + ")"
+}
+
+// reasonSuffix - returns the outcome reported by a container to append to an error, or an empty string
+// when the container only returned an exit code
+func reasonSuffix(report *kubeops.ContainerReport) string {
+	if reason := report.Reason(); reason != "" {
+		return ": " + reason
+	}
+
+	return ""
 }
@@ -3,8 +3,10 @@ package engine
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
@@ -13,6 +15,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/controlplaneio/netassert/v2/internal/data"
+	"github.com/controlplaneio/netassert/v2/internal/kubeops"
 )
 
 var sampleTest = `
@@ -76,7 +79,7 @@ func TestEngine_RunTCPTest(t *testing.T) {
 
 		mockRunner.EXPECT().
 			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
-				gomock.Any(), gomock.Any(), gomock.Any()).
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(&corev1.EphemeralContainer{},
 				fmt.Errorf("failed to build ephemeral scanner container"))
 
@@ -90,4 +93,776 @@ func TestEngine_RunTCPTest(t *testing.T) {
 		wantErrMsg := `unable to build ephemeral scanner container for test ` + tc.Name
 		r.Contains(err.Error(), wantErrMsg)
 	})
+
+	t.Run("logs of the scanner are attached to a failed test", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.Nil(err)
+
+		tc := testCases[0]
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "busybox",
+				Namespace: "busybox",
+			},
+		}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil)
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Dst.K8sResource.Name, tc.Dst.K8sResource.Namespace).
+			Return(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "echoserver",
+					Namespace: "echoserver",
+				},
+			}, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-abc", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return(1, nil, nil)
+
+		mockRunner.EXPECT().
+			GetEphemeralContainerLogs(ctx, "scanner-abc", int64(1024), "busybox", "busybox").
+			Return("connection refused", nil)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+		eng.LogsMaxBytes = 1024
+
+		err = eng.RunTCPTest(ctx, tc, "scanner-container-name", "scanner-container-image", 7)
+		r.Error(err)
+		r.False(tc.Pass)
+		r.Equal([]data.ContainerLog{{
+			Container: "scanner-abc",
+			Pod:       "busybox",
+			Namespace: "busybox",
+			Log:       "connection refused",
+		}}, tc.ContainerLogs)
+		r.Equal("busybox/busybox", tc.Observation.SrcPod)
+		r.Equal("echoserver/echoserver", tc.Observation.DstPod)
+		r.Equal("scanner-abc", tc.Observation.ScannerContainer)
+		r.NotNil(tc.Observation.ExitCode)
+		r.Equal(1, *tc.Observation.ExitCode)
+	})
+
+	t.Run("the outcome reported by the scanner is the reason of a failed test", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+
+		tc := testCases[0]
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil)
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Dst.K8sResource.Name, tc.Dst.K8sResource.Namespace).
+			Return(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+				Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+			}, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-abc", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return(1, &kubeops.ContainerReport{
+				Version: kubeops.ContainerReportVersion,
+				Outcome: data.OutcomeRefused,
+				Detail:  "dial tcp 10.0.0.2:8080: connect: connection refused",
+			}, nil)
+
+		mockRunner.EXPECT().
+			GetEphemeralContainerLogs(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return("", nil).AnyTimes()
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTCPTest(ctx, tc, "scanner-container-name", "scanner-container-image", 7)
+		r.EqualError(err, "ephemeral container scanner-abc exit code for test busybox-deploy-to-echoserver-deploy "+
+			"is 1 instead of 0: refused: dial tcp 10.0.0.2:8080: connect: connection refused")
+		r.False(tc.Pass)
+		r.Equal(data.OutcomeRefused, tc.Observation.Outcome)
+		r.Equal(data.OutcomeRefused, tc.Result().Outcome)
+	})
+
+	t.Run("the scanner container is released once the test is over", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.Nil(err)
+
+		tc := testCases[0]
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		runner := &fakeContainerReleaser{MockNetAssertTestRunner: NewMockNetAssertTestRunner(mockCtrl)}
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+		probePod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scanner-abc", Namespace: "busybox"}}
+
+		runner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil)
+
+		runner.EXPECT().
+			GetPodInDeployment(ctx, tc.Dst.K8sResource.Name, tc.Dst.K8sResource.Namespace).
+			Return(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+				Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+			}, nil)
+
+		runner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		runner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(probePod, "scanner-abc", nil)
+
+		runner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "scanner-abc", "busybox").
+			Return(0, nil, nil)
+
+		eng := New(runner, hclog.NewNullLogger())
+
+		r.NoError(eng.RunTCPTest(ctx, tc, "scanner-container-name", "scanner-container-image", 7))
+		r.True(tc.Pass)
+		r.Equal([]string{"busybox/scanner-abc/scanner-abc"}, runner.released)
+	})
+
+	t.Run("the measurements reported by the scanner are checked against the thresholds", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+
+		tc := testCases[0]
+		tc.MaxConnectLatency = "50ms"
+		tc.MinThroughput = "100Mbps"
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil)
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Dst.K8sResource.Name, tc.Dst.K8sResource.Namespace).
+			Return(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+				Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+			}, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		// the scanner is asked to measure the connection and to send 1MiB to the destination
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Cond(func(x any) bool {
+				ec := x.(*corev1.EphemeralContainer)
+				return slices.Contains(ec.Env, corev1.EnvVar{Name: "MEASURE", Value: "true"}) &&
+					slices.Contains(ec.Env, corev1.EnvVar{Name: "TRANSFER_BYTES", Value: "1048576"})
+			})).
+			Return(srcPod, "scanner-abc", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return(0, &kubeops.ContainerReport{
+				Version:              kubeops.ContainerReportVersion,
+				Outcome:              data.OutcomeConnected,
+				ConnectLatencyMicros: 80000,
+				TransferredBytes:     1 << 20,
+				TransferMicros:       1000000,
+			}, nil)
+
+		mockRunner.EXPECT().
+			GetEphemeralContainerLogs(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return("", nil).AnyTimes()
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTCPTest(ctx, tc, "scanner-container-name", "scanner-container-image", 7)
+		r.ErrorContains(err, "connect latency of 80ms is more than 50ms")
+		r.ErrorContains(err, "throughput of 8.39Mbps is less than 100Mbps")
+		r.False(tc.Pass)
+		r.Equal(80*time.Millisecond, tc.Observation.Measurements.ConnectLatency)
+		r.Equal("8.39Mbps", tc.Result().Measurements.Throughput)
+	})
+
+	t.Run("the scanner of a node runs in a probe Pod on the node", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(`
+- name: workers-to-kubelet
+  type: k8s
+  targetPort: 10250
+  exitCode: 0
+  src:
+    k8sResource:
+      kind: node
+      selector:
+        node-role.kubernetes.io/worker: ""
+      namespace: netassert
+  dst:
+    k8sResource:
+      kind: node
+      name: control-plane
+`))
+		r.NoError(err)
+		tc := testCases[0]
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+		probePod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scanner-abc", Namespace: "netassert"}}
+
+		mockRunner.EXPECT().
+			GetNode(ctx, "", map[string]string{"node-role.kubernetes.io/worker": ""}).
+			Return(srcNode, nil)
+
+		mockRunner.EXPECT().
+			GetNode(ctx, "control-plane", nil).
+			Return(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "control-plane"},
+				Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "192.168.0.10"},
+				}},
+			}, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "192.168.0.10", "10250",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		mockRunner.EXPECT().
+			LaunchNodeProbe(ctx, srcNode, "netassert", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(probePod, "scanner-abc", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfProbeContainer(ctx, "scanner-abc", gomock.Any(), "scanner-abc", "netassert").
+			Return(0, nil, nil)
+
+		mockRunner.EXPECT().
+			DeleteProbePod(ctx, "scanner-abc", "netassert").
+			Return(nil)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		r.NoError(eng.RunTCPTest(ctx, tc, "scanner-container-name", "scanner-container-image", 7))
+		r.True(tc.Pass)
+		r.Equal("worker-1", tc.Observation.SrcNode)
+		r.Equal("control-plane", tc.Observation.DstNode)
+		r.Equal("192.168.0.10", tc.Observation.TargetHost)
+		r.Empty(tc.Observation.SrcPod)
+	})
+
+	t.Run("a dual-stack test runs once for each IP family", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+		tc := testCases[0]
+		tc.IPFamily = data.IPFamilyBoth
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil).Times(2)
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Dst.K8sResource.Name, tc.Dst.K8sResource.Namespace).
+			Return(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+				Status: corev1.PodStatus{
+					PodIP:  "10.0.0.2",
+					PodIPs: []corev1.PodIP{{IP: "10.0.0.2"}, {IP: "fd00::2"}},
+				},
+			}, nil).Times(2)
+
+		for _, host := range []string{"10.0.0.2", "fd00::2"} {
+			mockRunner.EXPECT().
+				BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), host, "8080",
+					gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&corev1.EphemeralContainer{}, nil)
+		}
+
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-abc", nil).Times(2)
+
+		// the IPv6 connection is refused
+		gomock.InOrder(
+			mockRunner.EXPECT().
+				GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+				Return(0, nil, nil),
+			mockRunner.EXPECT().
+				GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+				Return(1, nil, nil),
+		)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.ErrorContains(err, "ipv6: ephemeral container scanner-abc exit code")
+		r.False(tc.Pass)
+		r.Len(tc.SubTests, 2)
+		r.Equal("busybox-deploy-to-echoserver-deploy [ipv4]", tc.SubTests[0].Name)
+		r.True(tc.SubTests[0].Pass)
+		r.Equal("10.0.0.2", tc.SubTests[0].Observation.TargetHost)
+		r.False(tc.SubTests[1].Pass)
+		r.Equal("fd00::2", tc.SubTests[1].Observation.TargetHost)
+		r.NotEmpty(tc.SubTests[1].FailureReason)
+	})
+
+	t.Run("a test towards a set of hosts runs once for each target", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+		tc := testCases[0]
+		tc.Dst = &data.Dst{Hosts: &data.Hosts{CIDR: "192.168.0.0/30"}}
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, tc.Src.K8sResource.Name, tc.Src.K8sResource.Namespace).
+			Return(srcPod, nil).Times(2)
+
+		for _, host := range []string{"192.168.0.1", "192.168.0.2"} {
+			mockRunner.EXPECT().
+				BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), host, "8080",
+					gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&corev1.EphemeralContainer{}, nil)
+		}
+
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-abc", nil).Times(2)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return(0, nil, nil).Times(2)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.NoError(err)
+		r.True(tc.Pass)
+		r.Len(tc.SubTests, 2)
+		r.Equal("busybox-deploy-to-echoserver-deploy [192.168.0.1]", tc.SubTests[0].Name)
+		r.Equal("192.168.0.2", tc.SubTests[1].Observation.TargetHost)
+		r.True(tc.SubTests[1].Pass)
+	})
+
+	t.Run("a test with a reverse block runs in both directions", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+		tc := testCases[0]
+		reverseExitCode := 1
+		tc.Reverse = &data.Reverse{TargetPort: 9090, ExitCode: &reverseExitCode}
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		busybox := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.1"},
+		}
+		echoserver := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+		}
+
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(busybox, nil).Times(2)
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(echoserver, nil).Times(2)
+
+		// forward from busybox to echoserver, and reverse from echoserver to busybox
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.1", "9090",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, busybox, gomock.Any()).
+			Return(busybox, "scanner-fwd", nil)
+		mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, echoserver, gomock.Any()).
+			Return(echoserver, "scanner-rev", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-fwd", gomock.Any(), "busybox", "busybox").
+			Return(0, nil, nil)
+		// the reverse connection is expected to be blocked
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-rev", gomock.Any(), "echoserver", "echoserver").
+			Return(1, nil, nil)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.NoError(err)
+		r.True(tc.Pass)
+		r.Len(tc.SubTests, 2)
+		r.Equal("busybox-deploy-to-echoserver-deploy [forward]", tc.SubTests[0].Name)
+		r.Equal(data.DirectionReverse, tc.SubTests[1].Direction)
+		r.Equal("echoserver/echoserver", tc.SubTests[1].Observation.SrcPod)
+		r.True(tc.SubTests[1].Pass)
+	})
+
+	t.Run("a failed test is run again with a new Pod selection and is flaky when it then passes", func(t *testing.T) {
+		for name, flakyIsFailure := range map[string]bool{"flaky passes": false, "flaky is failure": true} {
+			t.Run(name, func(t *testing.T) {
+				r := require.New(t)
+				ctx := context.Background()
+				testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+				r.NoError(err)
+				tc := testCases[0]
+				tc.RetryBackoff = "1ms"
+
+				mockCtrl := gomock.NewController(t)
+				defer mockCtrl.Finish()
+
+				mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+				srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+				dstPod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+					Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+				}
+
+				// each run selects the Pods and injects a scanner again
+				mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(srcPod, nil).Times(2)
+				mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(dstPod, nil).Times(2)
+				mockRunner.EXPECT().
+					BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+						gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&corev1.EphemeralContainer{}, nil).Times(2)
+				gomock.InOrder(
+					mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+						Return(srcPod, "scanner-1", nil),
+					mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+						Return(srcPod, "scanner-2", nil),
+				)
+
+				// the connection fails the first time only
+				mockRunner.EXPECT().
+					GetExitStatusOfEphemeralContainer(ctx, "scanner-1", gomock.Any(), "busybox", "busybox").
+					Return(1, nil, nil)
+				mockRunner.EXPECT().
+					GetExitStatusOfEphemeralContainer(ctx, "scanner-2", gomock.Any(), "busybox", "busybox").
+					Return(0, nil, nil)
+
+				// only the logs of the last run are attached to the test
+				mockRunner.EXPECT().
+					GetEphemeralContainerLogs(ctx, "scanner-1", gomock.Any(), "busybox", "busybox").
+					Return("connection refused", nil)
+				mockRunner.EXPECT().
+					GetEphemeralContainerLogs(ctx, "scanner-2", gomock.Any(), "busybox", "busybox").
+					Return("connected", nil)
+
+				eng := New(mockRunner, hclog.NewNullLogger())
+				eng.Retries = 1
+				eng.FlakyIsFailure = flakyIsFailure
+				eng.LogsMaxBytes = 4096
+
+				err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+				r.Equal(2, tc.Observation.Runs)
+				r.Equal("scanner-2", tc.Observation.ScannerContainer)
+				r.Len(tc.ContainerLogs, 1)
+				r.Equal("scanner-2", tc.ContainerLogs[0].Container)
+				r.Equal("connected", tc.ContainerLogs[0].Log)
+				r.True(tc.Result().Flaky)
+				if flakyIsFailure {
+					r.ErrorContains(err, "test busybox-deploy-to-echoserver-deploy is flaky, it only passed after 2 runs")
+					r.False(tc.Pass)
+					return
+				}
+				r.NoError(err)
+				r.True(tc.Pass)
+				r.True(tc.Flaky())
+			})
+		}
+	})
+
+	t.Run("a failed test is not retried once its retries are exhausted", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+		tc := testCases[0]
+		retries := 0
+		tc.Retries = &retries
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(srcPod, nil)
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+		}, nil)
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+		mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-1", nil)
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-1", gomock.Any(), "busybox", "busybox").
+			Return(1, nil, nil)
+
+		// the retries of the test override the ones of the run
+		eng := New(mockRunner, hclog.NewNullLogger())
+		eng.Retries = 3
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.ErrorContains(err, "exit code for test busybox-deploy-to-echoserver-deploy is 1 instead of 0")
+		r.False(tc.Pass)
+		r.False(tc.Flaky())
+		r.Equal(1, tc.Observation.Runs)
+	})
+
+	t.Run("the outcome reported by the scanner is checked against expect", func(t *testing.T) {
+		tests := map[string]struct {
+			outcome data.Outcome
+			wantErr string
+		}{
+			"a refused connection meets expect refused": {outcome: data.OutcomeRefused},
+			"a timed-out connection does not meet expect refused": {
+				outcome: data.OutcomeTimeout,
+				wantErr: "ephemeral container scanner-1 of test busybox-deploy-to-echoserver-deploy: outcome is timeout",
+			},
+		}
+
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				r := require.New(t)
+				ctx := context.Background()
+				testCases, err := data.NewFromReader(strings.NewReader(
+					strings.Replace(sampleTest, "exitCode: 0", "expect: refused", 1)))
+				r.NoError(err)
+				tc := testCases[0]
+
+				mockCtrl := gomock.NewController(t)
+				defer mockCtrl.Finish()
+
+				mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+				srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+				mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(srcPod, nil)
+				mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+					Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+				}, nil)
+				mockRunner.EXPECT().
+					BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+						gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&corev1.EphemeralContainer{}, nil)
+				mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+					Return(srcPod, "scanner-1", nil)
+				mockRunner.EXPECT().
+					GetExitStatusOfEphemeralContainer(ctx, "scanner-1", gomock.Any(), "busybox", "busybox").
+					Return(1, &kubeops.ContainerReport{Version: 1, Outcome: tt.outcome}, nil)
+
+				eng := New(mockRunner, hclog.NewNullLogger())
+
+				err = eng.RunTCPTest(ctx, tc, "scanner", "scanner-image", 7)
+				r.Equal(tt.outcome, tc.Observation.Outcome)
+				if tt.wantErr == "" {
+					r.NoError(err)
+					r.True(tc.Pass)
+					return
+				}
+				r.ErrorContains(err, tt.wantErr)
+				r.False(tc.Pass)
+			})
+		}
+	})
+
+	t.Run("a test whose scanner image cannot be pulled fails at once and is not retried", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.NoError(err)
+		tc := testCases[0]
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(srcPod, nil)
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+		}, nil)
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "8080",
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+		mockRunner.EXPECT().LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-1", nil)
+
+		// the container is waited for during the timeout of the test and the overhead of the containers
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-1", 30*time.Second, "busybox", "busybox").
+			Return(-1, nil, fmt.Errorf("%w: scanner-1 is in ImagePullBackOff", kubeops.ErrContainerNotStarted))
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+		eng.Retries = 2
+		eng.ContainerOverhead = 10 * time.Second
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.ErrorIs(err, kubeops.ErrContainerNotStarted)
+		r.ErrorContains(err, "scanner-1 is in ImagePullBackOff")
+		r.False(tc.Pass)
+		r.Equal(1, tc.Observation.Runs)
+	})
+
+	t.Run("skipped tests are not run", func(t *testing.T) {
+		r := require.New(t)
+		testCases, err := data.NewFromReader(strings.NewReader(sampleTest))
+		r.Nil(err)
+		testCases[0].Skip = "echoserver is being migrated"
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// no calls are expected on the mock
+		eng := New(NewMockNetAssertTestRunner(mockCtrl), hclog.NewNullLogger())
+		eng.RunTests(context.Background(), testCases, "sniffer", "sniffer-image",
+			"scanner", "scanner-image", 7, 0, "eth0")
+
+		r.False(testCases[0].Pass)
+		r.False(testCases[0].Failed())
+		r.Nil(testCases[0].Observation)
+	})
+}
+
+// fakeContainerReleaser - NetAssertTestRunner recording the released containers
+type fakeContainerReleaser struct {
+	*MockNetAssertTestRunner
+	released []string
+}
+
+// ReleaseContainer - records the released container
+func (f *fakeContainerReleaser) ReleaseContainer(_ context.Context, pod *corev1.Pod, containerName string) error {
+	f.released = append(f.released, podRef(pod)+"/"+containerName)
+	return nil
+}
+
+func TestEngine_checkExitCode(t *testing.T) {
+	tests := map[string]struct {
+		exitCode int
+		report   *kubeops.ContainerReport
+		expect   data.Expect
+		wantErr  string
+	}{
+		"the exit code alone matches an expectation without outcome": {
+			exitCode: 1,
+			expect:   data.ExpectDenied,
+		},
+		"the outcome matches the expectation": {
+			exitCode: 1,
+			report:   &kubeops.ContainerReport{Version: 1, Outcome: data.OutcomeTimeout},
+			expect:   data.ExpectDropped,
+		},
+		"a refused connection is not a timeout": {
+			exitCode: 1,
+			report:   &kubeops.ContainerReport{Version: 1, Outcome: data.OutcomeRefused, Detail: "connection refused"},
+			expect:   data.ExpectTimeout,
+			wantErr:  "ephemeral container scanner-abc of test test1: outcome is refused: connection refused instead of timeout",
+		},
+		"a refused connection cannot be told apart from a timeout without outcome": {
+			exitCode: 1,
+			expect:   data.ExpectRefused,
+			wantErr:  "expect refused needs the outcome of the connection, which was not reported",
+		},
+		"an established connection is not denied": {
+			exitCode: 0,
+			report:   &kubeops.ContainerReport{Version: 1, Outcome: data.OutcomeConnected},
+			expect:   data.ExpectDenied,
+			wantErr:  "exit code for test test1 is 0 instead of 1 (expect denied): connected",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			eng := New(nil, hclog.NewNullLogger())
+
+			exitCode, err := eng.checkExitCode("scanner-abc", "test1", tt.exitCode, tt.report, nil,
+				tt.expect.ExitCode(), tt.expect)
+			r.Equal(tt.exitCode, exitCode)
+			if tt.wantErr == "" {
+				r.NoError(err)
+				return
+			}
+			r.ErrorContains(err, tt.wantErr)
+		})
+	}
 }
@@ -3,8 +3,9 @@ package engine
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/controlplaneio/netassert/v2/internal/data"
 	"github.com/controlplaneio/netassert/v2/internal/kubeops"
@@ -12,10 +13,10 @@ import (
 )
 
 const (
-	defaultNetInt                   = `eth0` // default network interface
-	defaultSnapLen                  = 1024   // default size of the packet snap length
-	ephemeralContainersExtraSeconds = 23     // fixed extra time given for the ephemeral containers to come online
-	attemptsMultiplier              = 3      // increase the attempts to ensure that we send three times the packets
+	defaultNetInt      = `eth0` // default network interface
+	defaultSnapLen     = 1024   // default size of the packet snap length
+	attemptsMultiplier = 3      // increase the attempts to ensure that we send three times the packets
+	sourceLogsMaxBytes = 65536  // size of the tail of the sniffer logs searched for the source addresses
 )
 
 // RunUDPTest - runs a UDP test
@@ -63,10 +64,22 @@ func (e *Engine) RunUDPTest(
 	// if the protocol is tcp
 	// find a running Pod in the src resource
 
+	// the scanner waits for a reply of the destination, so no sniffer is injected and the destination
+	// can be any host
+	if te.UDPProbe != nil {
+		env, err := kubeops.UDPProbeEnv(te.UDPProbe, te.TimeoutSeconds)
+		if err != nil {
+			return fmt.Errorf("invalid udpProbe of test %s: %w", te.Name, err)
+		}
+
+		e.Log.Info("🟢 Running UDP test", "Name", te.Name, "probe", te.UDPProbe.Type)
+		return e.runScanner(ctx, te, scannerContainerSuffix, scannerContainerImage, suffixLength, env)
+	}
+
 	var (
-		srcPod, dstPod *corev1.Pod
-		targetHost     string
-		err            error
+		dstPod     *corev1.Pod
+		targetHost string
+		err        error
 	)
 
 	// as we cannot inject ephemeral container when the Dst type is Host, we will
@@ -88,9 +101,11 @@ func (e *Engine) RunUDPTest(
 	}
 
 	// find a running Pod represented by the  src.K8sResource object
-	srcPod, err = e.GetPod(ctx, te.Src.K8sResource)
+	obs := te.Observe()
+
+	src, err := e.getSource(ctx, te)
 	if err != nil {
-		return fmt.Errorf("unable to get source pod for test %s: %w", te.Name, err)
+		return err
 	}
 
 	// find a running Pod in the destination kubernetes object
@@ -99,62 +114,121 @@ func (e *Engine) RunUDPTest(
 		return err
 	}
 
-	targetHost = dstPod.Status.PodIP
+	obs.DstPod = podRef(dstPod)
+
+	targetHost, err = kubeops.PodIP(dstPod, te.IPFamily)
+	if err != nil {
+		return fmt.Errorf("invalid destination of test %s: %w", te.Name, err)
+	}
+	obs.TargetHost = targetHost
 
 	msg, err := kubeops.NewUUIDString()
 	if err != nil {
 		return fmt.Errorf("unable to genereate random UUID for test %s: %w", te.Name, err)
 	}
 
+	settings, err := e.ephemeralContainerSettings(te)
+	if err != nil {
+		return err
+	}
+
+	// ephemeral containers can only use the image pull secrets of the Pod they are injected in
+	if err := e.checkImagePullSecrets(te, dstPod); err != nil {
+		return err
+	}
+
+	if err := checkTargetContainer(te.Dst.K8sResource, dstPod); err != nil {
+		return fmt.Errorf("invalid destination of test %s: %w", te.Name, err)
+	}
+
+	// the sniffer shares the namespaces of the destination container and the scanner
+	// the ones of the source container
+	snifferSettings := settings
+	snifferSettings.TargetContainerName = te.Dst.K8sResource.Container
+
+	// the sniffer only counts the packets sent from the expected source addresses
+	var sourceCIDR string
+	expectedSource, checkSource := te.ExpectedSource()
+	if checkSource {
+		sourceCIDR = expectedSource.String()
+	}
+
+	scannerSettings, err := e.scannerSettings(te, src, settings)
+	if err != nil {
+		return err
+	}
+
 	// we now have both the source and the destination object, we need to ensure that we first
 	// inject the sniffer into the Destination Pod
 	snifferEphemeralContainer, err := e.Service.BuildEphemeralSnifferContainer(
 		snifferContainerSuffix+"-"+kubeops.RandString(suffixLength),
-		snifferContainerImage,
+		e.snifferImage(te, dstPod.Namespace, snifferContainerImage),
 		msg,
 		defaultSnapLen,
 		string(te.Protocol),
 		te.Attempts,
 		networkInterface,
 		te.TimeoutSeconds,
+		sourceCIDR,
+		snifferSettings,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to build sniffer ephemeral container for test %s: %w", te.Name, err)
 	}
 
-	// we now build the scanner container
+	// run the ephemeral containers on dst Pod first and then the source Pod
+	dstPod, snifferContainerName, err := e.Service.LaunchEphemeralContainerInPod(ctx, dstPod,
+		snifferEphemeralContainer)
+	if err != nil {
+		return fmt.Errorf("sniffer ephermal container launch failed for test %s: %w", te.Name, err)
+	}
+	obs.SnifferContainer = snifferContainerName
+
+	// the container is released, e.g. its probe Pod is deleted, once its logs are collected
+	defer e.releaseContainer(ctx, te, snifferContainerName, dstPod)
+	// the logs are collected once the exit status is known, or the test has failed
+	defer e.collectContainerLogs(ctx, te, snifferContainerName, dstPod)
+
+	// when the sniffer runs in a probe Pod the packets must be sent to the probe Pod rather than to
+	// the destination Pod it impersonates
+	if snifferHost, err := kubeops.PodIP(dstPod, te.IPFamily); err == nil && snifferHost != "" &&
+		snifferHost != targetHost {
+		targetHost = snifferHost
+		obs.TargetHost = targetHost
+	}
+
+	// we now build the scanner container, once the address of the sniffer is known
 	scannerEphemeralContainer, err := e.Service.BuildEphemeralScannerContainer(
 		scannerContainerSuffix+"-"+kubeops.RandString(suffixLength),
-		scannerContainerImage,
+		e.scannerImage(te, src.namespace(), scannerContainerImage),
 		targetHost,
 		strconv.Itoa(te.TargetPort),
 		string(te.Protocol),
 		msg,
 		te.Attempts*attemptsMultiplier,
+		scannerSettings,
 	)
 	if err != nil {
 		return fmt.Errorf("unable to build ephemeral scanner container for test %s: %w", te.Name, err)
 	}
 
-	// run the ephemeral containers on dst Pod first and then the source Pod
-	dstPod, snifferContainerName, err := e.Service.LaunchEphemeralContainerInPod(ctx, dstPod,
-		snifferEphemeralContainer)
-	if err != nil {
-		return fmt.Errorf("sniffer ephermal container launch failed for test %s: %w", te.Name, err)
-	}
-
-	// run the ephemeral scanner container in the source Pod after we have
+	// run the ephemeral scanner container in the source Pod, or on the source node, after we have
 	// launched the sniffer and the sniffer container is ready
-	_, scannerContainerName, err := e.Service.LaunchEphemeralContainerInPod(ctx, srcPod, scannerEphemeralContainer)
+	scannerContainerName, err := e.launchScanner(ctx, te, src, scannerEphemeralContainer, scannerSettings)
 	if err != nil {
 		return fmt.Errorf("scanner ephemeral container launch failed for test %s: %w", te.Name, err)
 	}
+	obs.ScannerContainer = scannerContainerName
+
+	// the logs are collected once the exit status is known, or the test has failed, and the
+	// container is then released, e.g. its probe Pod is deleted
+	defer e.releaseScanner(ctx, te, src, scannerContainerName)
 
 	// sniffer is successfully injected into the dstPod, now we check the exit code
-	exitCodeSnifferCtr, err := e.Service.GetExitStatusOfEphemeralContainer(
+	exitCodeSnifferCtr, snifferReport, err := e.Service.GetExitStatusOfEphemeralContainer(
 		ctx,
 		snifferContainerName,
-		time.Duration(te.TimeoutSeconds+ephemeralContainersExtraSeconds)*time.Second,
+		e.containerTimeout(te),
 		dstPod.Name,
 		dstPod.Namespace,
 	)
@@ -163,22 +237,38 @@ func (e *Engine) RunUDPTest(
 			snifferContainerName, te.Name, err)
 	}
 
+	obs.ExitCode = &exitCodeSnifferCtr
+	if snifferReport != nil {
+		obs.Outcome = snifferReport.Outcome
+	}
+
 	e.Log.Info("Got exit code from ephemeral sniffer container",
 		"testName", te.Name,
 		"exitCode", exitCodeSnifferCtr,
-		"containerName", snifferContainerName)
+		"containerName", snifferContainerName,
+		"outcome", snifferReport.Reason())
+
+	if checkSource {
+		if err := e.checkSourceIPs(ctx, te, expectedSource, snifferContainerName, dstPod, exitCodeSnifferCtr); err != nil {
+			return err
+		}
+	}
 
 	if exitCodeSnifferCtr != te.ExitCode {
-		return fmt.Errorf("ephemeral sniffer container %s exit code for test %v is %v instead of %d",
-			snifferContainerName, te.Name, exitCodeSnifferCtr, te.ExitCode)
+		return fmt.Errorf("ephemeral sniffer container %s exit code for test %v is %v instead of %d%s%s",
+			snifferContainerName, te.Name, exitCodeSnifferCtr, te.ExitCode, expectSuffix(te.Expect),
+			reasonSuffix(snifferReport))
+	}
+
+	// the sniffer tells whether the packets were received, whatever the outcome reported by the scanner
+	if err := checkOutcome(te.Expect, snifferReport); err != nil {
+		return fmt.Errorf("ephemeral sniffer container %s of test %v: %w", snifferContainerName, te.Name, err)
 	}
 
 	// get the exit status of the scanner container
-	exitCodeScanner, err := e.Service.GetExitStatusOfEphemeralContainer(
-		ctx, scannerContainerName,
-		time.Duration(te.TimeoutSeconds+ephemeralContainersExtraSeconds)*time.Second,
-		srcPod.Name,
-		srcPod.Namespace,
+	exitCodeScanner, scannerReport, err := e.scannerExitStatus(
+		ctx, src, scannerContainerName,
+		e.containerTimeout(te),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to get exit code of the scanner ephemeral container %s for test %s: %w",
@@ -188,15 +278,56 @@ func (e *Engine) RunUDPTest(
 	e.Log.Info("Got exit code from ephemeral scanner container",
 		"testName", te.Name,
 		"exitCode", exitCodeScanner,
-		"containerName", scannerContainerName)
+		"containerName", scannerContainerName,
+		"outcome", scannerReport.Reason())
 
 	// for UDP scanning the exit code of the scanner is always zero
 	// as UDP is connectionless
 	if exitCodeScanner != 0 {
-		return fmt.Errorf("ephemeral scanner container %s exit code for test %v is %v instead of 0",
-			scannerContainerName, te.Name, exitCodeScanner)
+		return fmt.Errorf("ephemeral scanner container %s exit code for test %v is %v instead of 0%s",
+			scannerContainerName, te.Name, exitCodeScanner, reasonSuffix(scannerReport))
 	}
 
 	te.Pass = true // mark test as pass
 	return nil
 }
+
+// checkSourceIPs - records the source addresses of the packets logged by the sniffer container, and
+// ensures that they are in the expected range
+func (e *Engine) checkSourceIPs(
+	ctx context.Context, // the context
+	te *data.Test, // the test
+	expected netip.Prefix, // range of the expected source addresses
+	snifferContainerName string, // name of the sniffer container
+	dstPod *corev1.Pod, // the Pod running the sniffer container
+	snifferExitCode int, // exit code of the sniffer container, 0 when packets from the range were received
+) error {
+	logs, err := e.Service.GetEphemeralContainerLogs(ctx, snifferContainerName, sourceLogsMaxBytes,
+		dstPod.Name, dstPod.Namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get the source addresses of the packets of test %s from the sniffer container %s: %w",
+			te.Name, snifferContainerName, err)
+	}
+
+	ips := kubeops.ParseSnifferSourceIPs(logs)
+	te.Observe().SourceIPs = ips
+
+	var unexpected []string
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !expected.Contains(addr.Unmap()) {
+			unexpected = append(unexpected, ip)
+		}
+	}
+
+	switch {
+	case len(unexpected) > 0:
+		return fmt.Errorf("packets of test %s were received from %s instead of %s", te.Name,
+			strings.Join(unexpected, ", "), expected)
+	case len(ips) == 0 && snifferExitCode == 0:
+		return fmt.Errorf("sniffer container %s did not log the source addresses of the packets of test %s, "+
+			"its image may not support the expected source addresses", snifferContainerName, te.Name)
+	}
+
+	return nil
+}
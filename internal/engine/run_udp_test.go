@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+var sampleUDPProbeTest = `
+- name: busybox-deploy-to-dns
+  type: k8s
+  protocol: udp
+  targetPort: 53
+  timeoutSeconds: 20
+  attempts: 3
+  exitCode: 0
+  udpProbe:
+    type: dns
+    query: example.com
+  src:
+    k8sResource:
+      kind: deployment
+      name: busybox
+      namespace: busybox
+  dst:
+    host:
+      name: 1.1.1.1
+`
+
+func TestEngine_RunUDPTest(t *testing.T) {
+	t.Run("the scanner of a udpProbe waits for a reply without a sniffer", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(sampleUDPProbeTest))
+		r.NoError(err)
+		tc := testCases[0]
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+
+		mockRunner.EXPECT().
+			GetPodInDeployment(ctx, "busybox", "busybox").
+			Return(srcPod, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "1.1.1.1", "53", "udp",
+				gomock.Any(), 3, gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+
+		// the request of the probe is added to the environment of the scanner
+		hasProbeEnv := gomock.Cond(func(x any) bool {
+			ec, ok := x.(*corev1.EphemeralContainer)
+			return ok && slices.Contains(ec.Env, corev1.EnvVar{Name: "PROBE_MODE", Value: "response"})
+		})
+
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, hasProbeEnv).
+			Return(srcPod, "scanner-abc", nil)
+
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "scanner-abc", gomock.Any(), "busybox", "busybox").
+			Return(0, nil, nil)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.NoError(err)
+		r.True(tc.Pass)
+		r.Equal("1.1.1.1", tc.Observation.TargetHost)
+		r.Empty(tc.Observation.SnifferContainer)
+	})
+	t.Run("the packets must be received from the expected source addresses", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		testCases, err := data.NewFromReader(strings.NewReader(`
+- name: busybox-deploy-to-echoserver-deploy
+  type: k8s
+  protocol: udp
+  targetPort: 53
+  exitCode: 0
+  expectedSourceCIDR: 10.10.0.0/24
+  src:
+    k8sResource:
+      kind: deployment
+      name: busybox
+      namespace: busybox
+  dst:
+    k8sResource:
+      kind: deployment
+      name: echoserver
+      namespace: echoserver
+`))
+		r.NoError(err)
+		tc := testCases[0]
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockRunner := NewMockNetAssertTestRunner(mockCtrl)
+
+		srcPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "busybox", Namespace: "busybox"}}
+		dstPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "echoserver", Namespace: "echoserver"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.2"},
+		}
+
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "busybox", "busybox").Return(srcPod, nil)
+		mockRunner.EXPECT().GetPodInDeployment(ctx, "echoserver", "echoserver").Return(dstPod, nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralSnifferContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "udp",
+				gomock.Any(), gomock.Any(), gomock.Any(), "10.10.0.0/24", gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, dstPod, gomock.Any()).
+			Return(dstPod, "sniffer-abc", nil)
+
+		mockRunner.EXPECT().
+			BuildEphemeralScannerContainer(gomock.Any(), gomock.Any(), "10.0.0.2", "53", "udp",
+				gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&corev1.EphemeralContainer{}, nil)
+		mockRunner.EXPECT().
+			LaunchEphemeralContainerInPod(ctx, srcPod, gomock.Any()).
+			Return(srcPod, "scanner-abc", nil)
+
+		// the packets were masqueraded by the node rather than by the egress gateway
+		mockRunner.EXPECT().
+			GetExitStatusOfEphemeralContainer(ctx, "sniffer-abc", gomock.Any(), "echoserver", "echoserver").
+			Return(1, nil, nil)
+		mockRunner.EXPECT().
+			GetEphemeralContainerLogs(ctx, "sniffer-abc", gomock.Any(), "echoserver", "echoserver").
+			Return("matched packet source_ip=192.168.0.7\n", nil)
+
+		eng := New(mockRunner, hclog.NewNullLogger())
+
+		err = eng.RunTest(ctx, tc, "sniffer", "sniffer-image", "scanner", "scanner-image", 7, "eth0")
+		r.ErrorContains(err, "packets of test busybox-deploy-to-echoserver-deploy were received from 192.168.0.7 "+
+			"instead of 10.10.0.0/24")
+		r.False(tc.Pass)
+		r.Equal([]string{"192.168.0.7"}, tc.Observation.SourceIPs)
+	})
+}
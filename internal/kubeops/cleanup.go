@@ -0,0 +1,363 @@
+package kubeops
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restartedAtAnnotation - annotation of the Pod template set to restart the Pods of a workload,
+// the same one as kubectl rollout restart
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// CleanupAction - how the ephemeral containers of a Pod are removed
+type CleanupAction string
+
+const (
+	// CleanupRestart - restarts the workload owning the Pod, as kubectl rollout restart does
+	CleanupRestart CleanupAction = "restart"
+	// CleanupEvict - evicts the Pod so that its controller recreates it, honouring the PodDisruptionBudgets
+	CleanupEvict CleanupAction = "evict"
+)
+
+// Owner - workload controlling a Pod
+type Owner struct {
+	Kind string // kind of the workload e.g. Deployment
+	Name string // name of the workload
+}
+
+// String - returns the kind/name reference of the owner
+func (o Owner) String() string {
+	return o.Kind + "/" + o.Name
+}
+
+// EphemeralContainerUsage - ephemeral containers injected by netassert in a Pod
+type EphemeralContainerUsage struct {
+	Namespace string
+	Pod       string
+	Total     int    // number of ephemeral containers of the Pod, including the ones of other tools
+	Netassert int    // number of ephemeral containers injected by netassert
+	Running   int    // number of ephemeral containers injected by netassert that are still running
+	Owner     *Owner // workload controlling the Pod, nil when the Pod is not controlled
+}
+
+// CleanupStep - action that removes the ephemeral containers of some Pods
+type CleanupStep struct {
+	Action    CleanupAction
+	Namespace string
+	Owner     *Owner   // workload restarted, only set for CleanupRestart
+	Pods      []string // Pods holding too many netassert containers recreated by the step
+	Restarted []string // all the Pods of the workload recreated by a restart, set by ListRestartedPods
+}
+
+// String - returns a human readable description of the step
+func (s CleanupStep) String() string {
+	if s.Action == CleanupRestart {
+		desc := fmt.Sprintf("restart %s in namespace %s (%s)", s.Owner, s.Namespace, strings.Join(s.Pods, ", "))
+		if len(s.Restarted) > 0 {
+			desc += fmt.Sprintf(", recreating all its %d Pods: %s", len(s.Restarted), strings.Join(s.Restarted, ", "))
+		}
+		return desc
+	}
+
+	return fmt.Sprintf("evict Pod %s in namespace %s", s.Pods[0], s.Namespace)
+}
+
+// ListEphemeralContainerUsage - returns the Pods of namespace, all the namespaces when empty, holding at
+// least one ephemeral container whose name starts with one of the prefixes
+func (svc *Service) ListEphemeralContainerUsage(
+	ctx context.Context, // context passed to the function
+	namespace string, // namespace of the Pods, all the namespaces when empty
+	prefixes []string, // prefixes of the names of the containers injected by netassert
+) ([]EphemeralContainerUsage, error) {
+	pods, err := svc.Client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list Pods: %w", err)
+	}
+
+	owners := make(replicaSetOwners)
+	var usages []EphemeralContainerUsage
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		usage := EphemeralContainerUsage{
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Total:     len(pod.Spec.EphemeralContainers),
+		}
+
+		injected := make(map[string]bool)
+		for _, ec := range pod.Spec.EphemeralContainers {
+			if hasAnyPrefix(ec.Name, prefixes) {
+				injected[ec.Name] = true
+				usage.Netassert++
+			}
+		}
+
+		if usage.Netassert == 0 {
+			continue
+		}
+
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if injected[status.Name] && status.State.Running != nil {
+				usage.Running++
+			}
+		}
+
+		usage.Owner, err = svc.podOwner(ctx, pod, owners)
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, usage)
+	}
+
+	return usages, nil
+}
+
+// hasAnyPrefix - returns true when name is one of the prefixes followed by a dash
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix+"-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replicaSetOwners - workloads controlling the ReplicaSets, by namespace/name of the ReplicaSet, so that
+// each ReplicaSet is read once
+type replicaSetOwners map[string]*Owner
+
+// podOwner - returns the workload controlling a Pod, the Deployment is returned for the Pods of a
+// ReplicaSet owned by a Deployment
+func (svc *Service) podOwner(ctx context.Context, pod *corev1.Pod, owners replicaSetOwners) (*Owner, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+
+	if ref.Kind != "ReplicaSet" {
+		return &Owner{Kind: ref.Kind, Name: ref.Name}, nil
+	}
+
+	key := pod.Namespace + "/" + ref.Name
+	if owner, ok := owners[key]; ok {
+		return owner, nil
+	}
+
+	rs, err := svc.Client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the ReplicaSet %s of Pod %s in namespace %s: %w",
+			ref.Name, pod.Name, pod.Namespace, err)
+	}
+
+	owner := &Owner{Kind: ref.Kind, Name: ref.Name}
+	if rsRef := metav1.GetControllerOf(rs); rsRef != nil && rsRef.Kind == "Deployment" {
+		owner = &Owner{Kind: rsRef.Kind, Name: rsRef.Name}
+	}
+	owners[key] = owner
+
+	return owner, nil
+}
+
+// PlanCleanup - returns the steps removing the ephemeral containers of the Pods holding at least
+// threshold netassert containers, and the Pods that cannot be cleaned up with the reason why. The Pods
+// that are not controlled by a workload would not be recreated and the Pods running netassert
+// containers are being tested, so they are never cleaned up, nor are the workloads they belong to
+// restarted as a restart recreates all their Pods.
+func PlanCleanup(
+	usages []EphemeralContainerUsage, // Pods holding netassert ephemeral containers
+	threshold int, // minimum number of netassert ephemeral containers of the Pods to clean up
+	action CleanupAction, // how the Pods are cleaned up
+) ([]CleanupStep, map[string]string) {
+	var steps []CleanupStep
+	skipped := make(map[string]string)
+	restarts := make(map[string]int) // index of the restart step of each workload
+
+	// Pod of each workload in which netassert containers are still running
+	busy := make(map[string]string)
+	for _, usage := range usages {
+		if usage.Owner != nil && usage.Running > 0 {
+			busy[usage.Namespace+"/"+usage.Owner.String()] = usage.Pod
+		}
+	}
+
+	for _, usage := range usages {
+		if usage.Netassert < threshold {
+			continue
+		}
+
+		ref := usage.Namespace + "/" + usage.Pod
+
+		switch {
+		case usage.Owner == nil:
+			skipped[ref] = "the Pod is not controlled by a workload and would not be recreated"
+			continue
+		case usage.Running > 0:
+			skipped[ref] = "netassert containers are still running in the Pod"
+			continue
+		}
+
+		if action == CleanupEvict {
+			steps = append(steps, CleanupStep{Action: CleanupEvict, Namespace: usage.Namespace, Pods: []string{usage.Pod}})
+			continue
+		}
+
+		if !slices.Contains([]string{"Deployment", "StatefulSet", "DaemonSet"}, usage.Owner.Kind) {
+			skipped[ref] = fmt.Sprintf("%s cannot be restarted, use the evict action instead", usage.Owner)
+			continue
+		}
+
+		key := usage.Namespace + "/" + usage.Owner.String()
+		if pod, ok := busy[key]; ok {
+			skipped[ref] = fmt.Sprintf("netassert containers are still running in Pod %s, which restarting %s "+
+				"would recreate, use the evict action instead", pod, usage.Owner)
+			continue
+		}
+
+		if i, ok := restarts[key]; ok {
+			steps[i].Pods = append(steps[i].Pods, usage.Pod)
+			continue
+		}
+
+		restarts[key] = len(steps)
+		steps = append(steps, CleanupStep{
+			Action:    CleanupRestart,
+			Namespace: usage.Namespace,
+			Owner:     usage.Owner,
+			Pods:      []string{usage.Pod},
+		})
+	}
+
+	return steps, skipped
+}
+
+// ListRestartedPods - lists in the steps restarting a workload all the Pods of the workload, as the
+// restart recreates the Pods holding few or no netassert containers too
+func (svc *Service) ListRestartedPods(ctx context.Context, steps []CleanupStep) error {
+	owners := make(replicaSetOwners)
+
+	for i := range steps {
+		step := &steps[i]
+		if step.Action != CleanupRestart {
+			continue
+		}
+
+		selector, err := svc.workloadSelector(ctx, step.Namespace, *step.Owner)
+		if err != nil {
+			return err
+		}
+
+		pods, err := svc.Client.CoreV1().Pods(step.Namespace).List(ctx,
+			metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return fmt.Errorf("unable to list the Pods of %s in namespace %s: %w", step.Owner, step.Namespace, err)
+		}
+
+		// the selector of a workload may also match the Pods of other workloads
+		step.Restarted = nil
+		for j := range pods.Items {
+			owner, err := svc.podOwner(ctx, &pods.Items[j], owners)
+			if err != nil {
+				return err
+			}
+
+			if owner != nil && *owner == *step.Owner {
+				step.Restarted = append(step.Restarted, pods.Items[j].Name)
+			}
+		}
+		slices.Sort(step.Restarted)
+	}
+
+	return nil
+}
+
+// workloadSelector - returns the selector of the Pods of a workload that can be restarted
+func (svc *Service) workloadSelector(ctx context.Context, namespace string, owner Owner) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+
+	switch owner.Kind {
+	case "Deployment":
+		deploy, err := svc.Client.AppsV1().Deployments(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s in namespace %s: %w", owner, namespace, err)
+		}
+		selector = deploy.Spec.Selector
+	case "StatefulSet":
+		ss, err := svc.Client.AppsV1().StatefulSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s in namespace %s: %w", owner, namespace, err)
+		}
+		selector = ss.Spec.Selector
+	case "DaemonSet":
+		ds, err := svc.Client.AppsV1().DaemonSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s in namespace %s: %w", owner, namespace, err)
+		}
+		selector = ds.Spec.Selector
+	default:
+		return nil, fmt.Errorf("%s cannot be restarted", owner)
+	}
+
+	podSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of %s in namespace %s: %w", owner, namespace, err)
+	}
+
+	return podSelector, nil
+}
+
+// ApplyCleanupStep - restarts the workload or evicts the Pod of a cleanup step
+func (svc *Service) ApplyCleanupStep(ctx context.Context, step CleanupStep) error {
+	switch step.Action {
+	case CleanupEvict:
+		eviction := &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: step.Pods[0], Namespace: step.Namespace},
+		}
+		if err := svc.Client.PolicyV1().Evictions(step.Namespace).Evict(ctx, eviction); err != nil {
+			return fmt.Errorf("unable to evict Pod %s in namespace %s: %w", step.Pods[0], step.Namespace, err)
+		}
+		return nil
+	case CleanupRestart:
+		return svc.restartWorkload(ctx, step.Namespace, *step.Owner)
+	default:
+		return fmt.Errorf("unsupported cleanup action %q", step.Action)
+	}
+}
+
+// restartWorkload - restarts the Pods of a workload by updating the restartedAt annotation of its Pod template
+func (svc *Service) restartWorkload(ctx context.Context, namespace string, owner Owner) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+
+	var err error
+	switch owner.Kind {
+	case "Deployment":
+		_, err = svc.Client.AppsV1().Deployments(namespace).Patch(ctx, owner.Name,
+			types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = svc.Client.AppsV1().StatefulSets(namespace).Patch(ctx, owner.Name,
+			types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case "DaemonSet":
+		_, err = svc.Client.AppsV1().DaemonSets(namespace).Patch(ctx, owner.Name,
+			types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	default:
+		return fmt.Errorf("%s cannot be restarted", owner)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to restart %s in namespace %s: %w", owner, namespace, err)
+	}
+
+	return nil
+}
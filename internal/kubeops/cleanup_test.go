@@ -0,0 +1,214 @@
+package kubeops
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newPodWithEphemeralContainers - returns a Pod holding the ephemeral containers in names, the
+// containers in running are running
+func newPodWithEphemeralContainers(name string, owner metav1.Object, kind string, names []string, running ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web"}}
+
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind(kind)),
+		}
+	}
+
+	for _, n := range names {
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: n},
+		})
+
+		status := corev1.ContainerStatus{Name: n}
+		if slices.Contains(running, n) {
+			status.State.Running = &corev1.ContainerStateRunning{}
+		} else {
+			status.State.Terminated = &corev1.ContainerStateTerminated{}
+		}
+		pod.Status.EphemeralContainerStatuses = append(pod.Status.EphemeralContainerStatuses, status)
+	}
+
+	return pod
+}
+
+func TestListEphemeralContainerUsage(t *testing.T) {
+	r := require.New(t)
+
+	deploy := getDeploymentObject("web", "web", 1)
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f", Namespace: "web", UID: "rs-uid"}}
+	rs.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(deploy, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+	}
+	ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "web", UID: "ss-uid"}}
+
+	client := fake.NewSimpleClientset(deploy, rs,
+		newPodWithEphemeralContainers("web-5d8f-abcde", rs, "ReplicaSet",
+			[]string{"netassertv2-client-aaa", "netassertv2-client-bbb", "debugger-ccc"}, "netassertv2-client-bbb"),
+		newPodWithEphemeralContainers("db-0", ss, "StatefulSet", []string{"netassertv2-sniffer-aaa"}),
+		newPodWithEphemeralContainers("standalone", nil, "", []string{"netassertv2-client-aaa"}),
+		newPodWithEphemeralContainers("untouched", nil, "", []string{"debugger-aaa"}),
+	)
+	svc := New(client, hclog.NewNullLogger())
+
+	usages, err := svc.ListEphemeralContainerUsage(context.Background(), "",
+		[]string{"netassertv2-client", "netassertv2-sniffer"})
+	r.NoError(err)
+	r.Equal([]EphemeralContainerUsage{
+		{Namespace: "web", Pod: "db-0", Total: 1, Netassert: 1, Owner: &Owner{Kind: "StatefulSet", Name: "db"}},
+		{Namespace: "web", Pod: "standalone", Total: 1, Netassert: 1},
+		{Namespace: "web", Pod: "web-5d8f-abcde", Total: 3, Netassert: 2, Running: 1,
+			Owner: &Owner{Kind: "Deployment", Name: "web"}},
+	}, usages)
+}
+
+func TestPlanCleanup(t *testing.T) {
+	r := require.New(t)
+
+	deploy := &Owner{Kind: "Deployment", Name: "web"}
+	usages := []EphemeralContainerUsage{
+		{Namespace: "web", Pod: "web-1", Netassert: 12, Owner: deploy},
+		{Namespace: "web", Pod: "web-2", Netassert: 10, Owner: deploy},
+		{Namespace: "web", Pod: "web-3", Netassert: 2, Owner: deploy},
+		{Namespace: "web", Pod: "busy", Netassert: 10, Running: 1, Owner: deploy},
+		{Namespace: "web", Pod: "standalone", Netassert: 20},
+		{Namespace: "web", Pod: "job-1", Netassert: 20, Owner: &Owner{Kind: "Job", Name: "job"}},
+		{Namespace: "db", Pod: "db-0", Netassert: 10, Owner: &Owner{Kind: "StatefulSet", Name: "db"}},
+	}
+
+	steps, skipped := PlanCleanup(usages, 10, CleanupRestart)
+	r.Equal([]CleanupStep{
+		{Action: CleanupRestart, Namespace: "db", Owner: &Owner{Kind: "StatefulSet", Name: "db"}, Pods: []string{"db-0"}},
+	}, steps)
+	// the restart of the Deployment would recreate the Pod being tested
+	r.Len(skipped, 5)
+	r.Contains(skipped["web/web-1"], "still running in Pod busy, which restarting Deployment/web would recreate")
+	r.Contains(skipped["web/web-2"], "still running in Pod busy")
+	r.Contains(skipped["web/busy"], "netassert containers are still running in the Pod")
+
+	idle := slices.DeleteFunc(slices.Clone(usages), func(u EphemeralContainerUsage) bool { return u.Pod == "busy" })
+	steps, skipped = PlanCleanup(idle, 10, CleanupRestart)
+	r.Equal([]CleanupStep{
+		{Action: CleanupRestart, Namespace: "web", Owner: deploy, Pods: []string{"web-1", "web-2"}},
+		{Action: CleanupRestart, Namespace: "db", Owner: &Owner{Kind: "StatefulSet", Name: "db"}, Pods: []string{"db-0"}},
+	}, steps)
+	r.Equal("restart Deployment/web in namespace web (web-1, web-2)", steps[0].String())
+	r.Len(skipped, 2)
+	r.Contains(skipped["web/standalone"], "not controlled")
+	r.Contains(skipped["web/job-1"], "Job/job cannot be restarted")
+
+	steps, skipped = PlanCleanup(usages, 10, CleanupEvict)
+	r.Len(steps, 4)
+	r.Equal(CleanupStep{Action: CleanupEvict, Namespace: "web", Pods: []string{"job-1"}}, steps[2])
+	r.Equal("evict Pod job-1 in namespace web", steps[2].String())
+	r.Len(skipped, 2)
+}
+
+func TestService_ListRestartedPods(t *testing.T) {
+	r := require.New(t)
+
+	deploy := getDeploymentObject("web", "web", 2)
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f", Namespace: "web", UID: "rs-uid"}}
+	rs.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(deploy, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+	}
+
+	// withLabels - sets the labels of a Pod
+	withLabels := func(pod *corev1.Pod, app string) *corev1.Pod {
+		pod.Labels = map[string]string{"app": app}
+		return pod
+	}
+
+	client := fake.NewSimpleClientset(deploy, rs,
+		withLabels(newPodWithEphemeralContainers("web-5d8f-a", rs, "ReplicaSet", []string{"netassert-1"}), "web"),
+		withLabels(newPodWithEphemeralContainers("web-5d8f-b", rs, "ReplicaSet", nil), "web"),
+		// the selector of the Deployment matches a Pod it does not control
+		withLabels(newPodWithEphemeralContainers("web-debug", nil, "", nil), "web"),
+		withLabels(newPodWithEphemeralContainers("db-0", nil, "", nil), "db"),
+	)
+	svc := New(client, hclog.NewNullLogger())
+
+	steps := []CleanupStep{
+		{
+			Action: CleanupRestart, Namespace: "web", Owner: &Owner{Kind: "Deployment", Name: "web"},
+			Pods: []string{"web-5d8f-a"},
+		},
+		{Action: CleanupEvict, Namespace: "web", Pods: []string{"db-0"}},
+	}
+	r.NoError(svc.ListRestartedPods(context.Background(), steps))
+
+	r.Equal([]string{"web-5d8f-a", "web-5d8f-b"}, steps[0].Restarted)
+	r.Equal("restart Deployment/web in namespace web (web-5d8f-a), recreating all its 2 Pods: web-5d8f-a, web-5d8f-b",
+		steps[0].String())
+	r.Empty(steps[1].Restarted)
+
+	// only the Pods selected by the Deployment are listed, and its ReplicaSet is read once
+	var listed []string
+	replicaSetGets := 0
+	for _, action := range client.Actions() {
+		switch {
+		case action.Matches("list", "pods"):
+			listed = append(listed, action.(k8stesting.ListAction).GetListRestrictions().Labels.String())
+		case action.Matches("get", "replicasets"):
+			replicaSetGets++
+		}
+	}
+	r.Equal([]string{"app=web"}, listed)
+	r.Equal(1, replicaSetGets)
+
+	err := svc.ListRestartedPods(context.Background(), []CleanupStep{
+		{Action: CleanupRestart, Namespace: "web", Owner: &Owner{Kind: "StatefulSet", Name: "missing"}},
+	})
+	r.ErrorContains(err, "unable to get StatefulSet/missing in namespace web")
+}
+
+func TestApplyCleanupStep(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("restart", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(fake.NewSimpleClientset(getDeploymentObject("web", "web", 1)), hclog.NewNullLogger())
+
+		r.NoError(svc.ApplyCleanupStep(ctx, CleanupStep{
+			Action: CleanupRestart, Namespace: "web", Owner: &Owner{Kind: "Deployment", Name: "web"},
+			Pods: []string{"web-1"},
+		}))
+
+		deploy, err := svc.Client.AppsV1().Deployments("web").Get(ctx, "web", metav1.GetOptions{})
+		r.NoError(err)
+		r.NotEmpty(deploy.Spec.Template.Annotations[restartedAtAnnotation])
+
+		err = svc.ApplyCleanupStep(ctx, CleanupStep{
+			Action: CleanupRestart, Namespace: "web", Owner: &Owner{Kind: "Deployment", Name: "missing"},
+		})
+		r.ErrorContains(err, "unable to restart Deployment/missing in namespace web")
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		r := require.New(t)
+		client := fake.NewSimpleClientset()
+		var evicted string
+		client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			evicted = action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+			return true, nil, nil
+		})
+		svc := New(client, hclog.NewNullLogger())
+
+		r.NoError(svc.ApplyCleanupStep(ctx, CleanupStep{Action: CleanupEvict, Namespace: "web", Pods: []string{"web-1"}}))
+		r.Equal("web-1", evicted)
+	})
+}
@@ -2,18 +2,22 @@ package kubeops
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// generateKubernetsClient - generates a kubernetes client set from default file locations
+// defaultRESTConfig - builds the client configuration from default file locations
 // first checks KUBECONFIG environment variable
 // then the Home directory of the user
 // then finally it checks if the program is running in a Pod
-func generateKubernetesClient() (kubernetes.Interface, error) {
+func defaultRESTConfig() (*rest.Config, error) {
 	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(), nil,
 	).ClientConfig()
@@ -25,35 +29,66 @@ func generateKubernetesClient() (kubernetes.Interface, error) {
 		}
 	}
 
-	k8sClient, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-	}
-
-	return k8sClient, nil
+	return config, nil
 }
 
-// genK8sClientFromKubeConfigFile - Generates kubernetes config file from user supplied kubeConfigPath file
-func genK8sClientFromKubeConfigFile(kubeConfigPath string) (kubernetes.Interface, error) {
+// restConfigFromKubeConfigFile - builds the client configuration from user supplied kubeConfigPath file
+func restConfigFromKubeConfigFile(kubeConfigPath string) (*rest.Config, error) {
 	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build kubeconfig from file %s: %w", kubeConfigPath, err)
 	}
 
+	return config, nil
+}
+
+// newServiceFromConfig - builds a new Service with the clients generated from config
+func newServiceFromConfig(config *rest.Config, l hclog.Logger) (*Service, error) {
 	k8sClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client from file %s: %w", kubeConfigPath, err)
+		return &Service{}, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
-	return k8sClient, nil
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return &Service{}, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
+	}
+
+	return &Service{
+		Client:  k8sClient,
+		Dynamic: dynamicClient,
+		Config:  config,
+		Log:     l,
+	}, nil
 }
 
 // Service exposes the operations on various K8s resources
 type Service struct {
-	Client kubernetes.Interface // kubernetes client-set
-	Log    hclog.Logger         // logger embedded in our service
+	Client  kubernetes.Interface // kubernetes client-set
+	Dynamic dynamic.Interface    // kubernetes dynamic client, used for the custom resources
+	Config  *rest.Config         // configuration of the clients, used for the streaming subresources such as exec
+	Log     hclog.Logger         // logger embedded in our service
+
+	podTrackersMu     sync.Mutex             // guards podTrackers and their users
+	podTrackers       map[string]*podTracker // trackers of the status of the Pods, by namespace
+	podTrackerIdleFor time.Duration          // time an unused tracker keeps running, defaultPodTrackerIdleTimeout when zero
+
+	probePodsMu sync.Mutex                    // guards probePods
+	probePods   map[types.NamespacedName]bool // probe Pods created and not deleted yet
 }
 
+// Executor - how the scanner and sniffer containers of the tests are run
+type Executor string
+
+const (
+	// ExecutorEphemeral - the containers are injected in the tested Pods as ephemeral containers
+	ExecutorEphemeral Executor = "ephemeral"
+	// ExecutorPod - the containers run in probe Pods impersonating the tested Pods, see ProbePodExecutor
+	ExecutorPod Executor = "pod"
+	// ExecutorExec - the connections are checked by commands run in the tested containers, see ExecExecutor
+	ExecutorExec Executor = "exec"
+)
+
 // New - builds a new Service that can interface with Kubernetes
 func New(client kubernetes.Interface, l hclog.Logger) *Service {
 	return &Service{
@@ -64,26 +99,20 @@ func New(client kubernetes.Interface, l hclog.Logger) *Service {
 
 // NewDefaultService - builds a new Service looking for a KubeConfig in various locations
 func NewDefaultService(l hclog.Logger) (*Service, error) {
-	clientSet, err := generateKubernetesClient()
+	config, err := defaultRESTConfig()
 	if err != nil {
 		return &Service{}, err
 	}
 
-	return &Service{
-		Client: clientSet,
-		Log:    l,
-	}, nil
+	return newServiceFromConfig(config, l)
 }
 
 // NewServiceFromKubeConfigFile - builds a new Service using KubeConfig file location passed by the caller
 func NewServiceFromKubeConfigFile(kubeConfigPath string, l hclog.Logger) (*Service, error) {
-	clientSet, err := genK8sClientFromKubeConfigFile(kubeConfigPath)
+	config, err := restConfigFromKubeConfigFile(kubeConfigPath)
 	if err != nil {
 		return &Service{}, err
 	}
 
-	return &Service{
-		Client: clientSet,
-		Log:    l,
-	}, nil
+	return newServiceFromConfig(config, l)
 }
@@ -60,6 +60,11 @@ func TestLaunchEphemeralContainerInPod_InvalidEphemeralContainer(t *testing.T) {
 			3,                // no. of matches that triggers an exit with status 0
 			"eth0",           // the network interface to read the packets from
 			3,                // timeout for the ephemeral container
+			"",               // only the packets sent from this range of addresses match
+			ContainerSettings{ // optional settings of the container
+				ImagePullPolicy:     corev1.PullIfNotPresent,
+				TargetContainerName: "app",
+			},
 		)
 
 		r.NoError(err, "failed to Build Ephemeral Container ")
@@ -71,6 +76,9 @@ func TestLaunchEphemeralContainerInPod_InvalidEphemeralContainer(t *testing.T) {
 		gotName := pod.Spec.EphemeralContainers[0].EphemeralContainerCommon.Name
 
 		r.Equal(ephContainerName, gotName)
+		r.Equal(corev1.PullIfNotPresent, pod.Spec.EphemeralContainers[0].ImagePullPolicy)
+		r.Equal("app", pod.Spec.EphemeralContainers[0].TargetContainerName)
+		r.Equal(RestrictedSecurityProfile().Sniffer, pod.Spec.EphemeralContainers[0].SecurityContext)
 
 		r.Equal(len(pod.Spec.EphemeralContainers), 1)
 	})
@@ -87,14 +95,16 @@ func TestLaunchEphemeralContainerInPod_InvalidEphemeralContainer(t *testing.T) {
 
 		// create an invalid ephemeral container
 		ec, err := svc.BuildEphemeralSnifferContainer(
-			"eph1",    // name of the ephemeral container
-			"foo:1.2", // image location of the container
-			"foo",     // search for this string in the captured packet
-			1024,      // snapLength to capture
-			"tcp",     // protocol to capture
-			3,         // no. of matches that triggers an exit with status 0
-			"eth0",    // the network interface to read the packets from
-			3,         // timeout for the ephemeral container
+			"eph1",              // name of the ephemeral container
+			"foo:1.2",           // image location of the container
+			"foo",               // search for this string in the captured packet
+			1024,                // snapLength to capture
+			"tcp",               // protocol to capture
+			3,                   // no. of matches that triggers an exit with status 0
+			"eth0",              // the network interface to read the packets from
+			3,                   // timeout for the ephemeral container
+			"",                  // only the packets sent from this range of addresses match
+			ContainerSettings{}, // optional settings of the container
 		)
 
 		r.NoError(err, "failed to Build Ephemeral Container ")
@@ -105,3 +115,34 @@ func TestLaunchEphemeralContainerInPod_InvalidEphemeralContainer(t *testing.T) {
 		r.Contains(err.Error(), `pods "test-pod" not found`)
 	})
 }
+
+func TestBuildEphemeralSnifferContainer_SourceCIDR(t *testing.T) {
+	r := require.New(t)
+	svc := Service{Client: fake.NewSimpleClientset(), Log: hclog.NewNullLogger()}
+
+	ec, err := svc.BuildEphemeralSnifferContainer("sniffer", "sniffer:latest", "msg", 1024, "udp", 3, "eth0", 10,
+		"10.10.0.0/24", ContainerSettings{})
+	r.NoError(err)
+	r.Contains(ec.Env, corev1.EnvVar{Name: "SOURCE_CIDR", Value: "10.10.0.0/24"})
+
+	// the variable is not set when no source range is expected
+	ec, err = svc.BuildEphemeralSnifferContainer("sniffer", "sniffer:latest", "msg", 1024, "udp", 3, "eth0", 10,
+		"", ContainerSettings{})
+	r.NoError(err)
+	for _, env := range ec.Env {
+		r.NotEqual("SOURCE_CIDR", env.Name)
+	}
+}
+
+func TestParseSnifferSourceIPs(t *testing.T) {
+	r := require.New(t)
+
+	logs := "starting capture on eth0\n" +
+		"matched packet source_ip=10.10.0.5 length=78\n" +
+		"matched packet source_ip=fd00::5 length=98\n" +
+		"matched packet source_ip=10.10.0.5 length=78\n" +
+		"matched packet source_ip=invalid\n"
+
+	r.Equal([]string{"10.10.0.5", "fd00::5"}, ParseSnifferSourceIPs(logs))
+	r.Empty(ParseSnifferSourceIPs("no packets were matched"))
+}
@@ -3,18 +3,36 @@ package kubeops
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
-	"k8s.io/utils/pointer"
 )
 
+const (
+	// envSourceCIDR - environment variable of the sniffer holding the range of the expected source addresses
+	envSourceCIDR = "SOURCE_CIDR"
+	// sourceIPLogField - prefix of the field of the sniffer logs holding the source address of a matched packet
+	sourceIPLogField = "source_ip="
+)
+
+// ErrContainerNotStarted - returned when an injected container is waiting for an image that cannot be pulled,
+// it would not start before the timeout of its test
+var ErrContainerNotStarted = errors.New("container cannot start")
+
+// containerStartFailures - reasons of the waiting state of a container whose image cannot be pulled, an
+// ErrImagePull is often transient and is only fatal once the kubelet backs off with ImagePullBackOff
+var containerStartFailures = []string{"ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+
 // LaunchEphemeralContainerInPod - Launches an ephemeral container in running Pod
 func (svc *Service) LaunchEphemeralContainerInPod(
 	ctx context.Context, // the context
@@ -62,6 +80,56 @@ func (svc *Service) LaunchEphemeralContainerInPod(
 	return newPod, ec.Name, nil
 }
 
+// ContainerSettings - optional settings applied to the injected containers
+type ContainerSettings struct {
+	ImagePullPolicy     corev1.PullPolicy // image pull policy, the cluster default is used when empty
+	SecurityProfile     SecurityProfile   // security contexts of the containers, restricted by default
+	TargetContainerName string            // container whose namespaces are shared, the Pod ones are used when empty
+	// Resources are not allowed for ephemeral containers by the API server, they use the spare
+	// resources already allocated to the Pod, so they are only applied to containers that run in their own Pod
+	Resources corev1.ResourceRequirements
+}
+
+// applyToEphemeralContainer - applies the settings that are supported by ephemeral containers
+func (cs ContainerSettings) applyToEphemeralContainer(ec *corev1.EphemeralContainer) {
+	ec.ImagePullPolicy = cs.ImagePullPolicy
+}
+
+// HasResources - returns true if requests or limits are set
+func (cs ContainerSettings) HasResources() bool {
+	return len(cs.Resources.Requests) > 0 || len(cs.Resources.Limits) > 0
+}
+
+// SupportsContainerResources - returns false as the resources of the ephemeral containers cannot be set
+func (svc *Service) SupportsContainerResources() bool {
+	return false
+}
+
+// ParseResourceList - parses a map of resource names to quantities such as cpu=10m or memory=32Mi
+func ParseResourceList(m map[string]string) (corev1.ResourceList, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	rl := make(corev1.ResourceList, len(m))
+	for name, value := range m {
+		switch corev1.ResourceName(name) {
+		case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		default:
+			return nil, fmt.Errorf("unsupported resource %q", name)
+		}
+
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for resource %q: %w", value, name, err)
+		}
+
+		rl[corev1.ResourceName(name)] = q
+	}
+
+	return rl, nil
+}
+
 // BuildEphemeralSnifferContainer - builds an ephemeral sniffer container
 func (svc *Service) BuildEphemeralSnifferContainer(
 	name string, // name of the ephemeral container
@@ -72,6 +140,8 @@ func (svc *Service) BuildEphemeralSnifferContainer(
 	numberMatches int, // no. of matches that triggers an exit with status 0
 	intFace string, // the network interface to read the packets from
 	timeoutSec int, // timeout for the ephemeral container
+	sourceCIDR string, // only the packets sent from this range of addresses match, all of them when empty
+	settings ContainerSettings, // optional settings of the container
 ) (*corev1.EphemeralContainer, error) {
 	ec := corev1.EphemeralContainer{
 		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
@@ -103,25 +173,42 @@ func (svc *Service) BuildEphemeralSnifferContainer(
 					Value: strconv.Itoa(numberMatches),
 				},
 			},
-			Stdin:     false,
-			StdinOnce: false,
-			TTY:       false,
-			SecurityContext: &corev1.SecurityContext{
-				Capabilities: &corev1.Capabilities{
-					Add: []corev1.Capability{"NET_RAW"},
-				},
-				AllowPrivilegeEscalation: pointer.Bool(false),
-				RunAsNonRoot:             pointer.Bool(true),
-			},
+			Stdin:           false,
+			StdinOnce:       false,
+			TTY:             false,
+			SecurityContext: settings.SecurityProfile.SnifferSecurityContext(),
 		},
 		// empty string forces the container to run in the namespace of the Pod, rather than the container
-		// this is default value, only added here for readability
-		TargetContainerName: "",
+		TargetContainerName: settings.TargetContainerName,
 	}
 
+	// with a source range the sniffer only counts the packets sent from the range, and logs the source
+	// address of all the packets matching the search string as source_ip=<address>
+	if sourceCIDR != "" {
+		ec.Env = append(ec.Env, corev1.EnvVar{Name: envSourceCIDR, Value: sourceCIDR})
+	}
+
+	settings.applyToEphemeralContainer(&ec)
+
 	return &ec, nil
 }
 
+// ParseSnifferSourceIPs - returns the distinct source addresses of the matched packets logged by a sniffer
+// container started with a source range, in the order they were logged
+func ParseSnifferSourceIPs(logs string) []string {
+	var ips []string
+	for _, field := range strings.Fields(logs) {
+		ip, ok := strings.CutPrefix(field, sourceIPLogField)
+		if !ok || net.ParseIP(ip) == nil || slices.Contains(ips, ip) {
+			continue
+		}
+
+		ips = append(ips, ip)
+	}
+
+	return ips
+}
+
 // BuildEphemeralScannerContainer - builds an ephemeral scanner container
 func (svc *Service) BuildEphemeralScannerContainer(
 	name string, // name of the ephemeral container
@@ -131,6 +218,7 @@ func (svc *Service) BuildEphemeralScannerContainer(
 	protocol string, // protocol to used for connection
 	message string, // message to pass to the remote target
 	attempts int, // Number of attempts
+	settings ContainerSettings, // optional settings of the container
 ) (*corev1.EphemeralContainer, error) {
 	ec := corev1.EphemeralContainer{
 		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
@@ -158,120 +246,107 @@ func (svc *Service) BuildEphemeralScannerContainer(
 					Value: strconv.Itoa(attempts),
 				},
 			},
-			Stdin:     false,
-			StdinOnce: false,
-			TTY:       false,
-			SecurityContext: &corev1.SecurityContext{
-				RunAsNonRoot:             pointer.Bool(true),
-				AllowPrivilegeEscalation: pointer.Bool(false),
-			},
+			Stdin:           false,
+			StdinOnce:       false,
+			TTY:             false,
+			SecurityContext: settings.SecurityProfile.ScannerSecurityContext(),
 		},
 		// empty string forces the container to run in the namespace of the Pod, rather than the container
-		// this is default value, only added here for readability
-		TargetContainerName: "",
+		TargetContainerName: settings.TargetContainerName,
 	}
 
+	settings.applyToEphemeralContainer(&ec)
+
 	return &ec, nil
 }
 
-// GetExitStatusOfEphemeralContainer - returns the exit status of an EphemeralContainer in a pod
+// GetExitStatusOfEphemeralContainer - returns the exit status of an EphemeralContainer in a pod, together
+// with the report of its termination message, which is nil when the container did not write one
 func (svc *Service) GetExitStatusOfEphemeralContainer(
 	ctx context.Context, // the context
 	containerName string, // name of the ephemeral container
 	timeOut time.Duration, // maximum duration to poll for the container status
 	podName string, // name of the pod which has the ephemeral container
 	podNamespace string, // namespace of the pod which has the ephemeral container
-) (int, error) {
-	// we only want the Pods that are in running state
-	// and are in specific namespace
-	fieldSelector := fields.AndSelectors(
-		fields.OneTermEqualSelector(
-			"status.phase",
-			"Running",
-		),
-		fields.OneTermEqualSelector(
-			"metadata.name",
-			podName,
-		),
-		fields.OneTermEqualSelector(
-			"metadata.namespace",
-			podNamespace,
-		),
+) (int, *ContainerReport, error) {
+	var (
+		exitCode = -1
+		report   *ContainerReport
+		startErr error
 	)
 
-	podWatcher, err := svc.Client.CoreV1().Pods(podNamespace).Watch(ctx, metav1.ListOptions{
-		TypeMeta:      metav1.TypeMeta{},
-		FieldSelector: fieldSelector.String(),
-	})
-
-	defer func() {
-		if podWatcher != nil {
-			podWatcher.Stop()
-		}
-	}()
+	err := svc.watchPod(ctx, podName, podNamespace, timeOut, func(pod *corev1.Pod) bool {
+		svc.Log.Debug("Polling the status of ephemeral container",
+			"pod", pod.Name,
+			"namespace", pod.Namespace,
+			"container", containerName,
+		)
 
-	if err != nil {
-		return -1, err
-	}
+		for _, v := range pod.Status.EphemeralContainerStatuses {
 
-	timer := time.NewTimer(timeOut)
-	defer func() {
-		if ok := timer.Stop(); !ok {
-			svc.Log.Info("Unable to close the timer channel")
-		}
-	}()
+			if v.Name != containerName {
+				continue
+			}
 
-	for {
-		select {
-		case event := <-podWatcher.ResultChan():
+			if startErr = containerStartError(containerName, v.State); startErr != nil {
+				return true
+			}
 
-			pod, ok := event.Object.(*corev1.Pod)
-			// if this is not a pod object, then we skip
-			if !ok {
-				break // breaks from the select
+			if v.State.Waiting != nil {
+				svc.Log.Debug("Container state", "container", containerName, "state", "Waiting")
+				continue
 			}
 
-			svc.Log.Debug("Polling the status of ephemeral container",
-				"pod", pod.Name,
-				"namespace", pod.Namespace,
-				"container", containerName,
-			)
-
-			for _, v := range pod.Status.EphemeralContainerStatuses {
-
-				if v.Name != containerName {
-					continue
-				}
-
-				if v.State.Waiting != nil {
-					svc.Log.Debug("Container state", "container", containerName, "state", "Waiting")
-					continue
-				}
-
-				if v.State.Running != nil {
-					svc.Log.Debug("Container state", "container", containerName, "state", "Running")
-					continue
-				}
-
-				if v.State.Terminated != nil {
-					svc.Log.Info("Ephemeral container has finished executing", "name", containerName)
-					svc.Log.Debug("", "ContainerName", v.Name)
-					svc.Log.Debug("", "ExitCode", v.State.Terminated.ExitCode)
-					svc.Log.Debug("", "ContainerID", v.State.Terminated.ContainerID)
-					svc.Log.Debug("", "FinishedAt", v.State.Terminated.FinishedAt)
-					svc.Log.Debug("", "StartedAt", v.State.Terminated.StartedAt)
-					svc.Log.Debug("", "Message", v.State.Terminated.Message)
-					svc.Log.Debug("", "Reason", v.State.Terminated.Reason)
-					svc.Log.Debug("", "Signal", v.State.Terminated.Signal)
-					return int(v.State.Terminated.ExitCode), nil
-				}
+			if v.State.Running != nil {
+				svc.Log.Debug("Container state", "container", containerName, "state", "Running")
+				continue
+			}
 
+			if v.State.Terminated != nil {
+				svc.Log.Info("Ephemeral container has finished executing", "name", containerName)
+				svc.Log.Debug("", "ContainerName", v.Name)
+				svc.Log.Debug("", "ExitCode", v.State.Terminated.ExitCode)
+				svc.Log.Debug("", "ContainerID", v.State.Terminated.ContainerID)
+				svc.Log.Debug("", "FinishedAt", v.State.Terminated.FinishedAt)
+				svc.Log.Debug("", "StartedAt", v.State.Terminated.StartedAt)
+				svc.Log.Debug("", "Message", v.State.Terminated.Message)
+				svc.Log.Debug("", "Reason", v.State.Terminated.Reason)
+				svc.Log.Debug("", "Signal", v.State.Terminated.Signal)
+				exitCode = int(v.State.Terminated.ExitCode)
+				report = svc.parseTerminationMessage(containerName, v.State.Terminated.Message)
+				return true
 			}
 
-		case <-timer.C:
-			return -1, fmt.Errorf("container %v did not reach termination state in %v seconds", containerName, timeOut.Seconds())
-		case <-ctx.Done():
-			return -1, fmt.Errorf("process was cancelled: %w", ctx.Err())
 		}
+
+		return false
+	})
+
+	switch {
+	case startErr != nil:
+		return -1, nil, startErr
+	case err == nil:
+		return exitCode, report, nil
+	case ctx.Err() != nil:
+		return -1, nil, fmt.Errorf("process was cancelled: %w", ctx.Err())
+	case errors.Is(err, context.DeadlineExceeded):
+		return -1, nil, fmt.Errorf("container %v did not reach termination state in %v seconds", containerName, timeOut.Seconds())
+	default:
+		return -1, nil, err
 	}
 }
+
+// containerStartError - returns an error wrapping ErrContainerNotStarted when the container is waiting for an
+// image that cannot be pulled, and nil otherwise
+func containerStartError(containerName string, state corev1.ContainerState) error {
+	if state.Waiting == nil || !slices.Contains(containerStartFailures, state.Waiting.Reason) {
+		return nil
+	}
+
+	if state.Waiting.Message == "" {
+		return fmt.Errorf("%w: %s is in %s", ErrContainerNotStarted, containerName, state.Waiting.Reason)
+	}
+
+	return fmt.Errorf("%w: %s is in %s: %s", ErrContainerNotStarted, containerName, state.Waiting.Reason,
+		state.Waiting.Message)
+}
@@ -0,0 +1,458 @@
+package kubeops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+const (
+	// defaultExecConnectTimeout - default maximum duration of each connection attempt of the exec executor
+	defaultExecConnectTimeout = 5 * time.Second
+	// execOverhead - extra time given to each command to start in the container and to stream its output
+	execOverhead = 5 * time.Second
+	// execMaxOutputBytes - maximum number of bytes of the output of the commands kept for the logs
+	execMaxOutputBytes = 64 * 1024
+	// defaultContainerAnnotation - annotation of a Pod naming the container used by kubectl exec by default
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+)
+
+// errCommandNotFound - returned by an ExecFunc when the command is not available in the container
+var errCommandNotFound = errors.New("command not found")
+
+// ExecFunc - runs command in a container of a Pod and returns its standard output, its standard error and
+// its exit code, errCommandNotFound is returned when the command is not available in the container
+type ExecFunc func(
+	ctx context.Context, // the context, the command is stopped when it is cancelled
+	namespace string, // namespace of the Pod
+	pod string, // name of the Pod
+	container string, // name of the container
+	command []string, // command and its arguments
+) (string, string, int, error)
+
+// execProbe - a command checking that a TCP connection can be established from a container
+type execProbe struct {
+	name string
+	// command - returns the command connecting to host and port within timeout
+	command func(host, port string, timeout time.Duration) []string
+	// connected - returns true when the output of the command shows that the connection was established
+	connected func(exitCode int, stdout string) bool
+}
+
+// execProbes - the commands used to check the connections, in order of preference
+var execProbes = []execProbe{
+	{
+		name: "nc",
+		command: func(host, port string, timeout time.Duration) []string {
+			return []string{"nc", "-z", "-w", timeoutSeconds(timeout), host, port}
+		},
+		connected: func(exitCode int, _ string) bool { return exitCode == 0 },
+	},
+	{
+		// curl does not exit with zero when the server does not speak HTTP, so the time taken to
+		// establish the connection is checked instead, it is zero when no connection was established.
+		// Globbing is disabled, as the brackets of the IPv6 addresses are globbing patterns.
+		name: "curl",
+		command: func(host, port string, timeout time.Duration) []string {
+			return []string{"curl", "-s", "-g", "-o", "/dev/null", "-w", "%{time_connect}",
+				"--connect-timeout", timeoutSeconds(timeout), "--max-time", timeoutSeconds(2 * timeout),
+				"http://" + net.JoinHostPort(host, port) + "/"}
+		},
+		connected: func(_ int, stdout string) bool {
+			t, err := strconv.ParseFloat(strings.TrimSpace(stdout), 64)
+			return err == nil && t > 0
+		},
+	},
+	{
+		name: "bash",
+		command: func(host, port string, _ time.Duration) []string {
+			return []string{"bash", "-c", `exec 3<>"/dev/tcp/$0/$1"`, host, port}
+		},
+		connected: func(exitCode int, _ string) bool { return exitCode == 0 },
+	},
+}
+
+// timeoutSeconds - returns timeout as a number of seconds, rounded up
+func timeoutSeconds(timeout time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(timeout.Seconds())))
+}
+
+// execRun - a connectivity check running in a container
+type execRun struct {
+	cancel   context.CancelFunc
+	done     chan struct{} // closed once the check is over
+	exitCode int           // 0 when the connection was established, 1 otherwise
+	output   string        // output of the commands, used as the logs of the container
+	err      error         // set when the check could not be run
+}
+
+// ExecExecutor - checks the TCP connections by running nc, curl or bash in the tested containers through
+// the pods/exec subresource rather than injecting ephemeral containers, for the images that already ship
+// one of these commands. The first command available in a container is used, and UDP tests are not
+// supported as there is no sniffer to capture the packets.
+type ExecExecutor struct {
+	*Service
+	Exec           ExecFunc      // runs the commands, ExecInContainer by default
+	ConnectTimeout time.Duration // maximum duration of each connection attempt
+
+	mu       sync.Mutex
+	runs     map[string]*execRun // checks keyed by namespace/pod/name
+	detected map[string]int      // index in execProbes of the command available in each namespace/pod/container
+}
+
+// NewExecExecutor - returns an ExecExecutor running the commands with svc
+func NewExecExecutor(svc *Service) *ExecExecutor {
+	return &ExecExecutor{
+		Service:        svc,
+		Exec:           svc.ExecInContainer,
+		ConnectTimeout: defaultExecConnectTimeout,
+		runs:           make(map[string]*execRun),
+		detected:       make(map[string]int),
+	}
+}
+
+// BuildEphemeralSnifferContainer - always fails, the packets cannot be captured without a sniffer container
+func (ee *ExecExecutor) BuildEphemeralSnifferContainer(
+	_ string, // name of the ephemeral container
+	_ string, // image location of the container
+	_ string, // search for this string in the captured packet
+	_ int, // snapLength to capture
+	protocol string, // protocol to capture
+	_ int, // no. of matches that triggers an exit with status 0
+	_ string, // the network interface to read the packets from
+	_ int, // timeout for the ephemeral container
+	_ string, // only the packets sent from this range of addresses match
+	_ ContainerSettings, // optional settings of the container
+) (*corev1.EphemeralContainer, error) {
+	return nil, fmt.Errorf("%s tests are not supported by the %s executor, the packets cannot be captured "+
+		"without a sniffer container", protocol, ExecutorExec)
+}
+
+// LaunchEphemeralContainerInPod - starts checking the connection described by the environment of ec from
+// the container of pod targeted by ec, or its default container, and returns pod unchanged
+func (ee *ExecExecutor) LaunchEphemeralContainerInPod(
+	ctx context.Context, // the context
+	pod *corev1.Pod, // the Pod the connection is checked from
+	ec *corev1.EphemeralContainer, // the scanner container describing the connection
+) (*corev1.Pod, string, error) {
+	env := make(map[string]string, len(ec.Env))
+	for _, e := range ec.Env {
+		env[e.Name] = e.Value
+	}
+
+	if protocol := env["PROTOCOL"]; protocol != "tcp" {
+		return nil, "", fmt.Errorf("%s connections are not supported by the %s executor", protocol, ExecutorExec)
+	}
+
+	attempts, err := strconv.Atoi(env["ATTEMPTS"])
+	if err != nil || attempts < 1 {
+		attempts = 1
+	}
+
+	container := execContainer(pod, ec.TargetContainerName)
+	if container == "" {
+		return nil, "", fmt.Errorf("pod %s in namespace %s has no container to run the commands in",
+			pod.Name, pod.Namespace)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	run := &execRun{cancel: cancel, done: make(chan struct{}), exitCode: 1}
+
+	ee.mu.Lock()
+	ee.runs[execKey(pod.Namespace, pod.Name, ec.Name)] = run
+	ee.mu.Unlock()
+
+	ee.Log.Info("Checking connection with exec", "Pod", pod.Name, "Namespace", pod.Namespace,
+		"Container", container, "host", env["TARGET_HOST"], "port", env["TARGET_PORT"])
+
+	go func() {
+		defer close(run.done)
+		ee.check(runCtx, run, pod, container, env["TARGET_HOST"], env["TARGET_PORT"], attempts)
+	}()
+
+	return pod, ec.Name, nil
+}
+
+// execContainer - returns the container of pod the commands run in, target when it is set, then the
+// default container of kubectl exec and finally the first container
+func execContainer(pod *corev1.Pod, target string) string {
+	if target != "" {
+		return target
+	}
+
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		return name
+	}
+
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+
+	return ""
+}
+
+// execKey - returns the key of a check or of a detected command
+func execKey(namespace, pod, name string) string {
+	return namespace + "/" + pod + "/" + name
+}
+
+// check - tries to connect to host and port up to attempts times and records the outcome in run
+func (ee *ExecExecutor) check(
+	ctx context.Context, // the context, cancelled when the check is abandoned
+	run *execRun, // the check
+	pod *corev1.Pod, // the Pod the connection is checked from
+	container string, // the container the commands run in
+	host string, // host to connect to
+	port string, // port to connect to
+	attempts int, // maximum number of connection attempts
+) {
+	var output strings.Builder
+
+	defer func() {
+		run.output = string(tailBytes([]byte(output.String()), execMaxOutputBytes))
+	}()
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		probe, stdout, stderr, exitCode, err := ee.probeOnce(ctx, pod, container, host, port)
+		if err != nil {
+			run.err = err
+			fmt.Fprintf(&output, "attempt %d: %v\n", attempt, err)
+			return
+		}
+
+		connected := probe.connected(exitCode, stdout)
+		fmt.Fprintf(&output, "attempt %d: %s exited with code %d, connected: %t\n%s%s", attempt, probe.name,
+			exitCode, connected, stdout, stderr)
+
+		if connected {
+			run.exitCode = 0
+			return
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// probeOnce - makes a single connection attempt with the first command available in the container
+func (ee *ExecExecutor) probeOnce(
+	ctx context.Context, // the context
+	pod *corev1.Pod, // the Pod the connection is checked from
+	container string, // the container the commands run in
+	host string, // host to connect to
+	port string, // port to connect to
+) (execProbe, string, string, int, error) {
+	key := execKey(pod.Namespace, pod.Name, container)
+
+	ee.mu.Lock()
+	first := ee.detected[key]
+	ee.mu.Unlock()
+
+	for i := first; i < len(execProbes); i++ {
+		probe := execProbes[i]
+
+		attemptCtx, cancel := context.WithTimeout(ctx, ee.ConnectTimeout+execOverhead)
+		stdout, stderr, exitCode, err := ee.Exec(attemptCtx, pod.Namespace, pod.Name, container,
+			probe.command(host, port, ee.ConnectTimeout))
+		timedOut := attemptCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		switch {
+		case errors.Is(err, errCommandNotFound):
+			ee.Log.Debug("Command is not available in the container", "command", probe.name,
+				"Pod", pod.Name, "Namespace", pod.Namespace, "Container", container)
+			continue
+		case timedOut:
+			// the command did not return in time, so no connection was established
+			exitCode = -1
+		case err != nil:
+			return probe, stdout, stderr, exitCode, fmt.Errorf("unable to run %s in container %s of pod %s in namespace %s: %w",
+				probe.name, container, pod.Name, pod.Namespace, err)
+		}
+
+		ee.mu.Lock()
+		ee.detected[key] = i
+		ee.mu.Unlock()
+
+		return probe, stdout, stderr, exitCode, nil
+	}
+
+	names := make([]string, 0, len(execProbes))
+	for _, probe := range execProbes {
+		names = append(names, probe.name)
+	}
+
+	return execProbe{}, "", "", -1, fmt.Errorf("none of the commands %s is available in container %s of pod %s in namespace %s",
+		strings.Join(names, ", "), container, pod.Name, pod.Namespace)
+}
+
+// GetExitStatusOfEphemeralContainer - waits for a check to be over and returns 0 when the connection
+// was established and 1 otherwise, the commands of the checks do not write a report
+func (ee *ExecExecutor) GetExitStatusOfEphemeralContainer(
+	ctx context.Context, // the context
+	containerName string, // name of the scanner container of the check
+	timeOut time.Duration, // maximum duration to wait for the check
+	podName string, // name of the pod the connection is checked from
+	podNamespace string, // namespace of the pod the connection is checked from
+) (int, *ContainerReport, error) {
+	run, err := ee.run(podNamespace, podName, containerName)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	timer := time.NewTimer(timeOut)
+	defer timer.Stop()
+
+	select {
+	case <-run.done:
+	case <-timer.C:
+		run.cancel()
+		return -1, nil, fmt.Errorf("check %s did not complete in %v seconds", containerName, timeOut.Seconds())
+	case <-ctx.Done():
+		run.cancel()
+		return -1, nil, fmt.Errorf("process was cancelled: %w", ctx.Err())
+	}
+
+	if run.err != nil {
+		return -1, nil, run.err
+	}
+
+	return run.exitCode, nil, nil
+}
+
+// GetEphemeralContainerLogs - returns the tail of the output of the commands run by a check, at most
+// maxBytes long
+func (ee *ExecExecutor) GetEphemeralContainerLogs(
+	_ context.Context, // the context
+	containerName string, // name of the scanner container of the check
+	maxBytes int64, // maximum number of bytes of the logs to return
+	podName string, // name of the pod the connection is checked from
+	podNamespace string, // namespace of the pod the connection is checked from
+) (string, error) {
+	if maxBytes <= 0 {
+		return "", fmt.Errorf("maxBytes must be greater than zero")
+	}
+
+	run, err := ee.run(podNamespace, podName, containerName)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case <-run.done:
+	default:
+		return "", fmt.Errorf("check %s is still running", containerName)
+	}
+
+	return string(tailBytes([]byte(run.output), maxBytes)), nil
+}
+
+// ReleaseContainer - stops a check and forgets its output once its test is over
+func (ee *ExecExecutor) ReleaseContainer(_ context.Context, pod *corev1.Pod, containerName string) error {
+	key := execKey(pod.Namespace, pod.Name, containerName)
+
+	ee.mu.Lock()
+	run, ok := ee.runs[key]
+	delete(ee.runs, key)
+	ee.mu.Unlock()
+
+	if ok {
+		run.cancel()
+	}
+
+	return nil
+}
+
+// run - returns a check started by LaunchEphemeralContainerInPod
+func (ee *ExecExecutor) run(namespace, pod, name string) (*execRun, error) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	run, ok := ee.runs[execKey(namespace, pod, name)]
+	if !ok {
+		return nil, fmt.Errorf("no check %s was started in pod %s in namespace %s", name, pod, namespace)
+	}
+
+	return run, nil
+}
+
+// ExecInContainer - runs command in a container of a Pod through the pods/exec subresource, using
+// WebSockets and falling back to SPDY for the API servers that do not support them
+func (svc *Service) ExecInContainer(
+	ctx context.Context, // the context, the command is stopped when it is cancelled
+	namespace string, // namespace of the Pod
+	pod string, // name of the Pod
+	container string, // name of the container
+	command []string, // command and its arguments
+) (string, string, int, error) {
+	if svc.Config == nil {
+		return "", "", -1, fmt.Errorf("the REST configuration is needed to run commands in containers")
+	}
+
+	req := svc.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	wsExec, err := remotecommand.NewWebSocketExecutor(svc.Config, "GET", req.URL().String())
+	if err != nil {
+		return "", "", -1, fmt.Errorf("unable to create WebSocket executor: %w", err)
+	}
+
+	spdyExec, err := remotecommand.NewSPDYExecutor(svc.Config, "POST", req.URL())
+	if err != nil {
+		return "", "", -1, fmt.Errorf("unable to create SPDY executor: %w", err)
+	}
+
+	executor, err := remotecommand.NewFallbackExecutor(wsExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return "", "", -1, fmt.Errorf("unable to create executor: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+
+	var exitErr utilexec.CodeExitError
+	switch {
+	case err == nil:
+		return stdout.String(), stderr.String(), 0, nil
+	case errors.As(err, &exitErr) && (exitErr.Code == 126 || exitErr.Code == 127):
+		// the shells and the container runtimes exit with 126 or 127 when the command cannot be run
+		return stdout.String(), stderr.String(), exitErr.Code, errCommandNotFound
+	case errors.As(err, &exitErr):
+		return stdout.String(), stderr.String(), exitErr.Code, nil
+	case isCommandNotFound(err):
+		return stdout.String(), stderr.String(), -1, errCommandNotFound
+	default:
+		return stdout.String(), stderr.String(), -1, err
+	}
+}
+
+// isCommandNotFound - returns true when the container runtime failed to start the command as it does not exist
+func isCommandNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "executable file not found") || strings.Contains(msg, "no such file or directory")
+}
@@ -0,0 +1,182 @@
+package kubeops
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// fakeExec - ExecFunc recording the commands, the commands not in available are not found
+type fakeExec struct {
+	mu        sync.Mutex
+	available map[string]func() (string, int) // output and exit code of each available command
+	commands  [][]string
+	block     bool // the commands block until the context is cancelled
+}
+
+func (f *fakeExec) exec(ctx context.Context, _, _, _ string, command []string) (string, string, int, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	run, ok := f.available[command[0]]
+	f.mu.Unlock()
+
+	if !ok {
+		return "", "", 127, errCommandNotFound
+	}
+
+	if f.block {
+		<-ctx.Done()
+		return "", "", -1, ctx.Err()
+	}
+
+	stdout, exitCode := run()
+	return stdout, "", exitCode, nil
+}
+
+// newTestExecExecutor - returns an ExecExecutor running the commands with f
+func newTestExecExecutor(f *fakeExec) *ExecExecutor {
+	ee := NewExecExecutor(New(fake.NewSimpleClientset(), hclog.NewNullLogger()))
+	ee.Exec = f.exec
+	return ee
+}
+
+// newExecScanner - returns a scanner container connecting to 10.0.0.2:8080
+func newExecScanner(t *testing.T, ee *ExecExecutor, name string, attempts int) *corev1.EphemeralContainer {
+	ec, err := ee.BuildEphemeralScannerContainer(name, "scanner:latest", "10.0.0.2", "8080", "tcp", "msg",
+		attempts, ContainerSettings{})
+	require.NoError(t, err)
+	return ec
+}
+
+func TestExecExecutor(t *testing.T) {
+	ctx := context.Background()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "web"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web"}, {Name: "sidecar"}}},
+	}
+
+	t.Run("the first available command is used", func(t *testing.T) {
+		r := require.New(t)
+		f := &fakeExec{available: map[string]func() (string, int){
+			"curl": func() (string, int) { return "0.001234", 52 },
+		}}
+		ee := newTestExecExecutor(f)
+
+		launched, name, err := ee.LaunchEphemeralContainerInPod(ctx, pod, newExecScanner(t, ee, "scanner-1", 3))
+		r.NoError(err)
+		r.Equal(pod, launched)
+		r.Equal("scanner-1", name)
+
+		exitCode, _, err := ee.GetExitStatusOfEphemeralContainer(ctx, name, time.Minute, pod.Name, pod.Namespace)
+		r.NoError(err)
+		r.Equal(0, exitCode)
+		r.Equal([]string{"nc", "-z", "-w", "5", "10.0.0.2", "8080"}, f.commands[0])
+		r.Equal("curl", f.commands[1][0])
+		r.Len(f.commands, 2)
+
+		logs, err := ee.GetEphemeralContainerLogs(ctx, name, 1024, pod.Name, pod.Namespace)
+		r.NoError(err)
+		r.Contains(logs, "attempt 1: curl exited with code 52, connected: true")
+
+		// the detected command is used straight away by the next checks of the container
+		_, name, err = ee.LaunchEphemeralContainerInPod(ctx, pod, newExecScanner(t, ee, "scanner-2", 1))
+		r.NoError(err)
+		_, _, err = ee.GetExitStatusOfEphemeralContainer(ctx, name, time.Minute, pod.Name, pod.Namespace)
+		r.NoError(err)
+		r.Len(f.commands, 3)
+		r.Equal("curl", f.commands[2][0])
+
+		r.NoError(ee.ReleaseContainer(ctx, pod, name))
+		_, err = ee.GetEphemeralContainerLogs(ctx, name, 1024, pod.Name, pod.Namespace)
+		r.ErrorContains(err, "no check scanner-2 was started")
+	})
+
+	t.Run("every attempt is made before failing", func(t *testing.T) {
+		r := require.New(t)
+		f := &fakeExec{available: map[string]func() (string, int){
+			"nc": func() (string, int) { return "", 1 },
+		}}
+		ee := newTestExecExecutor(f)
+
+		sc := newExecScanner(t, ee, "scanner-1", 3)
+		sc.TargetContainerName = "sidecar"
+		_, name, err := ee.LaunchEphemeralContainerInPod(ctx, pod, sc)
+		r.NoError(err)
+
+		exitCode, _, err := ee.GetExitStatusOfEphemeralContainer(ctx, name, time.Minute, pod.Name, pod.Namespace)
+		r.NoError(err)
+		r.Equal(1, exitCode)
+		r.Len(f.commands, 3)
+	})
+
+	t.Run("no command is available", func(t *testing.T) {
+		r := require.New(t)
+		ee := newTestExecExecutor(&fakeExec{})
+
+		_, name, err := ee.LaunchEphemeralContainerInPod(ctx, pod, newExecScanner(t, ee, "scanner-1", 1))
+		r.NoError(err)
+
+		_, _, err = ee.GetExitStatusOfEphemeralContainer(ctx, name, time.Minute, pod.Name, pod.Namespace)
+		r.ErrorContains(err, "none of the commands nc, curl, bash is available in container web of pod web-1")
+	})
+
+	t.Run("the check times out", func(t *testing.T) {
+		r := require.New(t)
+		f := &fakeExec{block: true, available: map[string]func() (string, int){
+			"nc": func() (string, int) { return "", 0 },
+		}}
+		ee := newTestExecExecutor(f)
+
+		_, name, err := ee.LaunchEphemeralContainerInPod(ctx, pod, newExecScanner(t, ee, "scanner-1", 1))
+		r.NoError(err)
+
+		exitCode, _, err := ee.GetExitStatusOfEphemeralContainer(ctx, name, 10*time.Millisecond, pod.Name, pod.Namespace)
+		r.ErrorContains(err, "check scanner-1 did not complete")
+		r.Equal(-1, exitCode)
+	})
+
+	t.Run("UDP is not supported", func(t *testing.T) {
+		r := require.New(t)
+		ee := newTestExecExecutor(&fakeExec{})
+
+		_, err := ee.BuildEphemeralSnifferContainer("sniffer", "sniffer:latest", "msg", 1024, "udp", 3, "eth0",
+			10, "", ContainerSettings{})
+		r.ErrorContains(err, "udp tests are not supported by the exec executor")
+
+		ec, err := ee.BuildEphemeralScannerContainer("scanner", "scanner:latest", "10.0.0.2", "53", "udp", "msg",
+			3, ContainerSettings{})
+		r.NoError(err)
+		_, _, err = ee.LaunchEphemeralContainerInPod(ctx, pod, ec)
+		r.ErrorContains(err, "udp connections are not supported")
+	})
+}
+
+func TestExecContainer(t *testing.T) {
+	r := require.New(t)
+
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "web"}, {Name: "sidecar"}}}}
+	r.Equal("web", execContainer(pod, ""))
+	r.Equal("sidecar", execContainer(pod, "sidecar"))
+
+	pod.Annotations = map[string]string{defaultContainerAnnotation: "sidecar"}
+	r.Equal("sidecar", execContainer(pod, ""))
+
+	r.Equal("", execContainer(&corev1.Pod{}, ""))
+}
+
+func TestIsCommandNotFound(t *testing.T) {
+	r := require.New(t)
+
+	r.True(isCommandNotFound(errors.New(`OCI runtime exec failed: exec failed: unable to start container process: ` +
+		`exec: "nc": executable file not found in $PATH: unknown`)))
+	r.False(isCommandNotFound(utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}))
+}
@@ -0,0 +1,63 @@
+package kubeops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// logTailLines - maximum number of lines requested from the pods/log subresource
+	logTailLines int64 = 200
+)
+
+// GetEphemeralContainerLogs - returns the tail of the logs of an ephemeral container, at most maxBytes long
+func (svc *Service) GetEphemeralContainerLogs(
+	ctx context.Context, // the context
+	containerName string, // name of the ephemeral container
+	maxBytes int64, // maximum number of bytes of the logs to return
+	podName string, // name of the pod which has the ephemeral container
+	podNamespace string, // namespace of the pod which has the ephemeral container
+) (string, error) {
+	if maxBytes <= 0 {
+		return "", fmt.Errorf("maxBytes must be greater than zero")
+	}
+
+	tailLines := logTailLines
+	req := svc.Client.CoreV1().Pods(podNamespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: containerName,
+		TailLines: &tailLines,
+	})
+
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to stream logs of container %s in pod %s/%s: %w",
+			containerName, podNamespace, podName, err)
+	}
+	defer stream.Close()
+
+	logs, err := io.ReadAll(stream)
+	if err != nil {
+		return "", fmt.Errorf("unable to read logs of container %s in pod %s/%s: %w",
+			containerName, podNamespace, podName, err)
+	}
+
+	return string(tailBytes(logs, maxBytes)), nil
+}
+
+// tailBytes - returns the last maxBytes of b, when b is truncated the partial first line is dropped
+func tailBytes(b []byte, maxBytes int64) []byte {
+	if int64(len(b)) <= maxBytes {
+		return b
+	}
+
+	b = b[int64(len(b))-maxBytes:]
+	if i := bytes.IndexByte(b, '\n'); i >= 0 && i < len(b)-1 {
+		b = b[i+1:]
+	}
+
+	return b
+}
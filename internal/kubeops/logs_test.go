@@ -0,0 +1,34 @@
+package kubeops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetEphemeralContainerLogs(t *testing.T) {
+	r := require.New(t)
+	svc := New(fake.NewSimpleClientset(), hclog.NewNullLogger())
+
+	logs, err := svc.GetEphemeralContainerLogs(context.Background(), "scanner", 1024, "pod1", "ns1")
+	r.NoError(err)
+	r.Equal("fake logs", logs) // returned by the fake clientset
+
+	logs, err = svc.GetEphemeralContainerLogs(context.Background(), "scanner", 4, "pod1", "ns1")
+	r.NoError(err)
+	r.Equal("logs", logs)
+
+	_, err = svc.GetEphemeralContainerLogs(context.Background(), "scanner", 0, "pod1", "ns1")
+	r.Error(err)
+}
+
+func TestTailBytes(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal("line1\nline2\n", string(tailBytes([]byte("line1\nline2\n"), 100)))
+	r.Equal("line3\n", string(tailBytes([]byte("line1\nline2\nline3\n"), 9)))
+	r.Equal("ine3", string(tailBytes([]byte("line1\nline2\nline3"), 4)))
+}
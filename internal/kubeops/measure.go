@@ -0,0 +1,26 @@
+package kubeops
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// environment of the scanner container measuring the connection, the scanner writes the measurements
+// to the report of its termination message, see ContainerReport
+const (
+	envMeasure       = "MEASURE"        // set to true to measure the connection
+	envTransferBytes = "TRANSFER_BYTES" // number of bytes sent to the destination to measure the throughput
+)
+
+// MeasurementEnv - returns the environment of the scanner container measuring the connection, the
+// throughput is measured by sending transferBytes to the destination when it is greater than 0
+func MeasurementEnv(transferBytes int) []corev1.EnvVar {
+	env := []corev1.EnvVar{{Name: envMeasure, Value: "true"}}
+
+	if transferBytes > 0 {
+		env = append(env, corev1.EnvVar{Name: envTransferBytes, Value: strconv.Itoa(transferBytes)})
+	}
+
+	return env
+}
@@ -0,0 +1,18 @@
+package kubeops
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMeasurementEnv(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal([]corev1.EnvVar{{Name: "MEASURE", Value: "true"}}, MeasurementEnv(0))
+	r.Equal([]corev1.EnvVar{
+		{Name: "MEASURE", Value: "true"},
+		{Name: "TRANSFER_BYTES", Value: "1048576"},
+	}, MeasurementEnv(1<<20))
+}
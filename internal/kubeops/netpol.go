@@ -0,0 +1,207 @@
+package kubeops
+
+import (
+	"context"
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// WatchNetworkPolicies - calls onChange with the NetworkPolicies that are created, updated or deleted
+// until ctx is cancelled, an update is reported with both the old and the new version of the policy
+// so that the tests selected by either of them are affected. The existing policies are not reported.
+func (svc *Service) WatchNetworkPolicies(
+	ctx context.Context, // context passed to the function
+	namespace string, // namespace whose policies are watched, all the namespaces when empty
+	onChange func(policies ...*networkingv1.NetworkPolicy), // called for every change
+) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(svc.Client, 0, informers.WithNamespace(namespace))
+	informer := factory.Networking().V1().NetworkPolicies().Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if policy, ok := obj.(*networkingv1.NetworkPolicy); ok && !isInInitialList {
+				onChange(policy)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPolicy, okOld := oldObj.(*networkingv1.NetworkPolicy)
+			newPolicy, okNew := newObj.(*networkingv1.NetworkPolicy)
+			// the metadata only updates do not change the generation
+			if !okOld || !okNew || oldPolicy.Generation == newPolicy.Generation {
+				return
+			}
+			onChange(oldPolicy, newPolicy)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if policy, ok := obj.(*networkingv1.NetworkPolicy); ok {
+				onChange(policy)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch the NetworkPolicies: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		// the context was cancelled before the cache was synced
+		return nil
+	}
+
+	svc.Log.Info("Watching the NetworkPolicies", "namespace", namespace)
+	<-ctx.Done()
+
+	return nil
+}
+
+// AffectedTests - returns the tests whose traffic is governed by at least one of the policies, i.e.
+// the tests whose source Pods are selected by an egress policy or whose destination Pods are selected
+// by an ingress policy, and the other way around for the tests that are also run in reverse. The Pods
+// are matched against the labels of the template of the resources, when they cannot be read the tests
+// are affected by all the policies of their namespaces. The nodes are never affected, as the
+// NetworkPolicies do not apply to the host network.
+func (svc *Service) AffectedTests(
+	ctx context.Context, // context passed to the function
+	tests data.Tests, // tests to filter
+	policies ...*networkingv1.NetworkPolicy, // policies that changed
+) data.Tests {
+	podLabels := make(map[string]labels.Set)
+
+	// affects returns true when one of the policies of the given type selects the Pods of res
+	affects := func(res *data.K8sResource, policyType networkingv1.PolicyType) bool {
+		if res == nil || res.Kind == data.KindNode {
+			return false
+		}
+
+		key := string(res.Kind) + "/" + res.Namespace + "/" + res.Name
+		set, ok := podLabels[key]
+		if !ok {
+			var err error
+			set, err = svc.podTemplateLabels(ctx, res)
+			if err != nil {
+				svc.Log.Debug("Unable to read the labels of the Pods", "kind", res.Kind, "name", res.Name,
+					"namespace", res.Namespace, "error", err)
+			}
+			podLabels[key] = set
+		}
+
+		for _, policy := range policies {
+			if policy.Namespace == res.Namespace && hasPolicyType(policy, policyType) &&
+				selectsPods(policy, set) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var affected data.Tests
+	for _, te := range tests {
+		if te.Skipped() {
+			continue
+		}
+
+		var src, dst *data.K8sResource
+		if te.Src != nil {
+			src = te.Src.K8sResource
+		}
+		if te.Dst != nil {
+			dst = te.Dst.K8sResource
+		}
+
+		affectsForward := affects(src, networkingv1.PolicyTypeEgress) || affects(dst, networkingv1.PolicyTypeIngress)
+		// the reverse leg of the test sends its traffic from the destination to the source
+		affectsReverse := te.Reverse != nil &&
+			(affects(dst, networkingv1.PolicyTypeEgress) || affects(src, networkingv1.PolicyTypeIngress))
+
+		if affectsForward || affectsReverse {
+			affected = append(affected, te)
+		}
+	}
+
+	return affected
+}
+
+// hasPolicyType - returns true when the policy restricts the traffic in the direction of policyType,
+// following the defaults of the API when spec.policyTypes is not set
+func hasPolicyType(policy *networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return policyType == networkingv1.PolicyTypeIngress || len(policy.Spec.Egress) > 0
+	}
+
+	for _, pt := range policy.Spec.PolicyTypes {
+		if pt == policyType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectsPods - returns true when the pod selector of the policy matches podLabels, a nil podLabels
+// means that the labels are unknown and is matched by all the policies
+func selectsPods(policy *networkingv1.NetworkPolicy, podLabels labels.Set) bool {
+	if podLabels == nil {
+		return true
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if err != nil {
+		return true
+	}
+
+	return selector.Matches(podLabels)
+}
+
+// podTemplateLabels - returns the labels of the Pods of a resource
+func (svc *Service) podTemplateLabels(ctx context.Context, res *data.K8sResource) (labels.Set, error) {
+	var podLabels map[string]string
+
+	switch res.Kind {
+	case data.KindDeployment:
+		deploy, err := svc.Client.AppsV1().Deployments(res.Namespace).Get(ctx, res.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podLabels = deploy.Spec.Template.Labels
+	case data.KindStatefulSet:
+		ss, err := svc.Client.AppsV1().StatefulSets(res.Namespace).Get(ctx, res.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podLabels = ss.Spec.Template.Labels
+	case data.KindDaemonSet:
+		ds, err := svc.Client.AppsV1().DaemonSets(res.Namespace).Get(ctx, res.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podLabels = ds.Spec.Template.Labels
+	case data.KindPod:
+		pod, err := svc.Client.CoreV1().Pods(res.Namespace).Get(ctx, res.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podLabels = pod.Labels
+	default:
+		return nil, fmt.Errorf("%s is not supported K8sResource", res.Kind)
+	}
+
+	// a nil set means that the labels are unknown
+	if podLabels == nil {
+		return labels.Set{}, nil
+	}
+
+	return labels.Set(podLabels), nil
+}
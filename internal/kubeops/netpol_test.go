@@ -0,0 +1,184 @@
+package kubeops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// newPolicy - returns a NetworkPolicy selecting the Pods labelled app=app
+func newPolicy(namespace, app string, policyTypes ...networkingv1.PolicyType) *networkingv1.NetworkPolicy {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: namespace, Generation: 1},
+		Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: policyTypes},
+	}
+
+	if app != "" {
+		policy.Spec.PodSelector.MatchLabels = map[string]string{"app": app}
+	}
+
+	return policy
+}
+
+func TestAffectedTests(t *testing.T) {
+	ctx := context.Background()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "client", Namespace: "client", Labels: map[string]string{"app": "client"},
+	}}
+	svc := New(fake.NewSimpleClientset(getDeploymentObject("web", "web", 1), pod), hclog.NewNullLogger())
+
+	tests := data.Tests{
+		{
+			Name: "client-to-web",
+			Src:  &data.Src{K8sResource: &data.K8sResource{Kind: data.KindPod, Name: "client", Namespace: "client"}},
+			Dst:  &data.Dst{K8sResource: &data.K8sResource{Kind: data.KindDeployment, Name: "web", Namespace: "web"}},
+		},
+		{
+			Name: "web-to-host",
+			Src:  &data.Src{K8sResource: &data.K8sResource{Kind: data.KindDeployment, Name: "web", Namespace: "web"}},
+			Dst:  &data.Dst{Host: &data.Host{Name: "control-plane.io"}},
+		},
+		{
+			Name: "unknown-to-host",
+			Src:  &data.Src{K8sResource: &data.K8sResource{Kind: data.KindDeployment, Name: "missing", Namespace: "web"}},
+			Dst:  &data.Dst{Host: &data.Host{Name: "control-plane.io"}},
+		},
+		{
+			Name: "skipped",
+			Skip: "not ready",
+			Src:  &data.Src{K8sResource: &data.K8sResource{Kind: data.KindDeployment, Name: "web", Namespace: "web"}},
+			Dst:  &data.Dst{Host: &data.Host{Name: "control-plane.io"}},
+		},
+		{
+			Name:    "client-to-web-and-back",
+			Src:     &data.Src{K8sResource: &data.K8sResource{Kind: data.KindPod, Name: "client", Namespace: "client"}},
+			Dst:     &data.Dst{K8sResource: &data.K8sResource{Kind: data.KindDeployment, Name: "web", Namespace: "web"}},
+			Reverse: &data.Reverse{},
+		},
+	}
+
+	egressOnly := newPolicy("web", "web", networkingv1.PolicyTypeEgress)
+
+	defaultEgress := newPolicy("client", "client")
+	defaultEgress.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+
+	testCases := map[string]struct {
+		policies []*networkingv1.NetworkPolicy
+		want     []string
+	}{
+		"ingress policy selecting the destination": {
+			policies: []*networkingv1.NetworkPolicy{newPolicy("web", "web")},
+			want:     []string{"client-to-web", "client-to-web-and-back"},
+		},
+		"egress policy selecting the source": {
+			policies: []*networkingv1.NetworkPolicy{egressOnly},
+			// the destination of a reversed test is its source too
+			want: []string{"web-to-host", "unknown-to-host", "client-to-web-and-back"},
+		},
+		"egress rules without policy types": {
+			policies: []*networkingv1.NetworkPolicy{defaultEgress},
+			want:     []string{"client-to-web", "client-to-web-and-back"},
+		},
+		"ingress policy of the source namespace": {
+			policies: []*networkingv1.NetworkPolicy{newPolicy("client", "client")},
+			// only the source of a reversed test receives traffic
+			want: []string{"client-to-web-and-back"},
+		},
+		"policy selecting other Pods": {
+			policies: []*networkingv1.NetworkPolicy{
+				newPolicy("web", "db", networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress),
+			},
+			// the labels of the missing deployment are unknown
+			want: []string{"unknown-to-host"},
+		},
+		"policy selecting all the Pods of a namespace": {
+			policies: []*networkingv1.NetworkPolicy{
+				newPolicy("web", "", networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress),
+			},
+			want: []string{"client-to-web", "web-to-host", "unknown-to-host", "client-to-web-and-back"},
+		},
+		"policy of another namespace": {
+			policies: []*networkingv1.NetworkPolicy{newPolicy("other", "")},
+			want:     nil,
+		},
+		"old and new version of an updated policy": {
+			policies: []*networkingv1.NetworkPolicy{newPolicy("web", "db"), newPolicy("web", "web")},
+			want:     []string{"client-to-web", "client-to-web-and-back"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, te := range svc.AffectedTests(ctx, tests, tc.policies...) {
+				got = append(got, te.Name)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestWatchNetworkPolicies(t *testing.T) {
+	r := require.New(t)
+
+	existing := newPolicy("web", "web")
+	existing.Name = "existing"
+	client := fake.NewSimpleClientset(existing)
+	svc := New(client, hclog.NewNullLogger())
+
+	changes := make(chan []*networkingv1.NetworkPolicy, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- svc.WatchNetworkPolicies(ctx, "", func(policies ...*networkingv1.NetworkPolicy) {
+			changes <- policies
+		})
+	}()
+
+	// the fake clientset drops the events sent before the watch is established, so the policy is
+	// updated until the change is received
+	policies := client.NetworkingV1().NetworkPolicies("web")
+	var got []*networkingv1.NetworkPolicy
+	r.Eventually(func() bool {
+		policy, err := policies.Get(ctx, "existing", metav1.GetOptions{})
+		r.NoError(err)
+		policy.Generation++
+		_, err = policies.Update(ctx, policy, metav1.UpdateOptions{})
+		r.NoError(err)
+
+		select {
+		case got = <-changes:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	// the existing policy is not reported as created
+	r.Len(got, 2)
+	r.Equal("existing", got[0].Name)
+	r.Less(got[0].Generation, got[1].Generation)
+
+	r.NoError(policies.Delete(ctx, "existing", metav1.DeleteOptions{}))
+	r.Eventually(func() bool {
+		select {
+		case got = <-changes:
+			return len(got) == 1 && got[0].Name == "existing"
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	r.NoError(<-done)
+}
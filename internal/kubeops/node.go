@@ -0,0 +1,162 @@
+package kubeops
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// probeOfNodeAnnotation - annotation of a node probe Pod holding the name of the node it runs on
+const probeOfNodeAnnotation = "netassert.controlplane.io/probe-of-node"
+
+// GetNode - returns the node name, or a random Ready node matching selector when name is empty
+func (svc *Service) GetNode(
+	ctx context.Context, // the context
+	name string, // name of the node
+	selector map[string]string, // labels of the nodes, used when name is empty
+) (*corev1.Node, error) {
+	if name != "" {
+		node, err := svc.Client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to find node %s: %w", name, err)
+		}
+
+		if !isNodeReady(node) {
+			return nil, fmt.Errorf("node %s is not ready", name)
+		}
+
+		return node, nil
+	}
+
+	labelSelector := labels.SelectorFromSet(selector).String()
+
+	nodeList, err := svc.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the nodes matching %q: %w", labelSelector, err)
+	}
+
+	var nodes []*corev1.Node
+	for i := range nodeList.Items {
+		if isNodeReady(&nodeList.Items[i]) {
+			nodes = append(nodes, &nodeList.Items[i])
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("unable to find a ready node matching %q", labelSelector)
+	}
+
+	return nodes[rand.Intn(len(nodes))], nil
+}
+
+// isNodeReady - returns true when the Ready condition of the node is true
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// NodeInternalIP - returns the first InternalIP address of the node in the IP family, the first one of
+// any family when family is empty
+func NodeInternalIP(node *corev1.Node, family data.IPFamily) (string, error) {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP && addr.Address != "" && inIPFamily(addr.Address, family) {
+			return addr.Address, nil
+		}
+	}
+
+	if family != "" {
+		return "", fmt.Errorf("node %s does not have an %s InternalIP address", node.Name, family)
+	}
+
+	return "", fmt.Errorf("node %s does not have an InternalIP address", node.Name)
+}
+
+// LaunchNodeProbe - runs the container in a hostNetwork probe Pod pinned to the node, so that its
+// connections originate from the node, and returns the probe Pod once it has started
+func (svc *Service) LaunchNodeProbe(
+	ctx context.Context, // the context
+	node *corev1.Node, // the node the probe Pod runs on
+	namespace string, // namespace of the probe Pod
+	imagePullSecrets []string, // image pull secrets of the probe Pod
+	ec *corev1.EphemeralContainer, // the container run in the probe Pod
+	settings ContainerSettings, // optional settings of the container
+) (*corev1.Pod, string, error) {
+	probe := newNodeProbePod(node, namespace, imagePullSecrets, ec, settings)
+
+	svc.Log.Info("Creating node probe Pod", "Pod", probe.Name, "Namespace", probe.Namespace, "Node", node.Name)
+
+	started, err := svc.startProbePod(ctx, probe, defaultProbePodStartTimeout)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return started, ec.Name, nil
+}
+
+// newNodeProbePod - returns a hostNetwork Pod running ec on node
+func newNodeProbePod(
+	node *corev1.Node, // the node the probe Pod runs on
+	namespace string, // namespace of the probe Pod
+	imagePullSecrets []string, // image pull secrets of the probe Pod
+	ec *corev1.EphemeralContainer, // the container run in the probe Pod
+	settings ContainerSettings, // optional settings of the container
+) *corev1.Pod {
+	automount := false
+
+	secrets := make([]corev1.LocalObjectReference, 0, len(imagePullSecrets))
+	for _, secret := range imagePullSecrets {
+		secrets = append(secrets, corev1.LocalObjectReference{Name: secret})
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ec.Name,
+			Namespace:   namespace,
+			Annotations: map[string]string{probeOfNodeAnnotation: node.Name},
+			// the probe Pod is garbage collected if the node is deleted first
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(node, corev1.SchemeGroupVersion.WithKind("Node")),
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            ec.Name,
+				Image:           ec.Image,
+				Env:             ec.Env,
+				Resources:       settings.Resources,
+				ImagePullPolicy: ec.ImagePullPolicy,
+				SecurityContext: ec.SecurityContext,
+			}},
+			RestartPolicy:                corev1.RestartPolicyNever,
+			AutomountServiceAccountToken: &automount,
+			// the scheduler is bypassed, so that the probe Pod runs even on the cordoned nodes
+			NodeName:         node.Name,
+			HostNetwork:      true,
+			DNSPolicy:        corev1.DNSClusterFirstWithHostNet,
+			Tolerations:      []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			ImagePullSecrets: secrets,
+		},
+	}
+}
+
+// GetProbeContainerLogs - returns the tail of the logs of the container of a probe Pod, at most maxBytes long
+func (svc *Service) GetProbeContainerLogs(
+	ctx context.Context, // the context
+	containerName string, // name of the container
+	maxBytes int64, // maximum number of bytes of the logs to return
+	podName string, // name of the probe Pod
+	podNamespace string, // namespace of the probe Pod
+) (string, error) {
+	return svc.GetEphemeralContainerLogs(ctx, containerName, maxBytes, podName, podNamespace)
+}
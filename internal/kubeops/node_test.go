@@ -0,0 +1,131 @@
+package kubeops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// newTestNode - returns a node with the given labels, Ready condition and InternalIP address
+func newTestNode(name string, ready corev1.ConditionStatus, labels map[string]string, ip string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name), Labels: labels},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: name},
+				{Type: corev1.NodeInternalIP, Address: ip},
+			},
+		},
+	}
+}
+
+func TestGetNode(t *testing.T) {
+	ctx := context.Background()
+	worker := map[string]string{"node-role.kubernetes.io/worker": ""}
+
+	svc := New(fake.NewSimpleClientset(
+		newTestNode("node-1", corev1.ConditionTrue, worker, "192.168.0.1"),
+		newTestNode("node-2", corev1.ConditionFalse, worker, "192.168.0.2"),
+		newTestNode("control-plane", corev1.ConditionTrue, nil, "192.168.0.3"),
+	), hclog.NewNullLogger())
+
+	t.Run("by name", func(t *testing.T) {
+		r := require.New(t)
+
+		node, err := svc.GetNode(ctx, "control-plane", nil)
+		r.NoError(err)
+		r.Equal("control-plane", node.Name)
+
+		_, err = svc.GetNode(ctx, "node-2", nil)
+		r.ErrorContains(err, "node node-2 is not ready")
+
+		_, err = svc.GetNode(ctx, "node-3", nil)
+		r.ErrorContains(err, "unable to find node node-3")
+	})
+
+	t.Run("by selector", func(t *testing.T) {
+		r := require.New(t)
+
+		// only node-1 is both a ready and a worker node
+		for range 10 {
+			node, err := svc.GetNode(ctx, "", worker)
+			r.NoError(err)
+			r.Equal("node-1", node.Name)
+		}
+
+		_, err := svc.GetNode(ctx, "", map[string]string{"pool": "gpu"})
+		r.ErrorContains(err, `unable to find a ready node matching "pool=gpu"`)
+	})
+}
+
+func TestNodeInternalIP(t *testing.T) {
+	r := require.New(t)
+
+	node := newTestNode("node-1", corev1.ConditionTrue, nil, "192.168.0.1")
+	node.Status.Addresses = append(node.Status.Addresses,
+		corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "fd00::1"})
+
+	ip, err := NodeInternalIP(node, "")
+	r.NoError(err)
+	r.Equal("192.168.0.1", ip)
+
+	ip, err = NodeInternalIP(node, data.IPFamilyIPv6)
+	r.NoError(err)
+	r.Equal("fd00::1", ip)
+
+	_, err = NodeInternalIP(newTestNode("node-2", corev1.ConditionTrue, nil, "192.168.0.2"), data.IPFamilyIPv6)
+	r.ErrorContains(err, "node node-2 does not have an ipv6 InternalIP address")
+
+	_, err = NodeInternalIP(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, "")
+	r.ErrorContains(err, "node node-1 does not have an InternalIP address")
+}
+
+func TestService_LaunchNodeProbe(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	pe, watcher := newTestProbePodExecutor()
+	node := newTestNode("node-1", corev1.ConditionTrue, nil, "192.168.0.1")
+
+	ec, err := pe.Service.BuildEphemeralScannerContainer("netassertv2-client-abc", "scanner:latest",
+		"169.254.169.254", "80", "tcp", "msg", 3, ContainerSettings{})
+	r.NoError(err)
+
+	go func() {
+		watcher.Modify(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: "netassert"},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "192.168.0.1"}})
+	}()
+
+	settings := ContainerSettings{Resources: corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+	}}
+
+	probe, name, err := pe.Service.LaunchNodeProbe(ctx, node, "netassert", []string{"registry"}, ec, settings)
+	r.NoError(err)
+	r.Equal("netassertv2-client-abc", name)
+	r.Equal("192.168.0.1", probe.Status.PodIP)
+
+	created, err := pe.Client.CoreV1().Pods("netassert").Get(ctx, name, metav1.GetOptions{})
+	r.NoError(err)
+	r.Equal("node-1", created.Annotations[probeOfNodeAnnotation])
+	r.Equal("node-1", created.Spec.NodeName)
+	r.True(created.Spec.HostNetwork)
+	r.Equal(corev1.DNSClusterFirstWithHostNet, created.Spec.DNSPolicy)
+	r.Equal([]corev1.LocalObjectReference{{Name: "registry"}}, created.Spec.ImagePullSecrets)
+	r.Equal(settings.Resources, created.Spec.Containers[0].Resources)
+
+	owner := metav1.GetControllerOf(created)
+	r.NotNil(owner)
+	r.Equal("Node", owner.Kind)
+	r.Equal(node.UID, owner.UID)
+}
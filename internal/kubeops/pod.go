@@ -13,6 +13,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
 )
 
 const (
@@ -55,6 +57,36 @@ func (svc *Service) GetPod(ctx context.Context, name, namespace string) (*corev1
 	return pod, nil
 }
 
+// PodIP - returns the address of the Pod in the IP family, its primary address when family is empty
+func PodIP(pod *corev1.Pod, family data.IPFamily) (string, error) {
+	if family == "" {
+		return pod.Status.PodIP, nil
+	}
+
+	for _, podIP := range pod.Status.PodIPs {
+		if inIPFamily(podIP.IP, family) {
+			return podIP.IP, nil
+		}
+	}
+
+	// PodIPs is not set by the older API servers
+	if len(pod.Status.PodIPs) == 0 && inIPFamily(pod.Status.PodIP, family) {
+		return pod.Status.PodIP, nil
+	}
+
+	return "", fmt.Errorf("pod %s in namespace %s does not have an %s address", pod.Name, pod.Namespace, family)
+}
+
+// inIPFamily - returns true when ip is a literal address of the IP family, or family is empty
+func inIPFamily(ip string, family data.IPFamily) bool {
+	if family == "" {
+		return true
+	}
+
+	ipFamily, ok := data.IPFamilyOf(ip)
+	return ok && ipFamily == family
+}
+
 // getPodFromPodList - returns a random pod from PodList object
 func getRandomPodFromPodList(ownerObj metav1.Object, podList *corev1.PodList) (*corev1.Pod, error) {
 	if ownerObj == nil {
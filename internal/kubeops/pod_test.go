@@ -9,6 +9,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
 )
 
 func TestGetPod(t *testing.T) {
@@ -109,3 +111,32 @@ func TestGetPod(t *testing.T) {
 		})
 	}
 }
+
+func TestPodIP(t *testing.T) {
+	r := require.New(t)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "web"},
+		Status: corev1.PodStatus{
+			PodIP:  "10.0.0.1",
+			PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+		},
+	}
+
+	ip, err := PodIP(pod, "")
+	r.NoError(err)
+	r.Equal("10.0.0.1", ip)
+
+	ip, err = PodIP(pod, data.IPFamilyIPv6)
+	r.NoError(err)
+	r.Equal("fd00::1", ip)
+
+	// the primary address is used when PodIPs is not set
+	pod.Status.PodIPs = nil
+	ip, err = PodIP(pod, data.IPFamilyIPv4)
+	r.NoError(err)
+	r.Equal("10.0.0.1", ip)
+
+	_, err = PodIP(pod, data.IPFamilyIPv6)
+	r.ErrorContains(err, "pod web-1 in namespace web does not have an ipv6 address")
+}
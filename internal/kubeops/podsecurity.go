@@ -0,0 +1,121 @@
+package kubeops
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecurityLevel - represents a Pod Security Standards level
+type PodSecurityLevel string
+
+const (
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	PodSecurityBaseline   PodSecurityLevel = "baseline"
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+const (
+	// podSecurityEnforceLabel - namespace label used by the PodSecurity admission controller
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+)
+
+// baselineCapabilities - capabilities that may be added under the baseline policy
+var baselineCapabilities = []corev1.Capability{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+	"NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// PodSecurityViolations - returns the list of Pod Security Standards checks that a container
+// with the security context sc would fail under the given level.
+// Only container level fields are evaluated as the pod level security context is not
+// known in advance
+func PodSecurityViolations(level PodSecurityLevel, sc *corev1.SecurityContext) []string {
+	if level == "" || level == PodSecurityPrivileged {
+		return nil
+	}
+
+	if sc == nil {
+		sc = &corev1.SecurityContext{}
+	}
+
+	var violations []string
+
+	// baseline checks, these also apply to the restricted level
+	if sc.Privileged != nil && *sc.Privileged {
+		violations = append(violations, "privileged containers are not allowed")
+	}
+
+	if sc.Capabilities != nil {
+		for _, c := range sc.Capabilities.Add {
+			if level == PodSecurityRestricted && c == "NET_BIND_SERVICE" {
+				continue
+			}
+
+			if level == PodSecurityBaseline && slices.Contains(baselineCapabilities, c) {
+				continue
+			}
+
+			violations = append(violations, fmt.Sprintf("capability %s is not allowed", c))
+		}
+	}
+
+	if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		violations = append(violations, "seccompProfile Unconfined is not allowed")
+	}
+
+	if level == PodSecurityBaseline {
+		return violations
+	}
+
+	// restricted only checks
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		violations = append(violations, "allowPrivilegeEscalation must be set to false")
+	}
+
+	if sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot {
+		violations = append(violations, "runAsNonRoot must be set to true")
+	}
+
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		violations = append(violations, "runAsUser must not be 0")
+	}
+
+	if sc.SeccompProfile == nil {
+		violations = append(violations, "seccompProfile must be set to RuntimeDefault or Localhost")
+	}
+
+	if sc.Capabilities == nil || !slices.Contains(sc.Capabilities.Drop, "ALL") {
+		violations = append(violations, "capabilities must drop ALL")
+	}
+
+	return violations
+}
+
+// PodSecurityLevelOf - returns the most restrictive Pod Security Standards level that a
+// container with the security context sc complies with
+func PodSecurityLevelOf(sc *corev1.SecurityContext) PodSecurityLevel {
+	switch {
+	case len(PodSecurityViolations(PodSecurityRestricted, sc)) == 0:
+		return PodSecurityRestricted
+	case len(PodSecurityViolations(PodSecurityBaseline, sc)) == 0:
+		return PodSecurityBaseline
+	default:
+		return PodSecurityPrivileged
+	}
+}
+
+// namespacePodSecurityLevel - returns the enforced Pod Security Standards level of a namespace
+func namespacePodSecurityLevel(ns *corev1.Namespace) PodSecurityLevel {
+	if ns == nil {
+		return ""
+	}
+
+	level, ok := ns.Labels[podSecurityEnforceLabel]
+	if !ok {
+		return PodSecurityPrivileged
+	}
+
+	return PodSecurityLevel(level)
+}
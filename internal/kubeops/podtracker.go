@@ -0,0 +1,254 @@
+package kubeops
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// defaultPodTrackerIdleTimeout - time a tracker keeps running once no Pod is waited for, so that the tests
+// run one after the other in a namespace share its cache
+const defaultPodTrackerIdleTimeout = 30 * time.Second
+
+// podEvent - update of a Pod tracked by a podTracker, the Pod is the last known version when it was deleted
+type podEvent struct {
+	pod     *corev1.Pod
+	deleted bool
+}
+
+// podTracker - shared informer of the Pods of a namespace, which notifies the callers waiting for the status
+// of a Pod of its updates. The informer resumes its watch from the last resourceVersion it has seen when
+// the watch is closed by the API server, and lists the Pods again when that version has expired. It is
+// stopped once no Pod has been waited for during the idle timeout, as it caches all the Pods of the namespace
+type podTracker struct {
+	namespace string
+	informer  cache.SharedIndexInformer
+	stop      chan struct{}
+	users     int         // callers of watchPod using the tracker, guarded by the podTrackersMu of the Service
+	idle      *time.Timer // stops the tracker once it is unused, guarded by the podTrackersMu of the Service
+
+	mu      sync.Mutex
+	waiters map[string][]chan podEvent // channels of the callers waiting for a Pod, by name of the Pod
+}
+
+// watchPod - waits for the updates of a Pod, starting from its cached version, until done returns true, the
+// context is cancelled or timeOut has elapsed. The Pod is tracked by the shared podTracker of its namespace,
+// so the updates are not lost when the API server closes the watch
+func (svc *Service) watchPod(
+	ctx context.Context, // the context
+	name string, // name of the Pod
+	namespace string, // namespace of the Pod
+	timeOut time.Duration, // maximum duration to watch the Pod
+	done func(*corev1.Pod) bool, // returns true when the watch can stop
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+
+	tracker, err := svc.podTracker(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to watch Pod %s in namespace %s: %w", name, namespace, err)
+	}
+	defer svc.releasePodTracker(tracker)
+
+	// the Pod is subscribed to before reading the cache, so that no update is missed in between
+	events := tracker.subscribe(name)
+	defer tracker.unsubscribe(name, events)
+
+	if pod, ok := tracker.get(name); ok && done(pod) {
+		return nil
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if event.deleted {
+				return fmt.Errorf("pod %s in namespace %s was deleted", name, namespace)
+			}
+
+			if done(event.pod) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// podTracker - returns the tracker of the Pods of namespace, which is started by the first caller and then
+// shared by all the tests, and waits for its cache to be synced. The tracker must be released with
+// releasePodTracker once the caller no longer uses it
+func (svc *Service) podTracker(ctx context.Context, namespace string) (*podTracker, error) {
+	svc.podTrackersMu.Lock()
+	tracker, ok := svc.podTrackers[namespace]
+	if ok && tracker.idle != nil {
+		tracker.idle.Stop()
+		tracker.idle = nil
+	}
+	if !ok {
+		var err error
+		if tracker, err = svc.startPodTracker(namespace); err != nil {
+			svc.podTrackersMu.Unlock()
+			return nil, err
+		}
+
+		if svc.podTrackers == nil {
+			svc.podTrackers = make(map[string]*podTracker)
+		}
+		svc.podTrackers[namespace] = tracker
+	}
+	tracker.users++
+	svc.podTrackersMu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), tracker.informer.HasSynced) {
+		svc.releasePodTracker(tracker)
+		return nil, fmt.Errorf("unable to sync the cache of the Pods in namespace %s: %w", namespace, ctx.Err())
+	}
+
+	return tracker, nil
+}
+
+// releasePodTracker - releases a tracker returned by podTracker, the tracker is stopped once it has not
+// been used during the idle timeout
+func (svc *Service) releasePodTracker(tracker *podTracker) {
+	svc.podTrackersMu.Lock()
+	defer svc.podTrackersMu.Unlock()
+
+	tracker.users--
+	if tracker.users > 0 {
+		return
+	}
+
+	idleFor := svc.podTrackerIdleFor
+	if idleFor == 0 {
+		idleFor = defaultPodTrackerIdleTimeout
+	}
+
+	tracker.idle = time.AfterFunc(idleFor, func() {
+		svc.podTrackersMu.Lock()
+		defer svc.podTrackersMu.Unlock()
+
+		// the tracker may have been used again, or stopped by StopPodTrackers, in the meantime
+		if tracker.users > 0 || svc.podTrackers[tracker.namespace] != tracker {
+			return
+		}
+
+		close(tracker.stop)
+		delete(svc.podTrackers, tracker.namespace)
+		svc.Log.Debug("Stopped tracking the Pods", "namespace", tracker.namespace)
+	})
+}
+
+// startPodTracker - starts the informer of the Pods of namespace, which runs until it is idle or until
+// StopPodTrackers is called
+func (svc *Service) startPodTracker(namespace string) (*podTracker, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(svc.Client, 0, informers.WithNamespace(namespace))
+	tracker := &podTracker{
+		namespace: namespace,
+		informer:  factory.Core().V1().Pods().Informer(),
+		stop:      make(chan struct{}),
+		waiters:   make(map[string][]chan podEvent),
+	}
+
+	_, err := tracker.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				tracker.notify(podEvent{pod: pod})
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				tracker.notify(podEvent{pod: pod})
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				tracker.notify(podEvent{pod: pod, deleted: true})
+			}
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to track the Pods in namespace %s: %w", namespace, err)
+	}
+
+	factory.Start(tracker.stop)
+	svc.Log.Debug("Started tracking the Pods", "namespace", namespace)
+
+	return tracker, nil
+}
+
+// StopPodTrackers - stops the informers tracking the status of the Pods, they are started again when needed
+func (svc *Service) StopPodTrackers() {
+	svc.podTrackersMu.Lock()
+	defer svc.podTrackersMu.Unlock()
+
+	for _, tracker := range svc.podTrackers {
+		if tracker.idle != nil {
+			tracker.idle.Stop()
+		}
+		close(tracker.stop)
+	}
+	svc.podTrackers = nil
+}
+
+// subscribe - returns the channel receiving the updates of the Pod name, only the last update is kept when
+// the caller is late to receive them
+func (pt *podTracker) subscribe(name string) chan podEvent {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	events := make(chan podEvent, 1)
+	pt.waiters[name] = append(pt.waiters[name], events)
+
+	return events
+}
+
+// unsubscribe - stops sending the updates of the Pod name to events
+func (pt *podTracker) unsubscribe(name string, events chan podEvent) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	for i, waiter := range pt.waiters[name] {
+		if waiter == events {
+			pt.waiters[name] = append(pt.waiters[name][:i], pt.waiters[name][i+1:]...)
+			break
+		}
+	}
+
+	if len(pt.waiters[name]) == 0 {
+		delete(pt.waiters, name)
+	}
+}
+
+// notify - sends an update of a Pod to the callers waiting for it, replacing the update they have not
+// received yet
+func (pt *podTracker) notify(event podEvent) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	for _, events := range pt.waiters[event.pod.Name] {
+		select {
+		case <-events:
+		default:
+		}
+		events <- event
+	}
+}
+
+// get - returns the version of the Pod name in the cache of the tracker
+func (pt *podTracker) get(name string) (*corev1.Pod, bool) {
+	obj, ok, err := pt.informer.GetStore().GetByKey(pt.namespace + "/" + name)
+	if err != nil || !ok {
+		return nil, false
+	}
+
+	pod, ok := obj.(*corev1.Pod)
+	return pod, ok
+}
@@ -0,0 +1,203 @@
+package kubeops
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// watchRecorder - opens a new fake watch of the Pods for each watch request, and records the resource
+// version the watches are started from
+type watchRecorder struct {
+	mu               sync.Mutex
+	resourceVersions []string
+	watchers         chan *watch.FakeWatcher
+}
+
+// newTestPodTrackerService - returns a Service whose Pod watches are opened by the returned watchRecorder
+func newTestPodTrackerService(objects ...runtime.Object) (*Service, *watchRecorder) {
+	client := fake.NewSimpleClientset(objects...)
+	recorder := &watchRecorder{watchers: make(chan *watch.FakeWatcher, 10)}
+
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFake()
+
+		recorder.mu.Lock()
+		recorder.resourceVersions = append(recorder.resourceVersions,
+			action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion)
+		recorder.mu.Unlock()
+
+		recorder.watchers <- watcher
+		return true, watcher, nil
+	})
+
+	return New(client, hclog.NewNullLogger()), recorder
+}
+
+// watches - returns the resource versions of the watches opened so far
+func (wr *watchRecorder) watches() []string {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	return append([]string(nil), wr.resourceVersions...)
+}
+
+// waitForWaiters - waits until count Pods of namespace are waited for
+func waitForWaiters(t *testing.T, svc *Service, namespace string, count int) {
+	require.Eventually(t, func() bool {
+		tracker, err := svc.podTracker(context.Background(), namespace)
+		if err != nil {
+			return false
+		}
+		defer svc.releasePodTracker(tracker)
+
+		tracker.mu.Lock()
+		defer tracker.mu.Unlock()
+		return len(tracker.waiters) == count
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// scannerPod - returns the Pod web-1 whose ephemeral scanner container is in state
+func scannerPod(resourceVersion string, state corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "web", ResourceVersion: resourceVersion},
+		Status: corev1.PodStatus{
+			Phase:                      corev1.PodRunning,
+			EphemeralContainerStatuses: []corev1.ContainerStatus{{Name: "scanner", State: state}},
+		},
+	}
+}
+
+func TestService_watchPod(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}
+
+	t.Run("the watch is resumed from the last resource version when it is closed", func(t *testing.T) {
+		r := require.New(t)
+		svc, recorder := newTestPodTrackerService(scannerPod("", running))
+		defer svc.StopPodTrackers()
+
+		go func() {
+			first := <-recorder.watchers
+			first.Modify(scannerPod("5", running))
+			// the API server closes the watch before the container terminates
+			first.Stop()
+
+			second := <-recorder.watchers
+			second.Modify(scannerPod("6", terminated))
+		}()
+
+		exitCode, _, err := svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner", time.Minute,
+			"web-1", "web")
+		r.NoError(err)
+		r.Equal(1, exitCode)
+
+		watches := recorder.watches()
+		r.Len(watches, 2)
+		r.Equal("5", watches[1])
+	})
+
+	t.Run("the cached status of the Pod is used before any update", func(t *testing.T) {
+		r := require.New(t)
+		svc, _ := newTestPodTrackerService(scannerPod("", terminated))
+		defer svc.StopPodTrackers()
+
+		exitCode, _, err := svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner", time.Minute,
+			"web-1", "web")
+		r.NoError(err)
+		r.Equal(1, exitCode)
+	})
+
+	t.Run("a single watch is shared by the tests of a namespace", func(t *testing.T) {
+		r := require.New(t)
+		svc, recorder := newTestPodTrackerService()
+		defer svc.StopPodTrackers()
+
+		var wg sync.WaitGroup
+		exitCodes := make([]int, 2)
+		for i, name := range []string{"web-1", "web-2"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				exitCodes[i], _, _ = svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner",
+					time.Minute, name, "web")
+			}()
+		}
+
+		watcher := <-recorder.watchers
+		// the Pods are only sent once both tests wait for them
+		waitForWaiters(t, svc, "web", 2)
+
+		for i, name := range []string{"web-1", "web-2"} {
+			pod := scannerPod("", corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: int32(i)},
+			})
+			pod.Name = name
+			watcher.Add(pod)
+		}
+		wg.Wait()
+
+		r.Equal([]int{0, 1}, exitCodes)
+		r.Len(recorder.watches(), 1)
+	})
+
+	t.Run("the tracker is stopped once it is idle", func(t *testing.T) {
+		r := require.New(t)
+		svc, recorder := newTestPodTrackerService(scannerPod("", terminated))
+		svc.podTrackerIdleFor = 200 * time.Millisecond
+		defer svc.StopPodTrackers()
+
+		trackers := func() int {
+			svc.podTrackersMu.Lock()
+			defer svc.podTrackersMu.Unlock()
+			return len(svc.podTrackers)
+		}
+
+		for range 2 {
+			_, _, err := svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner", time.Minute,
+				"web-1", "web")
+			r.NoError(err)
+		}
+		// the tests run one after the other share the tracker until it is idle
+		r.Equal(1, trackers())
+		r.Eventually(func() bool { return len(recorder.watches()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		r.Eventually(func() bool { return trackers() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+		// the tracker is started again when needed
+		_, _, err := svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner", time.Minute,
+			"web-1", "web")
+		r.NoError(err)
+		r.Equal(1, trackers())
+		r.Eventually(func() bool { return len(recorder.watches()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("waiting for a deleted Pod fails", func(t *testing.T) {
+		r := require.New(t)
+		svc, recorder := newTestPodTrackerService(scannerPod("", running))
+		defer svc.StopPodTrackers()
+
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := svc.GetExitStatusOfEphemeralContainer(context.Background(), "scanner", time.Minute,
+				"web-1", "web")
+			errs <- err
+		}()
+
+		watcher := <-recorder.watchers
+		waitForWaiters(t, svc, "web", 1)
+		watcher.Delete(scannerPod("5", running))
+
+		r.ErrorContains(<-errs, "pod web-1 in namespace web was deleted")
+	})
+}
@@ -0,0 +1,337 @@
+package kubeops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// probeOfAnnotation - annotation of a probe Pod holding the name of the Pod it impersonates
+	probeOfAnnotation = "netassert.controlplane.io/probe-of"
+	// probeReadinessGate - readiness gate that is never satisfied, so that the probe Pods are never added
+	// to the endpoints of the Services selecting the Pod they impersonate
+	probeReadinessGate corev1.PodConditionType = "netassert.controlplane.io/probe"
+	// defaultProbePodStartTimeout - default maximum duration for a probe Pod to start
+	defaultProbePodStartTimeout = 2 * time.Minute
+)
+
+// ProbePodExecutor - runs the scanner and sniffer containers in short-lived probe Pods rather than as
+// ephemeral containers of the tested Pods, for the clusters that do not allow ephemeral containers.
+// A probe Pod copies the labels, namespace, service account and node of the Pod it impersonates, so
+// that it is selected by the same NetworkPolicies, and it is deleted once the test is over.
+type ProbePodExecutor struct {
+	*Service
+	StartTimeout time.Duration // maximum duration for a probe Pod to start
+}
+
+// NewProbePodExecutor - returns a ProbePodExecutor running the probe Pods with svc
+func NewProbePodExecutor(svc *Service) *ProbePodExecutor {
+	return &ProbePodExecutor{Service: svc, StartTimeout: defaultProbePodStartTimeout}
+}
+
+// SupportsContainerResources - returns true as the containers run in their own probe Pods
+func (pe *ProbePodExecutor) SupportsContainerResources() bool {
+	return true
+}
+
+// BuildEphemeralScannerContainer - builds the scanner container, the resources in settings are applied
+// as the container runs in its own Pod
+func (pe *ProbePodExecutor) BuildEphemeralScannerContainer(
+	name string, // name of the container
+	image string, // image location of the container
+	targetHost string, // host to connect to
+	targetPort string, // target Port to connect to
+	protocol string, // protocol to used for connection
+	message string, // message to pass to the remote target
+	attempts int, // Number of attempts
+	settings ContainerSettings, // optional settings of the container
+) (*corev1.EphemeralContainer, error) {
+	ec, err := pe.Service.BuildEphemeralScannerContainer(name, image, targetHost, targetPort, protocol,
+		message, attempts, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.Resources = settings.Resources
+	return ec, nil
+}
+
+// BuildEphemeralSnifferContainer - builds the sniffer container, the resources in settings are applied
+// as the container runs in its own Pod
+func (pe *ProbePodExecutor) BuildEphemeralSnifferContainer(
+	name string, // name of the container
+	image string, // image location of the container
+	search string, // search for this string in the captured packet
+	snapLen int, // snapLength to capture
+	protocol string, // protocol to capture
+	numberMatches int, // no. of matches that triggers an exit with status 0
+	intFace string, // the network interface to read the packets from
+	timeoutSec int, // timeout for the container
+	sourceCIDR string, // only the packets sent from this range of addresses match, all of them when empty
+	settings ContainerSettings, // optional settings of the container
+) (*corev1.EphemeralContainer, error) {
+	ec, err := pe.Service.BuildEphemeralSnifferContainer(name, image, search, snapLen, protocol,
+		numberMatches, intFace, timeoutSec, sourceCIDR, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.Resources = settings.Resources
+	return ec, nil
+}
+
+// LaunchEphemeralContainerInPod - runs the container in a probe Pod impersonating pod, and returns the
+// probe Pod once it has started
+func (pe *ProbePodExecutor) LaunchEphemeralContainerInPod(
+	ctx context.Context, // the context
+	pod *corev1.Pod, // the Pod impersonated by the probe Pod
+	ec *corev1.EphemeralContainer, // the container run in the probe Pod
+) (*corev1.Pod, string, error) {
+	probe := newProbePod(pod, ec)
+
+	pe.Log.Info("Creating probe Pod", "Pod", probe.Name, "Namespace", probe.Namespace, "ProbeOf", pod.Name)
+
+	started, err := pe.startProbePod(ctx, probe, pe.StartTimeout)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return started, ec.Name, nil
+}
+
+// newProbePod - returns a Pod running ec with the labels, namespace, service account and node placement of pod
+func newProbePod(pod *corev1.Pod, ec *corev1.EphemeralContainer) *corev1.Pod {
+	automount := false
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ec.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: map[string]string{probeOfAnnotation: pod.Name},
+			// a controller reference prevents the controllers selecting the labels of pod from adopting the
+			// probe Pod, and the probe Pod is garbage collected if pod is deleted first. The deletion of pod
+			// is not blocked by the probe Pod, which would require the update permission on pods/finalizers
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         corev1.SchemeGroupVersion.String(),
+				Kind:               "Pod",
+				Name:               pod.Name,
+				UID:                pod.UID,
+				Controller:         ptr.To(true),
+				BlockOwnerDeletion: ptr.To(false),
+			}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            ec.Name,
+				Image:           ec.Image,
+				Env:             ec.Env,
+				Resources:       ec.Resources,
+				ImagePullPolicy: ec.ImagePullPolicy,
+				SecurityContext: ec.SecurityContext,
+			}},
+			RestartPolicy:                corev1.RestartPolicyNever,
+			ServiceAccountName:           pod.Spec.ServiceAccountName,
+			AutomountServiceAccountToken: &automount,
+			NodeName:                     pod.Spec.NodeName,
+			Tolerations:                  pod.Spec.Tolerations,
+			HostNetwork:                  pod.Spec.HostNetwork,
+			DNSPolicy:                    pod.Spec.DNSPolicy,
+			DNSConfig:                    pod.Spec.DNSConfig,
+			SecurityContext:              pod.Spec.SecurityContext,
+			ImagePullSecrets:             pod.Spec.ImagePullSecrets,
+			ReadinessGates:               []corev1.PodReadinessGate{{ConditionType: probeReadinessGate}},
+		},
+	}
+}
+
+// startProbePod - creates a probe Pod and waits for it to start, the probe Pod is deleted when it does not start
+func (svc *Service) startProbePod(ctx context.Context, probe *corev1.Pod, timeOut time.Duration) (*corev1.Pod, error) {
+	if _, err := svc.Client.CoreV1().Pods(probe.Namespace).Create(ctx, probe, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("unable to create probe Pod %s in namespace %s: %w", probe.Name, probe.Namespace, err)
+	}
+	svc.trackProbePod(probe.Name, probe.Namespace, true)
+
+	started, err := svc.waitForProbePod(ctx, probe.Name, probe.Namespace, timeOut)
+	if err != nil {
+		// the caller does not get the probe Pod back, so it is deleted here
+		if delErr := svc.DeleteProbePod(ctx, probe.Name, probe.Namespace); delErr != nil {
+			svc.Log.Warn("Unable to delete probe Pod", "Pod", probe.Name, "Namespace", probe.Namespace, "error", delErr)
+		}
+		return nil, err
+	}
+
+	return started, nil
+}
+
+// waitForProbePod - waits for a probe Pod to get an IP address and to start its container
+func (svc *Service) waitForProbePod(
+	ctx context.Context, // the context
+	name string, // name of the probe Pod
+	namespace string, // namespace of the probe Pod
+	timeOut time.Duration, // maximum duration for the probe Pod to start
+) (*corev1.Pod, error) {
+	var (
+		started  *corev1.Pod
+		startErr error
+	)
+
+	err := svc.watchPod(ctx, name, namespace, timeOut, func(pod *corev1.Pod) bool {
+		// the containers of a probe Pod whose images cannot be pulled never start
+		for _, status := range pod.Status.ContainerStatuses {
+			if startErr = containerStartError(status.Name, status.State); startErr != nil {
+				return true
+			}
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			if pod.Status.PodIP == "" {
+				return false
+			}
+		case corev1.PodSucceeded, corev1.PodFailed:
+			// the container has already exited, its exit status is read by the caller
+		default:
+			return false
+		}
+
+		started = pod
+		return true
+	})
+	if err == nil {
+		err = startErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("probe Pod %s in namespace %s did not start: %w", name, namespace, err)
+	}
+
+	return started, nil
+}
+
+// GetExitStatusOfEphemeralContainer - returns the exit status and the report of the container of a
+// probe Pod
+func (pe *ProbePodExecutor) GetExitStatusOfEphemeralContainer(
+	ctx context.Context, // the context
+	containerName string, // name of the container
+	timeOut time.Duration, // maximum duration to poll for the container status
+	podName string, // name of the probe Pod
+	podNamespace string, // namespace of the probe Pod
+) (int, *ContainerReport, error) {
+	return pe.GetExitStatusOfProbeContainer(ctx, containerName, timeOut, podName, podNamespace)
+}
+
+// GetExitStatusOfProbeContainer - returns the exit status of the container of a probe Pod, together with
+// the report of its termination message, which is nil when the container did not write one
+func (svc *Service) GetExitStatusOfProbeContainer(
+	ctx context.Context, // the context
+	containerName string, // name of the container
+	timeOut time.Duration, // maximum duration to poll for the container status
+	podName string, // name of the probe Pod
+	podNamespace string, // namespace of the probe Pod
+) (int, *ContainerReport, error) {
+	var (
+		exitCode = -1
+		report   *ContainerReport
+		startErr error
+	)
+
+	err := svc.watchPod(ctx, podName, podNamespace, timeOut, func(pod *corev1.Pod) bool {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != containerName {
+				continue
+			}
+			if startErr = containerStartError(containerName, status.State); startErr != nil {
+				return true
+			}
+			if status.State.Terminated != nil {
+				svc.Log.Info("Probe container has finished executing", "name", containerName,
+					"reason", status.State.Terminated.Reason)
+				exitCode = int(status.State.Terminated.ExitCode)
+				report = svc.parseTerminationMessage(containerName, status.State.Terminated.Message)
+				return true
+			}
+		}
+		return false
+	})
+	if err == nil {
+		err = startErr
+	}
+	if err != nil {
+		return -1, nil, fmt.Errorf("container %s of probe Pod %s in namespace %s did not terminate: %w",
+			containerName, podName, podNamespace, err)
+	}
+
+	return exitCode, report, nil
+}
+
+// ReleaseContainer - deletes the probe Pod running a container once its test is over, it is deleted
+// even if ctx was cancelled
+func (pe *ProbePodExecutor) ReleaseContainer(ctx context.Context, pod *corev1.Pod, _ string) error {
+	return pe.DeleteProbePod(ctx, pod.Name, pod.Namespace)
+}
+
+// DeleteProbePod - deletes the probe Pod name in namespace without grace period, it is deleted even if
+// ctx was cancelled
+func (svc *Service) DeleteProbePod(ctx context.Context, name, namespace string) error {
+	gracePeriod := int64(0)
+
+	err := svc.Client.CoreV1().Pods(namespace).Delete(context.WithoutCancel(ctx), name,
+		metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete probe Pod %s in namespace %s: %w", name, namespace, err)
+	}
+
+	// a probe Pod that no longer exists does not need to be released
+	svc.trackProbePod(name, namespace, false)
+	if err != nil {
+		return fmt.Errorf("unable to delete probe Pod %s in namespace %s: %w", name, namespace, err)
+	}
+
+	svc.Log.Info("Deleted probe Pod", "Pod", name, "Namespace", namespace)
+	return nil
+}
+
+// ReleaseProbePods - deletes the probe Pods that were created and could not be deleted once their test
+// was over, e.g. because the API server was unavailable at the time
+func (svc *Service) ReleaseProbePods(ctx context.Context) error {
+	svc.probePodsMu.Lock()
+	probes := slices.Collect(maps.Keys(svc.probePods))
+	svc.probePodsMu.Unlock()
+
+	var errs []error
+	for _, probe := range probes {
+		if err := svc.DeleteProbePod(ctx, probe.Name, probe.Namespace); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// trackProbePod - records whether the probe Pod name in namespace exists, so that ReleaseProbePods
+// deletes the ones left behind
+func (svc *Service) trackProbePod(name, namespace string, exists bool) {
+	svc.probePodsMu.Lock()
+	defer svc.probePodsMu.Unlock()
+
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	if !exists {
+		delete(svc.probePods, key)
+		return
+	}
+
+	if svc.probePods == nil {
+		svc.probePods = make(map[types.NamespacedName]bool)
+	}
+	svc.probePods[key] = true
+}
@@ -0,0 +1,301 @@
+package kubeops
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestProbePodExecutor - returns a ProbePodExecutor whose Pod watches receive the events sent to the
+// returned watcher
+func newTestProbePodExecutor(objects ...runtime.Object) (*ProbePodExecutor, *watch.FakeWatcher) {
+	client := fake.NewSimpleClientset(objects...)
+	watcher := watch.NewFake()
+	client.PrependWatchReactor("pods", k8stesting.DefaultWatchReactor(watcher, nil))
+
+	return NewProbePodExecutor(New(client, hclog.NewNullLogger())), watcher
+}
+
+func TestProbePodExecutor_LaunchEphemeralContainerInPod(t *testing.T) {
+	ctx := context.Background()
+
+	srcPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "web", UID: "web-1-uid",
+			Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "web",
+			NodeName:           "node-1",
+			Tolerations:        []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "registry"}},
+		},
+	}
+
+	t.Run("the probe Pod impersonates the source Pod", func(t *testing.T) {
+		r := require.New(t)
+		pe, watcher := newTestProbePodExecutor()
+
+		ec, err := pe.BuildEphemeralScannerContainer("netassertv2-client-abc", "scanner:latest", "10.0.0.2",
+			"8080", "tcp", "msg", 3, ContainerSettings{Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			}})
+		r.NoError(err)
+
+		go func() {
+			// events of other Pods and of Pods without IP address are ignored
+			watcher.Modify(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "web"},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.9"}})
+			watcher.Modify(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: "web"},
+				Status: corev1.PodStatus{Phase: corev1.PodPending}})
+			watcher.Modify(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: "web"},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.3"}})
+		}()
+
+		probe, name, err := pe.LaunchEphemeralContainerInPod(ctx, srcPod, ec)
+		r.NoError(err)
+		r.Equal("netassertv2-client-abc", name)
+		r.Equal("10.0.0.3", probe.Status.PodIP)
+
+		created, err := pe.Client.CoreV1().Pods("web").Get(ctx, name, metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal(srcPod.Labels, created.Labels)
+		r.Equal("web-1", created.Annotations[probeOfAnnotation])
+		r.Equal("web", created.Spec.ServiceAccountName)
+		r.Equal("node-1", created.Spec.NodeName)
+		r.Equal(srcPod.Spec.Tolerations, created.Spec.Tolerations)
+		r.Equal(srcPod.Spec.ImagePullSecrets, created.Spec.ImagePullSecrets)
+		r.Equal(corev1.RestartPolicyNever, created.Spec.RestartPolicy)
+		r.Equal([]corev1.PodReadinessGate{{ConditionType: probeReadinessGate}}, created.Spec.ReadinessGates)
+
+		owner := metav1.GetControllerOf(created)
+		r.NotNil(owner)
+		r.Equal("Pod", owner.Kind)
+		r.Equal(srcPod.UID, owner.UID)
+		r.False(*owner.BlockOwnerDeletion)
+
+		r.Len(created.Spec.Containers, 1)
+		r.Equal("scanner:latest", created.Spec.Containers[0].Image)
+		r.Equal(resource.MustParse("100m"), created.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU])
+		// unlike the ephemeral containers, the probe Pods apply the resources of the containers
+		r.True(pe.SupportsContainerResources())
+		r.False(pe.Service.SupportsContainerResources())
+	})
+
+	t.Run("the probe Pod is deleted when it does not start", func(t *testing.T) {
+		r := require.New(t)
+		pe, _ := newTestProbePodExecutor()
+		pe.StartTimeout = 10 * time.Millisecond
+
+		ec, err := pe.BuildEphemeralScannerContainer("netassertv2-client-def", "scanner:latest", "10.0.0.2",
+			"8080", "tcp", "msg", 3, ContainerSettings{})
+		r.NoError(err)
+
+		_, _, err = pe.LaunchEphemeralContainerInPod(ctx, srcPod, ec)
+		r.ErrorContains(err, "probe Pod netassertv2-client-def in namespace web did not start")
+
+		_, err = pe.Client.CoreV1().Pods("web").Get(ctx, ec.Name, metav1.GetOptions{})
+		r.True(apierrors.IsNotFound(err))
+	})
+
+	t.Run("the probe Pod fails to start at once when its image cannot be pulled", func(t *testing.T) {
+		r := require.New(t)
+		pe, watcher := newTestProbePodExecutor()
+
+		ec, err := pe.BuildEphemeralScannerContainer("netassertv2-client-ghi", "scanner:missing", "10.0.0.2",
+			"8080", "tcp", "msg", 3, ContainerSettings{})
+		r.NoError(err)
+
+		waiting := func(reason string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: "web"},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name: ec.Name,
+						State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+							Reason:  reason,
+							Message: "manifest unknown",
+						}},
+					}},
+				},
+			}
+		}
+
+		go func() {
+			// a failed pull may be transient, only the back off of the kubelet is fatal
+			watcher.Modify(waiting("ErrImagePull"))
+			watcher.Modify(waiting("ImagePullBackOff"))
+		}()
+
+		_, _, err = pe.LaunchEphemeralContainerInPod(ctx, srcPod, ec)
+		r.ErrorIs(err, ErrContainerNotStarted)
+		r.ErrorContains(err, "netassertv2-client-ghi is in ImagePullBackOff: manifest unknown")
+
+		_, err = pe.Client.CoreV1().Pods("web").Get(ctx, ec.Name, metav1.GetOptions{})
+		r.True(apierrors.IsNotFound(err))
+	})
+}
+
+func TestProbePodExecutor_GetExitStatusOfEphemeralContainer(t *testing.T) {
+	r := require.New(t)
+	pe, watcher := newTestProbePodExecutor()
+
+	go func() {
+		watcher.Modify(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "web"},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "probe",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: 1,
+						Message:  `{"version":1,"outcome":"refused","detail":"connect: connection refused"}`,
+					}},
+				}},
+			},
+		})
+	}()
+
+	exitCode, report, err := pe.GetExitStatusOfEphemeralContainer(context.Background(), "probe", time.Minute,
+		"probe", "web")
+	r.NoError(err)
+	r.Equal(1, exitCode)
+	r.Equal("refused: connect: connection refused", report.Reason())
+
+	exitCode, _, err = pe.GetExitStatusOfEphemeralContainer(context.Background(), "probe", 10*time.Millisecond,
+		"other-probe", "web")
+	r.ErrorContains(err, "container probe of probe Pod other-probe in namespace web did not terminate")
+	r.Equal(-1, exitCode)
+
+	// the container waiting for an image which cannot be pulled is not waited for until the timeout
+	pe, watcher = newTestProbePodExecutor()
+	go func() {
+		watcher.Modify(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "web"},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "probe",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason: "ImagePullBackOff",
+					}},
+				}},
+			},
+		})
+	}()
+
+	exitCode, _, err = pe.GetExitStatusOfEphemeralContainer(context.Background(), "probe", time.Minute,
+		"probe", "web")
+	r.ErrorIs(err, ErrContainerNotStarted)
+	r.ErrorContains(err, "probe is in ImagePullBackOff")
+	r.Equal(-1, exitCode)
+}
+
+func TestService_GetExitStatusOfEphemeralContainer(t *testing.T) {
+	pod := func(state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "web"},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				EphemeralContainerStatuses: []corev1.ContainerStatus{
+					{Name: "scanner", State: state},
+				},
+			},
+		}
+	}
+
+	t.Run("the exit code of the terminated container is returned", func(t *testing.T) {
+		r := require.New(t)
+		pe, watcher := newTestProbePodExecutor()
+
+		go func() {
+			watcher.Modify(pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}))
+			watcher.Modify(pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}))
+		}()
+
+		exitCode, report, err := pe.Service.GetExitStatusOfEphemeralContainer(context.Background(), "scanner",
+			time.Minute, "web-1", "web")
+		r.NoError(err)
+		r.Equal(1, exitCode)
+		r.Nil(report)
+	})
+
+	t.Run("a container whose image cannot be pulled fails at once", func(t *testing.T) {
+		r := require.New(t)
+		pe, watcher := newTestProbePodExecutor()
+
+		go func() {
+			// a failed pull may be transient, only the back off of the kubelet is fatal
+			watcher.Modify(pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "ErrImagePull",
+				Message: `pull access denied for "scanner:missing"`,
+			}}))
+			watcher.Modify(pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "ImagePullBackOff",
+				Message: `Back-off pulling image "scanner:missing"`,
+			}}))
+		}()
+
+		exitCode, _, err := pe.Service.GetExitStatusOfEphemeralContainer(context.Background(), "scanner",
+			time.Minute, "web-1", "web")
+		r.ErrorIs(err, ErrContainerNotStarted)
+		r.ErrorContains(err, `scanner is in ImagePullBackOff: Back-off pulling image "scanner:missing"`)
+		r.Equal(-1, exitCode)
+	})
+}
+
+func TestProbePodExecutor_ReleaseContainer(t *testing.T) {
+	r := require.New(t)
+	probe := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "web"}}
+	pe, _ := newTestProbePodExecutor(probe)
+
+	// the probe Pod is deleted even when the tests were cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.NoError(pe.ReleaseContainer(ctx, probe, "probe"))
+	_, err := pe.Client.CoreV1().Pods("web").Get(context.Background(), "probe", metav1.GetOptions{})
+	r.True(apierrors.IsNotFound(err))
+
+	r.ErrorContains(pe.ReleaseContainer(ctx, probe, "probe"), "unable to delete probe Pod probe in namespace web")
+}
+
+func TestService_ReleaseProbePods(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	probe := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "web"}}
+	pe, _ := newTestProbePodExecutor(probe)
+	pe.trackProbePod("probe", "web", true)
+	pe.trackProbePod("deleted", "web", true)
+
+	// the probe Pod is left behind when it cannot be deleted once its test is over
+	failed := false
+	pe.Client.(*fake.Clientset).PrependReactor("delete", "pods",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			if failed {
+				return false, nil, nil
+			}
+			failed = true
+			return true, nil, errors.New("etcd is unavailable")
+		})
+
+	r.ErrorContains(pe.ReleaseContainer(ctx, probe, "probe"), "etcd is unavailable")
+	r.Len(pe.probePods, 2)
+
+	// the probe Pods that no longer exist are not reported
+	r.NoError(pe.ReleaseProbePods(ctx))
+	r.Empty(pe.probePods)
+	_, err := pe.Client.CoreV1().Pods("web").Get(ctx, "probe", metav1.GetOptions{})
+	r.True(apierrors.IsNotFound(err))
+}
@@ -0,0 +1,272 @@
+package kubeops
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resourceAccess - an operation on a resource that netassert needs to perform
+type resourceAccess struct {
+	group       string
+	resource    string
+	subresource string
+	verb        string
+}
+
+// String - returns a human readable representation of the resourceAccess
+func (ra resourceAccess) String() string {
+	res := ra.resource
+	if ra.subresource != "" {
+		res += "/" + ra.subresource
+	}
+
+	if ra.group != "" {
+		res = ra.group + "/" + res
+	}
+
+	return ra.verb + " " + res
+}
+
+// resourceKindAccess - operations needed to find a running Pod in each kind of resource
+var resourceKindAccess = map[string][]resourceAccess{
+	"deployment": {
+		{group: "apps", resource: "deployments", verb: "get"},
+		{group: "apps", resource: "replicasets", verb: "list"},
+		{resource: "pods", verb: "list"},
+	},
+	"statefulset": {
+		{group: "apps", resource: "statefulsets", verb: "get"},
+		{resource: "pods", verb: "list"},
+	},
+	"daemonset": {
+		{group: "apps", resource: "daemonsets", verb: "get"},
+		{resource: "pods", verb: "list"},
+	},
+	"pod": {
+		{resource: "pods", verb: "get"},
+	},
+	"node": {
+		{resource: "nodes", verb: "get"},
+		{resource: "nodes", verb: "list"},
+	},
+}
+
+// injectionAccess - operations needed to inject an ephemeral container and wait for its exit status
+var injectionAccess = []resourceAccess{
+	{resource: "pods", subresource: "ephemeralcontainers", verb: "patch"},
+	{resource: "pods", verb: "list"},
+	{resource: "pods", verb: "watch"},
+}
+
+// probePodAccess - operations needed to run a container in a probe Pod and wait for its exit status
+var probePodAccess = []resourceAccess{
+	{resource: "pods", verb: "create"},
+	{resource: "pods", verb: "delete"},
+	{resource: "pods", verb: "list"},
+	{resource: "pods", verb: "watch"},
+}
+
+// execAccess - operations needed to run a command in the tested containers
+var execAccess = []resourceAccess{
+	{resource: "pods", subresource: "exec", verb: "create"},
+}
+
+// NamespaceRequirements - describes what netassert needs to do in a namespace
+type NamespaceRequirements struct {
+	Namespace     string   // name of the namespace
+	ResourceKinds []string // kinds of K8s resources that are looked up in the namespace
+	Scanner       bool     // a scanner container is injected in Pods of this namespace
+	Sniffer       bool     // a sniffer container is injected in Pods of this namespace
+	NodeProbe     bool     // hostNetwork probe Pods run the scanner containers of the node sources in this namespace
+	Executor      Executor // how the containers are run, as ephemeral containers when empty
+	// security contexts of the injected containers
+	SecurityProfile SecurityProfile
+}
+
+// NamespaceReadiness - holds the result of the preflight checks run against a namespace
+type NamespaceReadiness struct {
+	Namespace          string           // name of the namespace
+	PodSecurityLevel   PodSecurityLevel // enforced Pod Security Standards level, empty if unknown
+	MissingPermissions []string         // operations the service account is not allowed to perform
+	Violations         []string         // Pod Security Standards violations of the injected containers
+	ExecutorAccess     AccessStatus     // whether the scanner and sniffer containers can be run by the executor
+	NodeProbeAccess    AccessStatus     // whether the probe Pods of the node sources can be run
+}
+
+// AccessStatus - result of the permission checks of an operation netassert may need in a namespace
+type AccessStatus string
+
+const (
+	AccessNotRequired AccessStatus = "-"      // the operation is not performed in the namespace
+	AccessAllowed     AccessStatus = "ok"     // all the permissions of the operation are granted
+	AccessDenied      AccessStatus = "denied" // some of the permissions of the operation are missing
+)
+
+// newAccessStatus - returns the status of an operation given whether all its permissions are granted
+func newAccessStatus(required, granted bool) AccessStatus {
+	switch {
+	case !required:
+		return AccessNotRequired
+	case !granted:
+		return AccessDenied
+	default:
+		return AccessAllowed
+	}
+}
+
+// Ready - returns true when no problems were found in the namespace
+func (nr *NamespaceReadiness) Ready() bool {
+	return len(nr.MissingPermissions) == 0 && len(nr.Violations) == 0
+}
+
+// PodSecurityLevelString - returns the level as a string, or "unknown" when it could not be determined
+func (nr *NamespaceReadiness) PodSecurityLevelString() string {
+	if nr.PodSecurityLevel == "" {
+		return "unknown"
+	}
+
+	return string(nr.PodSecurityLevel)
+}
+
+// CheckNamespaceReadiness - checks that the current identity has all the permissions needed in a namespace
+// and that the injected containers are not rejected by the PodSecurity admission controller
+func (svc *Service) CheckNamespaceReadiness(
+	ctx context.Context, // the context
+	req NamespaceRequirements, // what netassert needs to do in the namespace
+) (*NamespaceReadiness, error) {
+	if req.Namespace == "" {
+		return nil, fmt.Errorf("namespace cannot be empty string")
+	}
+
+	nr := &NamespaceReadiness{Namespace: req.Namespace}
+
+	var checks []resourceAccess
+	for _, kind := range req.ResourceKinds {
+		access, ok := resourceKindAccess[strings.ToLower(kind)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported resource kind %q", kind)
+		}
+		checks = append(checks, access...)
+	}
+
+	var executorChecks []resourceAccess
+	if req.Scanner || req.Sniffer {
+		switch req.Executor {
+		case ExecutorPod:
+			executorChecks = probePodAccess
+		case ExecutorExec:
+			executorChecks = execAccess
+		default:
+			executorChecks = injectionAccess
+		}
+	}
+
+	// the probe Pods of the node sources are scheduled on the node they were looked up by
+	var nodeProbeChecks []resourceAccess
+	if req.NodeProbe {
+		nodeProbeChecks = slices.Concat(resourceKindAccess["node"], probePodAccess)
+	}
+
+	// every operation is reviewed once, and reported once in MissingPermissions
+	allowed := make(map[resourceAccess]bool)
+	review := func(checks []resourceAccess) (bool, error) {
+		granted := true
+		for _, check := range checks {
+			ok, seen := allowed[check]
+			if !seen {
+				var err error
+				if ok, err = svc.canI(ctx, req.Namespace, check); err != nil {
+					return false, err
+				}
+				allowed[check] = ok
+
+				if !ok {
+					nr.MissingPermissions = append(nr.MissingPermissions, check.String())
+				}
+			}
+			granted = granted && ok
+		}
+
+		return granted, nil
+	}
+
+	if _, err := review(checks); err != nil {
+		return nil, err
+	}
+
+	granted, err := review(executorChecks)
+	if err != nil {
+		return nil, err
+	}
+	nr.ExecutorAccess = newAccessStatus(req.Scanner || req.Sniffer, granted)
+
+	if granted, err = review(nodeProbeChecks); err != nil {
+		return nil, err
+	}
+	nr.NodeProbeAccess = newAccessStatus(req.NodeProbe, granted)
+
+	ns, err := svc.Client.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		nr.Violations = append(nr.Violations, fmt.Sprintf("namespace %s does not exist", req.Namespace))
+		return nr, nil
+	case apierrors.IsForbidden(err):
+		// we cannot read the labels of the namespace, so the admission checks are skipped
+		svc.Log.Warn("Unable to read namespace labels, skipping PodSecurity checks",
+			"namespace", req.Namespace, "error", err)
+		return nr, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to get namespace %s: %w", req.Namespace, err)
+	}
+
+	nr.PodSecurityLevel = namespacePodSecurityLevel(ns)
+
+	if req.NodeProbe && nr.PodSecurityLevel != "" && nr.PodSecurityLevel != PodSecurityPrivileged {
+		nr.Violations = append(nr.Violations, "node probe: host network is not allowed")
+	}
+
+	if req.Scanner || req.NodeProbe {
+		for _, v := range PodSecurityViolations(nr.PodSecurityLevel, req.SecurityProfile.ScannerSecurityContext()) {
+			nr.Violations = append(nr.Violations, "scanner: "+v)
+		}
+	}
+
+	if req.Sniffer {
+		for _, v := range PodSecurityViolations(nr.PodSecurityLevel, req.SecurityProfile.SnifferSecurityContext()) {
+			nr.Violations = append(nr.Violations, "sniffer: "+v)
+		}
+	}
+
+	return nr, nil
+}
+
+// canI - checks if the current identity is allowed to perform an operation using a SelfSubjectAccessReview
+func (svc *Service) canI(ctx context.Context, namespace string, ra resourceAccess) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        ra.verb,
+				Group:       ra.group,
+				Resource:    ra.resource,
+				Subresource: ra.subresource,
+			},
+		},
+	}
+
+	resp, err := svc.Client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("unable to check permission %q in namespace %s: %w", ra.String(), namespace, err)
+	}
+
+	svc.Log.Debug("SelfSubjectAccessReview", "namespace", namespace, "access", ra.String(),
+		"allowed", resp.Status.Allowed, "reason", resp.Status.Reason)
+
+	return resp.Status.Allowed, nil
+}
@@ -0,0 +1,253 @@
+package kubeops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newAccessReviewClient - returns a fake clientset that only allows the operations in allowed
+func newAccessReviewClient(allowed map[string]bool, objects ...runtime.Object) *fake.Clientset {
+	fakeClient := fake.NewSimpleClientset(objects...)
+
+	fakeClient.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attr := review.Spec.ResourceAttributes
+			ra := resourceAccess{
+				group:       attr.Group,
+				resource:    attr.Resource,
+				subresource: attr.Subresource,
+				verb:        attr.Verb,
+			}
+			review.Status.Allowed = allowed[ra.String()]
+			return true, review, nil
+		})
+
+	return fakeClient
+}
+
+func TestCheckNamespaceReadiness(t *testing.T) {
+	ctx := context.Background()
+
+	allAllowed := map[string]bool{
+		"get apps/deployments":            true,
+		"list apps/replicasets":           true,
+		"list pods":                       true,
+		"get pods":                        true,
+		"watch pods":                      true,
+		"patch pods/ephemeralcontainers":  true,
+		"get apps/statefulsets":           true,
+		"get apps/daemonsets":             true,
+		"create selfsubjectaccessreviews": true,
+	}
+
+	namespace := func(name, level string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if level != "" {
+			ns.Labels = map[string]string{podSecurityEnforceLabel: level}
+		}
+		return ns
+	}
+
+	t.Run("all permissions and privileged namespace", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed, namespace("ns1", "")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"deployment"},
+			Scanner:       true,
+			Sniffer:       true,
+		})
+		r.NoError(err)
+		r.True(nr.Ready())
+		r.Equal(PodSecurityPrivileged, nr.PodSecurityLevel)
+		r.Equal(AccessAllowed, nr.ExecutorAccess)
+		r.Equal(AccessNotRequired, nr.NodeProbeAccess)
+	})
+
+	t.Run("missing ephemeral container permissions", func(t *testing.T) {
+		r := require.New(t)
+		allowed := map[string]bool{"get pods": true, "list pods": true, "watch pods": true}
+		svc := New(newAccessReviewClient(allowed, namespace("ns1", "")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"pod"},
+			Scanner:       true,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"patch pods/ephemeralcontainers"}, nr.MissingPermissions)
+		r.Equal(AccessDenied, nr.ExecutorAccess)
+	})
+
+	t.Run("missing probe Pod permissions", func(t *testing.T) {
+		r := require.New(t)
+		allowed := map[string]bool{"get pods": true, "list pods": true, "watch pods": true, "create pods": true}
+		svc := New(newAccessReviewClient(allowed, namespace("ns1", "")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"pod"},
+			Scanner:       true,
+			Executor:      ExecutorPod,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"delete pods"}, nr.MissingPermissions)
+		r.Equal(AccessDenied, nr.ExecutorAccess)
+	})
+
+	t.Run("missing exec permission", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed, namespace("ns1", "")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"pod"},
+			Scanner:       true,
+			Executor:      ExecutorExec,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"create pods/exec"}, nr.MissingPermissions)
+		r.Equal(AccessDenied, nr.ExecutorAccess)
+	})
+
+	t.Run("baseline profile is rejected by restricted namespace", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed, namespace("ns1", "restricted")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:       "ns1",
+			ResourceKinds:   []string{"pod"},
+			Scanner:         true,
+			SecurityProfile: BaselineSecurityProfile(),
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Len(nr.Violations, 2)
+
+		nr, err = svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"pod"},
+			Scanner:       true,
+		})
+		r.NoError(err)
+		r.True(nr.Ready())
+	})
+
+	t.Run("sniffer is rejected by baseline namespace", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed, namespace("ns1", "baseline")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"statefulset"},
+			Scanner:       true,
+			Sniffer:       true,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"sniffer: capability NET_RAW is not allowed"}, nr.Violations)
+	})
+
+	t.Run("node probes need the host network", func(t *testing.T) {
+		r := require.New(t)
+		allowed := map[string]bool{"get nodes": true, "list nodes": true, "create pods": true, "delete pods": true}
+		svc := New(newAccessReviewClient(allowed, namespace("ns1", "baseline")), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"node"},
+			NodeProbe:     true,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"list pods", "watch pods"}, nr.MissingPermissions)
+		r.Equal([]string{"node probe: host network is not allowed"}, nr.Violations)
+		r.Equal(AccessNotRequired, nr.ExecutorAccess)
+		r.Equal(AccessDenied, nr.NodeProbeAccess)
+	})
+
+	t.Run("node probes need to look up the nodes", func(t *testing.T) {
+		r := require.New(t)
+		allowed := map[string]bool{"create pods": true, "delete pods": true, "list pods": true, "watch pods": true}
+		svc := New(newAccessReviewClient(allowed, namespace("ns1", "")), hclog.NewNullLogger())
+
+		// the nodes are looked up even when the kind of the resources is not passed
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace: "ns1",
+			NodeProbe: true,
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Equal([]string{"get nodes", "list nodes"}, nr.MissingPermissions)
+		r.Equal(AccessDenied, nr.NodeProbeAccess)
+
+		allowed["get nodes"], allowed["list nodes"] = true, true
+		nr, err = svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace: "ns1",
+			NodeProbe: true,
+		})
+		r.NoError(err)
+		r.True(nr.Ready())
+		r.Equal(AccessAllowed, nr.NodeProbeAccess)
+	})
+
+	t.Run("namespace does not exist", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed), hclog.NewNullLogger())
+
+		nr, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"daemonset"},
+		})
+		r.NoError(err)
+		r.False(nr.Ready())
+		r.Contains(nr.Violations[0], "does not exist")
+	})
+
+	t.Run("unsupported resource kind", func(t *testing.T) {
+		r := require.New(t)
+		svc := New(newAccessReviewClient(allAllowed), hclog.NewNullLogger())
+
+		_, err := svc.CheckNamespaceReadiness(ctx, NamespaceRequirements{
+			Namespace:     "ns1",
+			ResourceKinds: []string{"cronjob"},
+		})
+		r.Error(err)
+	})
+}
+
+func TestPodSecurityViolations(t *testing.T) {
+	r := require.New(t)
+
+	restricted := RestrictedSecurityProfile()
+	baseline := BaselineSecurityProfile()
+
+	r.Empty(PodSecurityViolations(PodSecurityPrivileged, restricted.SnifferSecurityContext()))
+	r.Empty(PodSecurityViolations(PodSecurityRestricted, restricted.ScannerSecurityContext()))
+	r.Equal([]string{"capability NET_RAW is not allowed"},
+		PodSecurityViolations(PodSecurityRestricted, restricted.SnifferSecurityContext()))
+	r.Empty(PodSecurityViolations(PodSecurityBaseline, baseline.ScannerSecurityContext()))
+	r.NotEmpty(PodSecurityViolations(PodSecurityBaseline, baseline.SnifferSecurityContext()))
+	r.ElementsMatch([]string{
+		"seccompProfile must be set to RuntimeDefault or Localhost",
+		"capabilities must drop ALL",
+	}, PodSecurityViolations(PodSecurityRestricted, baseline.ScannerSecurityContext()))
+
+	r.Equal(PodSecurityRestricted, PodSecurityLevelOf(restricted.ScannerSecurityContext()))
+	r.Equal(PodSecurityBaseline, PodSecurityLevelOf(baseline.ScannerSecurityContext()))
+	r.Equal(PodSecurityPrivileged, PodSecurityLevelOf(restricted.SnifferSecurityContext()))
+}
@@ -0,0 +1,93 @@
+package kubeops
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// ContainerReportVersion - version of the report written by the scanner and the sniffer containers to
+// their termination message, /dev/termination-log, once they are done
+const ContainerReportVersion = 1
+
+// ContainerReport - report written by the scanner and the sniffer containers to their termination message
+// as a JSON object. The images that only return an exit code do not write a report, and the reports
+// without a version only hold the measurements of the connection.
+type ContainerReport struct {
+	Version              int          `json:"version"`                        // version of the report
+	Outcome              data.Outcome `json:"outcome,omitempty"`              // what the container observed
+	Detail               string       `json:"detail,omitempty"`               // e.g. the error of the last attempt
+	ConnectLatencyMicros int64        `json:"connectLatencyMicros,omitempty"` // time taken to establish the connection
+	TransferredBytes     int64        `json:"transferredBytes,omitempty"`     // bytes sent to the destination
+	TransferMicros       int64        `json:"transferMicros,omitempty"`       // time taken to send the bytes
+}
+
+// ParseContainerReport - parses the report written by a container to its termination message, and
+// returns nil when the message is empty, i.e. when the image of the container only returns an exit code
+func ParseContainerReport(message string) (*ContainerReport, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, nil
+	}
+
+	var report ContainerReport
+	if err := json.Unmarshal([]byte(message), &report); err != nil {
+		return nil, fmt.Errorf("unable to decode the termination message %q: %w", message, err)
+	}
+
+	if report.Version < 0 || report.Version > ContainerReportVersion {
+		return nil, fmt.Errorf("unsupported version %d of the termination message, expected at most %d",
+			report.Version, ContainerReportVersion)
+	}
+
+	if report.Outcome != "" && !data.ValidOutcomes[report.Outcome] {
+		return nil, fmt.Errorf("unknown outcome %q in the termination message", report.Outcome)
+	}
+
+	if report.ConnectLatencyMicros < 0 || report.TransferredBytes < 0 || report.TransferMicros < 0 {
+		return nil, fmt.Errorf("negative measurements in the termination message %q", message)
+	}
+
+	return &report, nil
+}
+
+// Measurements - returns the measurements of the connection, nil when the report has none
+func (r *ContainerReport) Measurements() *data.Measurements {
+	if r == nil || (r.ConnectLatencyMicros == 0 && r.TransferredBytes == 0) {
+		return nil
+	}
+
+	return &data.Measurements{
+		ConnectLatency:   time.Duration(r.ConnectLatencyMicros) * time.Microsecond,
+		TransferredBytes: r.TransferredBytes,
+		TransferDuration: time.Duration(r.TransferMicros) * time.Microsecond,
+	}
+}
+
+// Reason - returns the outcome and the detail of the report, e.g. "refused: connect: connection refused",
+// or an empty string when they were not reported
+func (r *ContainerReport) Reason() string {
+	switch {
+	case r == nil || r.Outcome == "":
+		return ""
+	case r.Detail == "":
+		return string(r.Outcome)
+	default:
+		return string(r.Outcome) + ": " + r.Detail
+	}
+}
+
+// parseTerminationMessage - returns the report of a terminated container, the exit code alone is
+// used when the message is not a valid report
+func (svc *Service) parseTerminationMessage(containerName, message string) *ContainerReport {
+	report, err := ParseContainerReport(message)
+	if err != nil {
+		svc.Log.Warn("Ignoring the termination message of the container", "container", containerName,
+			"error", err)
+		return nil
+	}
+
+	return report
+}
@@ -0,0 +1,68 @@
+package kubeops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+func TestParseContainerReport(t *testing.T) {
+	r := require.New(t)
+
+	report, err := ParseContainerReport(
+		`{"version":1,"outcome":"refused","detail":"connect: connection refused"}`)
+	r.NoError(err)
+	r.Equal(data.OutcomeRefused, report.Outcome)
+	r.Equal("refused: connect: connection refused", report.Reason())
+	r.Nil(report.Measurements())
+
+	report, err = ParseContainerReport(
+		`{"version":1,"outcome":"connected","connectLatencyMicros":1500,"transferredBytes":1000,"transferMicros":2000}`)
+	r.NoError(err)
+	r.Equal("connected", report.Reason())
+	r.Equal(&data.Measurements{
+		ConnectLatency:   1500 * time.Microsecond,
+		TransferredBytes: 1000,
+		TransferDuration: 2 * time.Millisecond,
+	}, report.Measurements())
+
+	// the reports without a version only hold the measurements
+	report, err = ParseContainerReport(`{"connectLatencyMicros":1500}`)
+	r.NoError(err)
+	r.Empty(report.Reason())
+	r.Equal(1500*time.Microsecond, report.Measurements().ConnectLatency)
+
+	// the images that only return an exit code do not write a report
+	report, err = ParseContainerReport(" \n")
+	r.NoError(err)
+	r.Nil(report)
+	r.Empty(report.Reason())
+	r.Nil(report.Measurements())
+
+	_, err = ParseContainerReport("connection established")
+	r.ErrorContains(err, "unable to decode the termination message")
+
+	_, err = ParseContainerReport(`{"version":2,"outcome":"connected"}`)
+	r.ErrorContains(err, "unsupported version 2 of the termination message")
+
+	_, err = ParseContainerReport(`{"version":1,"outcome":"blocked"}`)
+	r.ErrorContains(err, `unknown outcome "blocked"`)
+
+	_, err = ParseContainerReport(`{"version":1,"connectLatencyMicros":-1}`)
+	r.ErrorContains(err, "negative measurements")
+}
+
+func TestService_parseTerminationMessage(t *testing.T) {
+	r := require.New(t)
+	svc := Service{Client: fake.NewSimpleClientset(), Log: hclog.NewNullLogger()}
+
+	// the exit code alone is used when the message is not a report
+	r.Nil(svc.parseTerminationMessage("scanner", "connection established"))
+	r.Equal(data.OutcomeTimeout,
+		svc.parseTerminationMessage("scanner", `{"version":1,"outcome":"timeout"}`).Outcome)
+}
@@ -0,0 +1,152 @@
+package kubeops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	SecurityProfileRestricted = "restricted" // complies with the restricted Pod Security Standard, except for NET_RAW
+	SecurityProfileBaseline   = "baseline"   // security contexts used by the previous releases
+	SecurityProfileCustom     = "custom"     // security contexts loaded from a YAML file
+
+	netRawCapability = corev1.Capability("NET_RAW") // needed by the sniffer to read packets
+)
+
+// SecurityProfile - holds the security contexts of the injected scanner and sniffer containers
+type SecurityProfile struct {
+	Name    string                  `json:"-"`
+	Scanner *corev1.SecurityContext `json:"scanner,omitempty"`
+	Sniffer *corev1.SecurityContext `json:"sniffer,omitempty"`
+}
+
+// RestrictedSecurityProfile - returns the default profile, the scanner complies with the restricted
+// Pod Security Standard while the sniffer only adds the NET_RAW capability on top of it
+func RestrictedSecurityProfile() SecurityProfile {
+	restricted := func(add ...corev1.Capability) *corev1.SecurityContext {
+		return &corev1.SecurityContext{
+			RunAsNonRoot:             pointer.Bool(true),
+			AllowPrivilegeEscalation: pointer.Bool(false),
+			Capabilities: &corev1.Capabilities{
+				Add:  add,
+				Drop: []corev1.Capability{"ALL"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
+		}
+	}
+
+	return SecurityProfile{
+		Name:    SecurityProfileRestricted,
+		Scanner: restricted(),
+		Sniffer: restricted(netRawCapability),
+	}
+}
+
+// BaselineSecurityProfile - returns the profile that only sets RunAsNonRoot and AllowPrivilegeEscalation
+func BaselineSecurityProfile() SecurityProfile {
+	return SecurityProfile{
+		Name: SecurityProfileBaseline,
+		Scanner: &corev1.SecurityContext{
+			RunAsNonRoot:             pointer.Bool(true),
+			AllowPrivilegeEscalation: pointer.Bool(false),
+		},
+		Sniffer: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add: []corev1.Capability{netRawCapability},
+			},
+			AllowPrivilegeEscalation: pointer.Bool(false),
+			RunAsNonRoot:             pointer.Bool(true),
+		},
+	}
+}
+
+// NewSecurityProfile - returns the restricted or baseline profile, or loads a custom profile
+// from a YAML file when profile is neither
+func NewSecurityProfile(profile string) (SecurityProfile, error) {
+	switch profile {
+	case "", SecurityProfileRestricted:
+		return RestrictedSecurityProfile(), nil
+	case SecurityProfileBaseline:
+		return BaselineSecurityProfile(), nil
+	default:
+		return LoadSecurityProfile(profile)
+	}
+}
+
+// LoadSecurityProfile - loads a custom profile from a YAML file, the containers that are
+// missing from the file use the security context of the restricted profile
+func LoadSecurityProfile(fileName string) (SecurityProfile, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return SecurityProfile{}, fmt.Errorf("unable to open security profile file %q: %w", fileName, err)
+	}
+	defer fp.Close()
+
+	var sp SecurityProfile
+	if err := yaml.NewYAMLOrJSONDecoder(fp, 4096).Decode(&sp); err != nil {
+		return SecurityProfile{}, fmt.Errorf("unable to decode security profile file %q: %w", fileName, err)
+	}
+
+	sp.Name = SecurityProfileCustom
+	if err := sp.Validate(); err != nil {
+		return SecurityProfile{}, fmt.Errorf("invalid security profile in file %q: %w", fileName, err)
+	}
+
+	return sp, nil
+}
+
+// Validate - ensures that the containers can do their job with the security contexts of the profile
+func (sp SecurityProfile) Validate() error {
+	var privilegedErr, netRawErr error
+
+	for name, sc := range map[string]*corev1.SecurityContext{
+		"scanner": sp.ScannerSecurityContext(),
+		"sniffer": sp.SnifferSecurityContext(),
+	} {
+		if sc.Privileged != nil && *sc.Privileged {
+			privilegedErr = errors.Join(privilegedErr, fmt.Errorf("%s container cannot be privileged", name))
+		}
+	}
+
+	sniffer := sp.SnifferSecurityContext()
+	if sniffer.Capabilities == nil || !slices.Contains(sniffer.Capabilities.Add, netRawCapability) {
+		netRawErr = fmt.Errorf("sniffer container must add the %s capability", netRawCapability)
+	}
+
+	return errors.Join(privilegedErr, netRawErr)
+}
+
+// ScannerSecurityContext - returns the security context of the scanner container
+func (sp SecurityProfile) ScannerSecurityContext() *corev1.SecurityContext {
+	if sp.Scanner == nil {
+		return RestrictedSecurityProfile().Scanner
+	}
+
+	return sp.Scanner.DeepCopy()
+}
+
+// SnifferSecurityContext - returns the security context of the sniffer container
+func (sp SecurityProfile) SnifferSecurityContext() *corev1.SecurityContext {
+	if sp.Sniffer == nil {
+		return RestrictedSecurityProfile().Sniffer
+	}
+
+	return sp.Sniffer.DeepCopy()
+}
+
+// String - returns the name of the profile
+func (sp SecurityProfile) String() string {
+	if sp.Name == "" {
+		return SecurityProfileRestricted
+	}
+
+	return sp.Name
+}
@@ -0,0 +1,73 @@
+package kubeops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewSecurityProfile(t *testing.T) {
+	writeProfile := func(t *testing.T, body string) string {
+		fileName := filepath.Join(t.TempDir(), "profile.yaml")
+		require.NoError(t, os.WriteFile(fileName, []byte(body), 0o600))
+		return fileName
+	}
+
+	t.Run("restricted is the default", func(t *testing.T) {
+		r := require.New(t)
+		sp, err := NewSecurityProfile("")
+		r.NoError(err)
+		r.Equal(SecurityProfileRestricted, sp.String())
+		r.Equal(corev1.SeccompProfileTypeRuntimeDefault, sp.ScannerSecurityContext().SeccompProfile.Type)
+		r.NoError(sp.Validate())
+	})
+
+	t.Run("baseline", func(t *testing.T) {
+		r := require.New(t)
+		sp, err := NewSecurityProfile(SecurityProfileBaseline)
+		r.NoError(err)
+		r.Nil(sp.ScannerSecurityContext().SeccompProfile)
+		r.NoError(sp.Validate())
+	})
+
+	t.Run("custom profile from YAML", func(t *testing.T) {
+		r := require.New(t)
+		sp, err := NewSecurityProfile(writeProfile(t, `
+sniffer:
+  runAsNonRoot: true
+  runAsUser: 1000
+  allowPrivilegeEscalation: false
+  capabilities:
+    add: ["NET_RAW"]
+    drop: ["ALL"]
+  seccompProfile:
+    type: Localhost
+    localhostProfile: profiles/sniffer.json
+`))
+		r.NoError(err)
+		r.Equal(SecurityProfileCustom, sp.String())
+		r.Equal(int64(1000), *sp.SnifferSecurityContext().RunAsUser)
+		r.Equal(corev1.SeccompProfileTypeLocalhost, sp.SnifferSecurityContext().SeccompProfile.Type)
+		// the scanner falls back to the restricted profile
+		r.Equal(RestrictedSecurityProfile().Scanner, sp.ScannerSecurityContext())
+	})
+
+	t.Run("custom profile without NET_RAW for the sniffer", func(t *testing.T) {
+		r := require.New(t)
+		_, err := NewSecurityProfile(writeProfile(t, `
+sniffer:
+  privileged: true
+`))
+		r.Error(err)
+		r.Contains(err.Error(), "sniffer container cannot be privileged")
+		r.Contains(err.Error(), "sniffer container must add the NET_RAW capability")
+	})
+
+	t.Run("custom profile that does not exist", func(t *testing.T) {
+		_, err := NewSecurityProfile("./does-not-exist.yaml")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,117 @@
+package kubeops
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// environment of the scanner container waiting for a reply of the destination, the scanner sends the
+// payload up to ATTEMPTS times and exits with 0 as soon as a reply matches, and with 1 otherwise
+const (
+	envProbeMode        = "PROBE_MODE"         // set to probeModeResponse to wait for a reply
+	envPayloadHex       = "PAYLOAD_HEX"        // hex encoded payload sent instead of MESSAGE
+	envResponseMaskHex  = "RESPONSE_MASK_HEX"  // hex encoded mask applied to the first bytes of the reply
+	envResponseMatchHex = "RESPONSE_MATCH_HEX" // hex encoded bytes the masked reply must be equal to
+	envResponsePattern  = "RESPONSE_PATTERN"   // regular expression the reply must match
+	envTimeoutSeconds   = "TIMEOUT_SECONDS"    // maximum duration to wait for a reply
+
+	probeModeResponse = "response"
+	ntpPacketLength   = 48 // length of an NTP packet without extension fields
+)
+
+// UDPProbeEnv - returns the environment of the scanner container sending the request of the probe and
+// waiting for a reply of the destination for at most timeoutSeconds
+func UDPProbeEnv(probe *data.UDPProbe, timeoutSeconds int) ([]corev1.EnvVar, error) {
+	if probe == nil {
+		return nil, fmt.Errorf("probe parameter is nil")
+	}
+
+	var (
+		payload, mask, match []byte
+		pattern              string
+		err                  error
+	)
+
+	switch probe.Type {
+	case data.UDPProbeDNS:
+		payload, mask, match, err = dnsQuery(probe.Query)
+	case data.UDPProbeNTP:
+		payload, mask, match = ntpRequest()
+	case data.UDPProbeCustom:
+		payload = []byte(probe.Payload)
+		if probe.PayloadHex != "" {
+			payload, err = hex.DecodeString(probe.PayloadHex)
+		}
+		pattern = probe.Response
+	default:
+		err = fmt.Errorf("unsupported udpProbe type %q", probe.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	env := []corev1.EnvVar{
+		{Name: envProbeMode, Value: probeModeResponse},
+		{Name: envPayloadHex, Value: hex.EncodeToString(payload)},
+		{Name: envTimeoutSeconds, Value: strconv.Itoa(timeoutSeconds)},
+	}
+
+	if len(mask) > 0 {
+		env = append(env,
+			corev1.EnvVar{Name: envResponseMaskHex, Value: hex.EncodeToString(mask)},
+			corev1.EnvVar{Name: envResponseMatchHex, Value: hex.EncodeToString(match)},
+		)
+	}
+
+	if pattern != "" {
+		env = append(env, corev1.EnvVar{Name: envResponsePattern, Value: pattern})
+	}
+
+	return env, nil
+}
+
+// dnsQuery - returns a recursive DNS query of the A records of name, the root zone when it is empty,
+// together with the mask and the bytes matching a response to the query, whatever its response code
+func dnsQuery(name string) ([]byte, []byte, []byte, error) {
+	id := make([]byte, 2)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to generate the DNS query ID: %w", err)
+	}
+
+	// header: ID, flags with recursion desired, one question and no records
+	query := []byte{id[0], id[1], 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	if name = strings.TrimSuffix(name, "."); name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, nil, nil, fmt.Errorf("%q is not a valid domain name", name)
+			}
+
+			query = append(query, byte(len(label)))
+			query = append(query, label...)
+		}
+	}
+
+	// end of the name, type A and class IN
+	query = append(query, 0x00, 0x00, 0x01, 0x00, 0x01)
+
+	// the response has the ID of the query and the QR bit set
+	return query, []byte{0xff, 0xff, 0x80}, []byte{id[0], id[1], 0x80}, nil
+}
+
+// ntpRequest - returns an NTPv4 client request, together with the mask and the bytes matching the
+// mode of a server response
+func ntpRequest() ([]byte, []byte, []byte) {
+	request := make([]byte, ntpPacketLength)
+	request[0] = 0x23 // leap indicator 0, version 4 and mode 3 (client)
+
+	return request, []byte{0x07}, []byte{0x04} // mode 4 (server)
+}
@@ -0,0 +1,94 @@
+package kubeops
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// envMap - returns the environment variables as a map
+func envMap(env []corev1.EnvVar) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, e := range env {
+		m[e.Name] = e.Value
+	}
+
+	return m
+}
+
+func TestUDPProbeEnv(t *testing.T) {
+	t.Run("dns", func(t *testing.T) {
+		r := require.New(t)
+
+		env, err := UDPProbeEnv(&data.UDPProbe{Type: data.UDPProbeDNS, Query: "example.com."}, 10)
+		r.NoError(err)
+
+		m := envMap(env)
+		r.Equal("response", m["PROBE_MODE"])
+		r.Equal("10", m["TIMEOUT_SECONDS"])
+		r.Equal("ffff80", m["RESPONSE_MASK_HEX"])
+
+		query, err := hex.DecodeString(m["PAYLOAD_HEX"])
+		r.NoError(err)
+		// the response must have the ID of the query
+		r.Equal(hex.EncodeToString(query[:2])+"80", m["RESPONSE_MATCH_HEX"])
+		// one question for the A records of example.com in the IN class
+		r.Equal([]byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, query[2:12])
+		r.Equal("\x07example\x03com\x00\x00\x01\x00\x01", string(query[12:]))
+	})
+
+	t.Run("dns query of the root zone", func(t *testing.T) {
+		r := require.New(t)
+
+		env, err := UDPProbeEnv(&data.UDPProbe{Type: data.UDPProbeDNS}, 10)
+		r.NoError(err)
+
+		query, err := hex.DecodeString(envMap(env)["PAYLOAD_HEX"])
+		r.NoError(err)
+		r.Equal([]byte{0x00, 0x00, 0x01, 0x00, 0x01}, query[12:])
+	})
+
+	t.Run("ntp", func(t *testing.T) {
+		r := require.New(t)
+
+		env, err := UDPProbeEnv(&data.UDPProbe{Type: data.UDPProbeNTP}, 5)
+		r.NoError(err)
+
+		m := envMap(env)
+		r.Len(m["PAYLOAD_HEX"], 2*ntpPacketLength)
+		r.Equal("23", m["PAYLOAD_HEX"][:2])
+		r.Equal("07", m["RESPONSE_MASK_HEX"])
+		r.Equal("04", m["RESPONSE_MATCH_HEX"])
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		r := require.New(t)
+
+		env, err := UDPProbeEnv(&data.UDPProbe{Type: data.UDPProbeCustom, Payload: "ping", Response: "^pong"}, 5)
+		r.NoError(err)
+
+		m := envMap(env)
+		r.Equal(hex.EncodeToString([]byte("ping")), m["PAYLOAD_HEX"])
+		r.Equal("^pong", m["RESPONSE_PATTERN"])
+		r.NotContains(m, "RESPONSE_MASK_HEX")
+
+		env, err = UDPProbeEnv(&data.UDPProbe{Type: data.UDPProbeCustom, PayloadHex: "00ff"}, 5)
+		r.NoError(err)
+		r.Equal("00ff", envMap(env)["PAYLOAD_HEX"])
+		r.NotContains(envMap(env), "RESPONSE_PATTERN")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := UDPProbeEnv(nil, 5)
+		r.ErrorContains(err, "probe parameter is nil")
+
+		_, err = UDPProbeEnv(&data.UDPProbe{Type: "snmp"}, 5)
+		r.ErrorContains(err, `unsupported udpProbe type "snmp"`)
+	})
+}
@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+const (
+	metricsNamespace = "netassert" // prefix of all the metrics
+	testLabel        = "test"      // label holding the name of the test
+)
+
+// Metrics - holds the Prometheus metrics exposed by the monitor
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	testPass        *prometheus.GaugeVec
+	testDuration    *prometheus.GaugeVec
+	testFailures    *prometheus.CounterVec
+	connectLatency  *prometheus.GaugeVec
+	throughput      *prometheus.GaugeVec
+	runs            prometheus.Counter
+	triggeredRuns   prometheus.Counter
+	runErrors       prometheus.Counter
+	runDuration     prometheus.Gauge
+	lastRunTime     prometheus.Gauge
+	lastSuccessTime prometheus.Gauge
+}
+
+// NewMetrics - returns the metrics of the monitor registered to a new registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		testPass: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "test_pass",
+			Help:      "Whether the test passed (1) or failed (0) in the last run, skipped tests are not reported.",
+		}, []string{testLabel}),
+		testDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "test_duration_seconds",
+			Help:      "Duration of the test in the last run.",
+		}, []string{testLabel}),
+		testFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "test_failures_total",
+			Help:      "Number of runs in which the test failed.",
+		}, []string{testLabel}),
+		connectLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "test_connect_latency_seconds",
+			Help:      "Time taken to establish the connection of the test in the last run, only tests with thresholds are measured.",
+		}, []string{testLabel}),
+		throughput: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "test_throughput_bits_per_second",
+			Help:      "Throughput of the connection of the test in the last run, only tests with a minThroughput are measured.",
+		}, []string{testLabel}),
+		runs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runs_total",
+			Help:      "Number of runs of the test suite.",
+		}),
+		triggeredRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "triggered_runs_total",
+			Help:      "Number of runs of the tests affected by a change of a NetworkPolicy.",
+		}),
+		runErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "run_errors_total",
+			Help:      "Number of runs that could not be started, e.g. because the tests could not be loaded.",
+		}),
+		runDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "run_duration_seconds",
+			Help:      "Duration of the last run of the test suite.",
+		}),
+		lastRunTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time at which the last run of the test suite finished.",
+		}),
+		lastSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time at which the last run in which all the tests passed finished.",
+		}),
+	}
+
+	m.Registry.MustRegister(m.testPass, m.testDuration, m.testFailures, m.connectLatency, m.throughput, m.runs,
+		m.triggeredRuns, m.runErrors, m.runDuration, m.lastRunTime, m.lastSuccessTime)
+
+	return m
+}
+
+// observeRun - updates the metrics with the results of a run of the test suite
+func (m *Metrics) observeRun(tests data.Tests, duration time.Duration, finished time.Time) {
+	m.runs.Inc()
+	m.runDuration.Set(duration.Seconds())
+	m.lastRunTime.Set(float64(finished.Unix()))
+
+	// tests may be renamed or removed between runs, so only the tests of the last run are reported
+	m.testPass.Reset()
+	m.testDuration.Reset()
+	m.connectLatency.Reset()
+	m.throughput.Reset()
+
+	if !m.observeTests(tests) {
+		m.lastSuccessTime.Set(float64(finished.Unix()))
+	}
+}
+
+// observeTriggeredRun - updates the metrics with the results of a run of some of the tests
+func (m *Metrics) observeTriggeredRun(tests data.Tests) {
+	m.triggeredRuns.Inc()
+	m.observeTests(tests)
+}
+
+// observeTests - updates the metrics of the tests, returns true when at least one of them failed
+func (m *Metrics) observeTests(tests data.Tests) bool {
+	failed := false
+	for _, te := range tests {
+		if te.Skipped() {
+			continue
+		}
+
+		pass := 0.0
+		if te.Pass {
+			pass = 1
+		}
+		m.testPass.WithLabelValues(te.Name).Set(pass)
+
+		if te.Observation != nil {
+			m.testDuration.WithLabelValues(te.Name).Set(te.Observation.Duration.Seconds())
+		}
+
+		m.observeMeasurements(te)
+
+		// make sure that the counter is exported even before the first failure
+		failures := m.testFailures.WithLabelValues(te.Name)
+		if te.Failed() {
+			failures.Inc()
+			failed = true
+		}
+	}
+
+	return failed
+}
+
+// observeMeasurements - updates the metrics with the measurements of a test and of its sub-tests, which
+// are labelled with their own name
+func (m *Metrics) observeMeasurements(te *data.Test) {
+	if te.Observation != nil && te.Observation.Measurements != nil {
+		measurements := te.Observation.Measurements
+		m.connectLatency.WithLabelValues(te.Name).Set(measurements.ConnectLatency.Seconds())
+
+		if measurements.TransferredBytes > 0 {
+			m.throughput.WithLabelValues(te.Name).Set(measurements.Throughput())
+		}
+	}
+
+	for _, sub := range te.SubTests {
+		m.observeMeasurements(sub)
+	}
+}
+
+// observeRunError - updates the metrics when a run could not be started
+func (m *Metrics) observeRunError() {
+	m.runErrors.Inc()
+}
@@ -0,0 +1,327 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+const (
+	shutdownTimeout = 5 * time.Second // maximum duration to wait for the HTTP server to shut down
+	defaultDebounce = 5 * time.Second // duration during which the triggers are batched together
+)
+
+// LoadFunc - returns a fresh copy of the test cases, it is called before every run so that
+// the results of a run do not leak into the next one
+type LoadFunc func() (data.Tests, error)
+
+// RunFunc - runs the test cases, storing the results in them
+type RunFunc func(ctx context.Context, tests data.Tests)
+
+// CleanupFunc - releases what the runs hold on to between two scheduled runs
+type CleanupFunc func(ctx context.Context) error
+
+// Schedule - returns the next time the test suite must run after t, cron.Schedule satisfies it
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Monitor - periodically runs the test suite and exposes its results
+type Monitor struct {
+	Log      hclog.Logger
+	Metrics  *Metrics
+	Debounce time.Duration // duration to wait after a trigger so that the triggers of a burst run together
+	Cleanup  CleanupFunc   // called after every scheduled run, nothing is cleaned up when nil
+
+	load LoadFunc
+	run  RunFunc
+
+	mu      sync.RWMutex
+	last    *data.Results // results of the last completed run
+	lastRun time.Time     // time at which the last completed run finished
+
+	triggerMu sync.Mutex
+	pending   map[string]bool // names of the tests triggered since the last triggered run
+	triggered chan struct{}   // signalled when tests are triggered
+}
+
+// New - returns a new Monitor
+func New(load LoadFunc, run RunFunc, log hclog.Logger) *Monitor {
+	return &Monitor{
+		Log:       log,
+		Metrics:   NewMetrics(),
+		Debounce:  defaultDebounce,
+		load:      load,
+		run:       run,
+		pending:   make(map[string]bool),
+		triggered: make(chan struct{}, 1),
+	}
+}
+
+// ParseSchedule - returns the schedule of the runs, either a cron expression in the standard
+// five fields format or a fixed interval between runs
+func ParseSchedule(interval time.Duration, cronSpec string) (Schedule, error) {
+	switch {
+	case cronSpec != "" && interval > 0:
+		return nil, fmt.Errorf("only one of interval and cron can be set")
+	case cronSpec != "":
+		schedule, err := cron.ParseStandard(cronSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", cronSpec, err)
+		}
+		return schedule, nil
+	case interval >= time.Second:
+		return cron.Every(interval), nil
+	default:
+		return nil, fmt.Errorf("interval must be at least 1s, got %s", interval)
+	}
+}
+
+// RunOnce - loads the test cases, runs them and records their results
+func (m *Monitor) RunOnce(ctx context.Context) error {
+	tests, err := m.load()
+	if err != nil {
+		m.Metrics.observeRunError()
+		return fmt.Errorf("unable to load test cases: %w", err)
+	}
+
+	start := time.Now()
+	m.run(ctx, tests)
+	finished := time.Now()
+
+	// the results of an interrupted run are incomplete, so they are discarded
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.Metrics.observeRun(tests, finished.Sub(start), finished)
+
+	m.mu.Lock()
+	m.last = tests.Results()
+	m.lastRun = finished
+	m.mu.Unlock()
+
+	failed := 0
+	for _, te := range tests {
+		if te.Failed() {
+			failed++
+		}
+	}
+
+	m.Log.Info("Finished running the tests", "tests", len(tests), "failed", failed,
+		"duration", finished.Sub(start).String())
+
+	return nil
+}
+
+// RunTests - loads the test cases and runs the ones named in names, their results replace the ones
+// of the last completed run, all the tests run when no run has completed yet
+func (m *Monitor) RunTests(ctx context.Context, names []string) error {
+	// the results of the triggered tests could not be served on their own, while their metrics would be
+	if last, _ := m.LastResults(); last == nil {
+		m.Log.Info("Running all the tests as no run has completed yet", "triggered", len(names))
+		return m.RunOnce(ctx)
+	}
+
+	tests, err := m.load()
+	if err != nil {
+		m.Metrics.observeRunError()
+		return fmt.Errorf("unable to load test cases: %w", err)
+	}
+
+	var selected data.Tests
+	for _, te := range tests {
+		if slices.Contains(names, te.Name) && !te.Skipped() {
+			selected = append(selected, te)
+		}
+	}
+
+	// the tests may have been removed since they were triggered
+	if len(selected) == 0 {
+		return nil
+	}
+
+	m.Log.Info("Running the triggered tests", "tests", len(selected))
+	m.run(ctx, selected)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.Metrics.observeTriggeredRun(selected)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the results are replaced rather than updated as they may be being served
+	results := &data.Results{Version: m.last.Version, Tests: slices.Clone(m.last.Tests)}
+	for _, res := range selected.Results().Tests {
+		if i := slices.IndexFunc(results.Tests, func(r *data.Result) bool { return r.Name == res.Name }); i >= 0 {
+			results.Tests[i] = res
+		} else {
+			results.Tests = append(results.Tests, res)
+		}
+	}
+	m.last = results
+
+	return nil
+}
+
+// Trigger - schedules a run of the tests named in names, the triggers received while the tests
+// are running or within Debounce of each other are batched into a single run
+func (m *Monitor) Trigger(names ...string) {
+	if len(names) == 0 {
+		return
+	}
+
+	m.triggerMu.Lock()
+	for _, name := range names {
+		m.pending[name] = true
+	}
+	m.triggerMu.Unlock()
+
+	select {
+	case m.triggered <- struct{}{}:
+	default:
+	}
+}
+
+// takePending - returns the names of the triggered tests and clears them
+func (m *Monitor) takePending() []string {
+	m.triggerMu.Lock()
+	defer m.triggerMu.Unlock()
+
+	names := slices.Sorted(maps.Keys(m.pending))
+	clear(m.pending)
+
+	return names
+}
+
+// Run - runs the test suite immediately and then according to schedule, until ctx is cancelled,
+// the triggered tests run in between, and Cleanup is called after every scheduled run
+func (m *Monitor) Run(ctx context.Context, schedule Schedule) {
+	for {
+		if err := m.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			m.Log.Error("Failed to run the tests", "error", err)
+		}
+
+		if m.Cleanup != nil {
+			if err := m.Cleanup(ctx); err != nil {
+				m.Log.Error("Failed to clean up after the run", "error", err)
+			}
+		}
+
+		next := schedule.Next(time.Now())
+		m.Log.Info("Waiting for the next run", "next", next.Format(time.RFC3339))
+
+		if !m.waitUntil(ctx, next) {
+			return
+		}
+	}
+}
+
+// waitUntil - runs the triggered tests until next, returns false when ctx is cancelled
+func (m *Monitor) waitUntil(ctx context.Context, next time.Time) bool {
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-m.triggered:
+		}
+
+		// wait for the rest of the burst
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(m.Debounce):
+		}
+
+		if err := m.RunTests(ctx, m.takePending()); err != nil && ctx.Err() == nil {
+			m.Log.Error("Failed to run the triggered tests", "error", err)
+		}
+	}
+}
+
+// LastResults - returns the results of the last completed run and the time it finished,
+// the results are nil when no run has completed yet
+func (m *Monitor) LastResults() (*data.Results, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.last, m.lastRun
+}
+
+// Handler - returns the HTTP handler serving /metrics, /healthz and /results
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", promhttp.HandlerFor(m.Metrics.Registry, promhttp.HandlerOpts{}))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/results", func(w http.ResponseWriter, _ *http.Request) {
+		results, _ := m.LastResults()
+		if results == nil {
+			http.Error(w, "no run has completed yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			m.Log.Error("Unable to encode the results", "error", err)
+		}
+	})
+
+	return mux
+}
+
+// ListenAndServe - serves Handler on addr until ctx is cancelled
+func (m *Monitor) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           m.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("HTTP server on %s failed: %w", addr, err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("unable to shut down HTTP server on %s: %w", addr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/controlplaneio/netassert/v2/internal/data"
+)
+
+// newTestMonitor - returns a monitor whose runs pass the tests listed in pass
+func newTestMonitor(pass map[string]bool) (*Monitor, *int) {
+	runs := 0
+
+	load := func() (data.Tests, error) {
+		return data.Tests{
+			&data.Test{Name: "test1"},
+			&data.Test{Name: "test2"},
+			&data.Test{Name: "skipped", Skip: "not ready"},
+		}, nil
+	}
+
+	run := func(_ context.Context, tests data.Tests) {
+		runs++
+		for _, te := range tests {
+			if te.Skipped() {
+				continue
+			}
+			te.Pass = pass[te.Name]
+			te.Observe().Duration = 2 * time.Second
+			if !te.Pass {
+				te.FailureReason = "exit code 1 instead of 0"
+			}
+		}
+	}
+
+	return New(load, run, hclog.NewNullLogger()), &runs
+}
+
+func TestMonitor_RunOnce(t *testing.T) {
+	r := require.New(t)
+	m, runs := newTestMonitor(map[string]bool{"test1": true})
+
+	results, _ := m.LastResults()
+	r.Nil(results)
+
+	r.NoError(m.RunOnce(context.Background()))
+	r.NoError(m.RunOnce(context.Background()))
+	r.Equal(2, *runs)
+
+	results, lastRun := m.LastResults()
+	r.NotNil(results)
+	r.False(lastRun.IsZero())
+	r.Equal(data.StatusPass, results.Tests[0].Status)
+	r.Equal(data.StatusFail, results.Tests[1].Status)
+
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.testPass.WithLabelValues("test1")))
+	r.Equal(0.0, testutil.ToFloat64(m.Metrics.testPass.WithLabelValues("test2")))
+	r.Equal(2.0, testutil.ToFloat64(m.Metrics.testDuration.WithLabelValues("test1")))
+	r.Equal(0.0, testutil.ToFloat64(m.Metrics.testFailures.WithLabelValues("test1")))
+	r.Equal(2.0, testutil.ToFloat64(m.Metrics.testFailures.WithLabelValues("test2")))
+	r.Equal(2.0, testutil.ToFloat64(m.Metrics.runs))
+	r.Equal(0.0, testutil.ToFloat64(m.Metrics.lastSuccessTime))
+
+	// skipped tests are not reported
+	r.Equal(2, testutil.CollectAndCount(m.Metrics.testPass))
+}
+
+func TestMonitor_RunOnceErrors(t *testing.T) {
+	t.Run("tests cannot be loaded", func(t *testing.T) {
+		r := require.New(t)
+		m := New(func() (data.Tests, error) { return nil, fmt.Errorf("file not found") },
+			func(context.Context, data.Tests) {}, hclog.NewNullLogger())
+
+		err := m.RunOnce(context.Background())
+		r.Error(err)
+		r.Contains(err.Error(), "unable to load test cases")
+		r.Equal(1.0, testutil.ToFloat64(m.Metrics.runErrors))
+	})
+
+	t.Run("results of an interrupted run are discarded", func(t *testing.T) {
+		r := require.New(t)
+		m, _ := newTestMonitor(map[string]bool{"test1": true, "test2": true})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r.ErrorIs(m.RunOnce(ctx), context.Canceled)
+		results, _ := m.LastResults()
+		r.Nil(results)
+		r.Equal(0.0, testutil.ToFloat64(m.Metrics.runs))
+	})
+}
+
+// everySchedule - runs the tests every d
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func TestMonitor_Run(t *testing.T) {
+	r := require.New(t)
+	m, runs := newTestMonitor(map[string]bool{"test1": true, "test2": true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx, everySchedule(time.Millisecond))
+	}()
+
+	r.Eventually(func() bool {
+		_, lastRun := m.LastResults()
+		return !lastRun.IsZero() && testutil.ToFloat64(m.Metrics.runs) >= 3
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	r.GreaterOrEqual(*runs, 3)
+	r.Greater(testutil.ToFloat64(m.Metrics.lastSuccessTime), 0.0)
+}
+
+func TestMonitor_RunCleanup(t *testing.T) {
+	r := require.New(t)
+	m, runs := newTestMonitor(map[string]bool{"test1": true, "test2": true})
+
+	// the cleanup happens after every scheduled run, before the next one starts
+	var cleanups []int
+	m.Cleanup = func(context.Context) error {
+		cleanups = append(cleanups, *runs)
+		if len(cleanups) == 1 {
+			return fmt.Errorf("probe Pod cannot be deleted")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx, everySchedule(time.Millisecond))
+	}()
+
+	// a failed cleanup does not stop the runs
+	r.Eventually(func() bool {
+		return testutil.ToFloat64(m.Metrics.runs) >= 3
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	r.GreaterOrEqual(len(cleanups), 2)
+	for i, run := range cleanups {
+		r.Equal(i+1, run)
+	}
+}
+
+func TestMonitor_RunTests(t *testing.T) {
+	r := require.New(t)
+	pass := map[string]bool{"test1": true}
+	m, runs := newTestMonitor(pass)
+
+	// all the tests run when the triggered ones have no full run to be merged into, so that the
+	// results and the metrics agree
+	r.NoError(m.RunTests(context.Background(), []string{"test2"}))
+	before, _ := m.LastResults()
+	r.Len(before.Tests, 3)
+	r.Equal(data.StatusPass, before.Tests[0].Status)
+	r.Equal(data.StatusFail, before.Tests[1].Status)
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.runs))
+	r.Equal(0.0, testutil.ToFloat64(m.Metrics.triggeredRuns))
+
+	pass["test2"] = true
+	r.NoError(m.RunTests(context.Background(), []string{"test2", "skipped", "removed"}))
+	r.Equal(2, *runs)
+
+	results, _ := m.LastResults()
+	r.Len(results.Tests, 3)
+	r.Equal(data.StatusPass, results.Tests[1].Status)
+	// the results that may be being served are not modified
+	r.Equal(data.StatusFail, before.Tests[1].Status)
+
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.testPass.WithLabelValues("test2")))
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.testPass.WithLabelValues("test1")))
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.triggeredRuns))
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.runs))
+
+	// no run happens when none of the tests exist anymore
+	r.NoError(m.RunTests(context.Background(), []string{"removed"}))
+	r.Equal(2, *runs)
+}
+
+func TestMonitor_Trigger(t *testing.T) {
+	r := require.New(t)
+	m, _ := newTestMonitor(map[string]bool{"test1": true, "test2": true})
+	m.Debounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx, everySchedule(time.Hour))
+	}()
+
+	r.Eventually(func() bool {
+		return testutil.ToFloat64(m.Metrics.runs) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// the triggers of a burst run together
+	m.Trigger("test1")
+	m.Trigger("test2")
+	m.Trigger()
+
+	r.Eventually(func() bool {
+		return testutil.ToFloat64(m.Metrics.triggeredRuns) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.triggeredRuns))
+	r.Equal(1.0, testutil.ToFloat64(m.Metrics.runs))
+	r.Empty(m.takePending())
+}
+
+func TestMonitor_Handler(t *testing.T) {
+	r := require.New(t)
+	m, _ := newTestMonitor(map[string]bool{"test1": true})
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		r.NoError(err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		r.NoError(err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/healthz")
+	r.Equal(http.StatusOK, code)
+
+	code, _ = get("/results")
+	r.Equal(http.StatusServiceUnavailable, code)
+
+	r.NoError(m.RunOnce(context.Background()))
+
+	code, body := get("/results")
+	r.Equal(http.StatusOK, code)
+	results, err := data.ReadResults(strings.NewReader(body))
+	r.NoError(err)
+	r.Len(results.Tests, 3)
+
+	code, body = get("/metrics")
+	r.Equal(http.StatusOK, code)
+	r.Contains(body, `netassert_test_pass{test="test1"} 1`)
+	r.Contains(body, `netassert_test_failures_total{test="test2"} 1`)
+}
+
+func TestParseSchedule(t *testing.T) {
+	r := require.New(t)
+	now := time.Date(2026, 1, 1, 10, 7, 0, 0, time.UTC)
+
+	schedule, err := ParseSchedule(5*time.Minute, "")
+	r.NoError(err)
+	r.Equal(now.Add(5*time.Minute), schedule.Next(now))
+
+	schedule, err = ParseSchedule(0, "*/15 * * * *")
+	r.NoError(err)
+	r.Equal(time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC), schedule.Next(now))
+
+	_, err = ParseSchedule(time.Minute, "*/15 * * * *")
+	r.Error(err)
+
+	_, err = ParseSchedule(0, "every day")
+	r.Error(err)
+
+	_, err = ParseSchedule(0, "")
+	r.Error(err)
+}
+
+func TestMetrics_Measurements(t *testing.T) {
+	r := require.New(t)
+	m := NewMetrics()
+
+	measured := &data.Test{Name: "web-to-api", MaxConnectLatency: "50ms", Pass: true}
+	measured.Observe().Measurements = &data.Measurements{ConnectLatency: 20 * time.Millisecond}
+
+	parent := &data.Test{Name: "web-to-hosts", Pass: true, SubTests: data.Tests{
+		{Name: "web-to-hosts [10.0.0.1]", Pass: true, Observation: &data.Observation{
+			Measurements: &data.Measurements{
+				ConnectLatency:   time.Millisecond,
+				TransferredBytes: 1 << 20,
+				TransferDuration: time.Second,
+			},
+		}},
+	}}
+
+	m.observeRun(data.Tests{measured, parent, {Name: "unmeasured", Pass: true}}, time.Second, time.Now())
+
+	r.Equal(0.02, testutil.ToFloat64(m.connectLatency.WithLabelValues("web-to-api")))
+	r.Equal(0.001, testutil.ToFloat64(m.connectLatency.WithLabelValues("web-to-hosts [10.0.0.1]")))
+	r.Equal(float64(8<<20), testutil.ToFloat64(m.throughput.WithLabelValues("web-to-hosts [10.0.0.1]")))
+
+	// only the measured tests are reported
+	r.Equal(2, testutil.CollectAndCount(m.connectLatency))
+	r.Equal(1, testutil.CollectAndCount(m.throughput))
+}